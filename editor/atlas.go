@@ -0,0 +1,417 @@
+package editor
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/akiyosi/goneovim/grid"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+)
+
+const (
+	// glyphAtlasPageSize is the width and height of an atlas page in device pixels
+	glyphAtlasPageSize = 1024
+	// glyphAtlasMaxPages is the number of pages the atlas can hold.
+	// When all pages are used, the atlas is cleared and rebuilt from scratch,
+	// so the memory used for the glyphs never exceeds this limit.
+	glyphAtlasMaxPages = 8
+	// glyphAtlasStatsInterval is the number of rasterized glyphs between
+	// statistics in the debug log
+	glyphAtlasStatsInterval = 1024
+	// ligatureAtlasMaxLen is the number of the cells of the longest ligature
+	// run cached in the atlas. The longer runs, such as the separator lines
+	// of "=" or "-", are rare enough to be drawn directly, so that each of
+	// their lengths does not take a slot of the atlas.
+	ligatureAtlasMaxLen = 8
+)
+
+// ligatureChars are the characters which can form a ligature with the
+// adjacent characters in programming fonts
+const ligatureChars = "!#$%&*+-./:;<=>?@\\^_|~"
+
+// GlyphKey is the key of a glyph in the glyph atlas
+type GlyphKey struct {
+	font     string
+	features string
+	text     string
+	fg       RGBA
+	width    float64
+	centered bool
+}
+
+// Glyph is a rasterized glyph in the glyph atlas
+type Glyph struct {
+	page   int
+	source *core.QRectF
+	width  float64
+	height float64
+}
+
+// GlyphAtlas holds the glyphs rasterized on some large images.
+// A glyph is rasterized in its color once, and the text is drawn by copying
+// the glyphs from the pages onto the window directly.
+type GlyphAtlas struct {
+	devicePixelRatio float64
+	pages            []*gui.QImage
+	glyphs           map[GlyphKey]*Glyph
+
+	// position to place the next glyph in the last page
+	x         int
+	y         int
+	rowHeight int
+
+	hits   int
+	misses int
+	resets int
+}
+
+func newGlyphAtlas() *GlyphAtlas {
+	return &GlyphAtlas{
+		glyphs: make(map[GlyphKey]*Glyph),
+	}
+}
+
+func (a *GlyphAtlas) clear() {
+	for _, page := range a.pages {
+		page.DestroyQImage()
+	}
+	a.pages = nil
+	a.glyphs = make(map[GlyphKey]*Glyph)
+	a.x = 0
+	a.y = 0
+	a.rowHeight = 0
+}
+
+func (a *GlyphAtlas) logStats(reason string) {
+	editor.putLog(
+		"glyph atlas", reason+":",
+		"glyphs", len(a.glyphs),
+		"pages", len(a.pages),
+		"hits", a.hits,
+		"misses", a.misses,
+		"resets", a.resets,
+	)
+}
+
+// fits reports whether a glyph of width and height can be placed in a page
+func (a *GlyphAtlas) fits(width, height, devicePixelRatio float64) bool {
+	return math.Ceil(width*devicePixelRatio) <= glyphAtlasPageSize &&
+		math.Ceil(height*devicePixelRatio) <= glyphAtlasPageSize
+}
+
+// glyph returns the glyph of the text of key rasterized with font and the
+// font features of features, it is rasterized into the atlas if it does not
+// exist yet.
+func (a *GlyphAtlas) glyph(font *gui.QFont, features *Font, key GlyphKey, height, devicePixelRatio float64) *Glyph {
+	if a.devicePixelRatio != devicePixelRatio {
+		a.clear()
+		a.devicePixelRatio = devicePixelRatio
+	}
+
+	g, ok := a.glyphs[key]
+	if ok {
+		a.hits++
+		return g
+	}
+	a.misses++
+
+	// The glyphs larger than a page are drawn directly by the callers
+	width := key.width
+	w := int(math.Ceil(width * devicePixelRatio))
+	h := int(math.Ceil(height * devicePixelRatio))
+
+	// Move to the next row, or the next page
+	if len(a.pages) > 0 && a.x+w > glyphAtlasPageSize {
+		a.x = 0
+		a.y += a.rowHeight
+		a.rowHeight = 0
+	}
+	if len(a.pages) == 0 || a.y+h > glyphAtlasPageSize {
+		if len(a.pages) >= glyphAtlasMaxPages {
+			a.resets++
+			a.logStats("reset")
+			a.clear()
+		}
+		page := gui.NewQImage3(glyphAtlasPageSize, glyphAtlasPageSize, gui.QImage__Format_ARGB32_Premultiplied)
+		page.SetDevicePixelRatio(devicePixelRatio)
+		page.Fill3(core.Qt__transparent)
+		a.pages = append(a.pages, page)
+		a.x = 0
+		a.y = 0
+		a.rowHeight = 0
+	}
+
+	page := a.pages[len(a.pages)-1]
+	pi := gui.NewQPainter2(page)
+	pi.SetPen2(key.fg.QColor())
+	pi.SetFont(font)
+	features.drawTextInRect(
+		pi,
+		core.NewQRectF4(
+			float64(a.x)/devicePixelRatio,
+			float64(a.y)/devicePixelRatio,
+			width,
+			height,
+		), key.text, key.centered,
+	)
+	pi.DestroyQPainter()
+
+	g = &Glyph{
+		page:   len(a.pages) - 1,
+		source: core.NewQRectF4(float64(a.x), float64(a.y), float64(w), float64(h)),
+		width:  width,
+		height: height,
+	}
+	a.glyphs[key] = g
+	a.x += w
+	if h > a.rowHeight {
+		a.rowHeight = h
+	}
+
+	if a.misses%glyphAtlasStatsInterval == 0 {
+		a.logStats("stats")
+	}
+
+	return g
+}
+
+func (w *Window) getAtlas() *GlyphAtlas {
+	if w.s.atlas == nil {
+		w.s.atlas = newGlyphAtlas()
+	}
+
+	return w.s.atlas
+}
+
+// glyphFont returns the font to rasterize the text of the cell with the highlight.
+// If the primary font does not have the glyph of text, the font in the
+// fallback chain of guifont is used.
+func (w *Window) glyphFont(highlight *Highlight, isNormalWidth bool, text string) *styledFont {
+	font := w.getFont()
+	if !isNormalWidth && w.font == nil && w.s.ws.fontwide != nil {
+		font = w.s.ws.fontwide
+		return font.styled(font.fontNew, highlight.bold, highlight.italic)
+	}
+	if fallback, ok := font.fallbackFor(text); ok {
+		return font.styled(fallback.font, highlight.bold, highlight.italic)
+	}
+
+	return font.styled(font.fontNew, highlight.bold, highlight.italic)
+}
+
+// drawGlyph draws text from the column x through the atlas. The glyph is
+// width wide, and centred in it if centered is true.
+// The text larger than an atlas page is drawn directly.
+func (w *Window) drawGlyph(p *gui.QPainter, top float64, x int, text string, font *styledFont, fg *RGBA, width float64, centered bool) {
+	if fg == nil {
+		return
+	}
+	wsfont := w.getFont()
+	atlas := w.getAtlas()
+	if !atlas.fits(width, float64(wsfont.lineHeight), w.devicePixelRatio) {
+		w.drawGlyphDirect(p, top, x, text, font, fg, width, centered)
+		return
+	}
+	g := atlas.glyph(
+		font.font,
+		wsfont,
+		GlyphKey{
+			font:     font.key,
+			features: wsfont.featureKey(),
+			text:     text,
+			fg:       *fg,
+			width:    width,
+			centered: centered,
+		},
+		float64(wsfont.lineHeight),
+		w.devicePixelRatio,
+	)
+	p.DrawImage(
+		core.NewQRectF4(
+			float64(x)*wsfont.truewidth,
+			top,
+			g.width,
+			g.height,
+		),
+		atlas.pages[g.page],
+		g.source,
+		core.Qt__AutoColor,
+	)
+}
+
+// drawGlyphDirect draws text from the column x as drawGlyph does, but
+// directly without the atlas
+func (w *Window) drawGlyphDirect(p *gui.QPainter, top float64, x int, text string, font *styledFont, fg *RGBA, width float64, centered bool) {
+	if fg == nil {
+		return
+	}
+	wsfont := w.getFont()
+	p.SetFont(font.font)
+	p.SetPen2(fg.QColor())
+	wsfont.drawTextInRect(
+		p,
+		core.NewQRectF4(
+			float64(x)*wsfont.truewidth,
+			top,
+			width,
+			float64(wsfont.lineHeight),
+		), text, centered,
+	)
+}
+
+// drawGlyphRun draws the cells at columns xs of line with the same highlight
+// by copying the glyphs in the atlas.
+func (w *Window) drawGlyphRun(p *gui.QPainter, top float64, line []*grid.Cell, xs []int, highlight *Highlight, isNormalWidth bool) {
+	if len(xs) == 0 {
+		return
+	}
+	font := w.getFont()
+	fg := w.dim(highlight.fg())
+	styled := w.glyphFont(highlight, isNormalWidth, "")
+
+	for _, x := range xs {
+		text := line[x].Text
+		width := font.italicWidth
+		if !isNormalWidth {
+			width = math.Ceil(w.s.runeTextWidth(font, text))
+		}
+		gfont := styled
+		if _, ok := font.fallbackFor(text); ok {
+			gfont = w.glyphFont(highlight, isNormalWidth, text)
+		}
+		w.drawGlyph(p, top, x, text, gfont, fg, width, false)
+	}
+}
+
+// isLigatureCell reports whether the cell can form a ligature with the
+// adjacent cells
+func isLigatureCell(c *grid.Cell) bool {
+	return c != nil && len(c.Text) == 1 && strings.Contains(ligatureChars, c.Text)
+}
+
+// ligatureLen returns the number of the cells from x which can form a ligature,
+// that is, the adjacent symbol characters with the same highlight.
+func (w *Window) ligatureLen(line []*grid.Cell, x int) int {
+	n := 0
+	for i := x; i < len(line); i++ {
+		c := line[i]
+		if !isLigatureCell(c) {
+			break
+		}
+		if c.HlID != line[x].HlID {
+			break
+		}
+		n++
+	}
+
+	return n
+}
+
+// drawLigature draws the cells from x to x+n-1 as a glyph of their text,
+// so that the font can replace them with a ligature.
+func (w *Window) drawLigature(p *gui.QPainter, top float64, line []*grid.Cell, x, n int) {
+	font := w.getFont()
+	highlight := w.cellHighlight(line[x])
+	var text strings.Builder
+	for i := x; i < x+n; i++ {
+		text.WriteString(line[i].Text)
+	}
+
+	draw := w.drawGlyph
+	if n > ligatureAtlasMaxLen {
+		draw = w.drawGlyphDirect
+	}
+	draw(
+		p, top, x, text.String(),
+		w.glyphFont(highlight, true, ""),
+		w.dim(highlight.fg()),
+		float64(n)*font.truewidth+font.italicWidth,
+		false,
+	)
+}
+
+// ligatureStart returns the first column of the ligature run which the
+// column x is in, so that the run is shaped as a whole even if the drawing
+// starts in the middle of it.
+func ligatureStart(line []*grid.Cell, x int) int {
+	if x >= len(line) || !isLigatureCell(line[x]) {
+		return x
+	}
+	for x > 0 && isLigatureCell(line[x-1]) && line[x-1].HlID == line[x].HlID {
+		x--
+	}
+
+	return x
+}
+
+// ligatureSpan extends the columns from start to end (exclusive) to the
+// boundaries of the ligature runs adjacent to them. A change of a cell
+// changes the shaping of the whole run it joins or leaves, so the run has to
+// be repainted with it. The highlights are ignored, since a change of them
+// splits or joins the runs too.
+func ligatureSpan(line []*grid.Cell, start, end int) (int, int) {
+	for start > 0 && start <= len(line) && isLigatureCell(line[start-1]) {
+		start--
+	}
+	for end >= 0 && end < len(line) && isLigatureCell(line[end]) {
+		end++
+	}
+
+	return start, end
+}
+
+// isWideGlyph reports whether the cell is drawn centred across its cells,
+// that is, it is a double width cell or an emoji.
+func isWideGlyph(cell *grid.Cell) bool {
+	if cell.Width == 2 {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(cell.Text)
+
+	return grid.IsEmoji(r)
+}
+
+// wideGlyphWidth returns the width of the cells neovim allocates for the
+// wide glyph at x
+func (w *Window) wideGlyphWidth(line []*grid.Cell, x int) float64 {
+	cells := line[x].Width
+	if cells < 1 {
+		cells = 1
+	}
+
+	return float64(cells) * w.getFont().truewidth
+}
+
+// drawWideGlyphCached draws the text of the cell at x centred across its
+// cells through the atlas. Color glyphs such as emoji keep their colors,
+// since the pen does not apply to them.
+func (w *Window) drawWideGlyphCached(p *gui.QPainter, top float64, line []*grid.Cell, x int) {
+	highlight := w.cellHighlight(line[x])
+	w.drawGlyph(
+		p, top, x, line[x].Text,
+		w.glyphFont(highlight, false, line[x].Text),
+		w.dim(highlight.fg()),
+		w.wideGlyphWidth(line, x),
+		true,
+	)
+}
+
+// drawWideGlyph draws the text of the cell at x centred across its cells
+// directly, which is used when the drawing is not cached.
+func (w *Window) drawWideGlyph(p *gui.QPainter, top float64, line []*grid.Cell, x int) {
+	font := w.getFont()
+	highlight := w.cellHighlight(line[x])
+
+	p.SetFont(w.glyphFont(highlight, false, line[x].Text).font)
+	p.SetPen2(w.dim(highlight.fg()).QColor())
+	p.DrawText6(
+		core.NewQRectF4(
+			float64(x)*font.truewidth,
+			top,
+			w.wideGlyphWidth(line, x),
+			float64(font.lineHeight),
+		), line[x].Text, gui.NewQTextOption2(core.Qt__AlignCenter),
+	)
+}
@@ -0,0 +1,63 @@
+package editor
+
+import (
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// bell handles the bell and visual_bell events in the way set by Editor.Bell
+func (w *Workspace) bell() {
+	switch editor.config.Editor.Bell {
+	case "visual":
+		w.flash()
+	case "audible":
+		widgets.QApplication_Beep()
+	case "notify":
+		editor.pushNotification(NotifyWarn, 2, "Bell")
+	default:
+	}
+}
+
+// flash draws a short fading overlay on the current window
+func (w *Workspace) flash() {
+	win, ok := w.screen.getWindow(w.cursor.gridid)
+	if !ok {
+		return
+	}
+
+	color := w.foreground
+	if color == nil {
+		return
+	}
+	widget := widgets.NewQWidget(nil, 0)
+	widget.SetAttribute(core.Qt__WA_TransparentForMouseEvents, true)
+	widget.SetParent(win)
+	widget.SetFixedSize(win.Size())
+	widget.Move2(0, 0)
+	widget.ConnectPaintEvent(func(e *gui.QPaintEvent) {
+		p := gui.NewQPainter2(widget)
+		p.FillRect5(
+			0,
+			0,
+			widget.Width(),
+			widget.Height(),
+			newRGBA(color.R, color.G, color.B, 0.2).QColor(),
+		)
+		p.DestroyQPainter()
+	})
+	widget.Show()
+
+	eff := widgets.NewQGraphicsOpacityEffect(widget)
+	widget.SetGraphicsEffect(eff)
+	a := core.NewQPropertyAnimation2(eff, core.NewQByteArray2("opacity", len("opacity")), widget)
+	a.SetDuration(150)
+	a.SetStartValue(core.NewQVariant5(1))
+	a.SetEndValue(core.NewQVariant5(0))
+	a.SetEasingCurve(core.NewQEasingCurve(core.QEasingCurve__OutQuad))
+	a.ConnectFinished(func() {
+		widget.Hide()
+		widget.DeleteLater()
+	})
+	a.Start(core.QAbstractAnimation__DeletionPolicy(core.QAbstractAnimation__DeleteWhenStopped))
+}
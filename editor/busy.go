@@ -0,0 +1,117 @@
+package editor
+
+import (
+	"runtime"
+
+	"github.com/therecipe/qt/core"
+)
+
+var busySpinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// BusyIndicator shows a spinner in the statusline or the window title
+// while neovim is busy for longer than Editor.BusyIndicatorDelay
+type BusyIndicator struct {
+	ws     *Workspace
+	delay  *core.QTimer
+	ticker *core.QTimer
+	frame  int
+	shown  bool
+}
+
+func newBusyIndicator(ws *Workspace) *BusyIndicator {
+	b := &BusyIndicator{
+		ws:     ws,
+		delay:  core.NewQTimer(nil),
+		ticker: core.NewQTimer(nil),
+	}
+	b.delay.SetSingleShot(true)
+	b.delay.ConnectTimeout(b.show)
+	b.ticker.ConnectTimeout(b.tick)
+
+	return b
+}
+
+func (b *BusyIndicator) start() {
+	if editor.config.Editor.BusyIndicator == "none" {
+		return
+	}
+	if b.shown || b.delay.IsActive() {
+		return
+	}
+	b.delay.Start(editor.config.Editor.BusyIndicatorDelay)
+}
+
+func (b *BusyIndicator) stop() {
+	b.delay.Stop()
+	if !b.shown {
+		return
+	}
+	b.ticker.Stop()
+	b.shown = false
+	b.draw("")
+}
+
+// destroy stops the timers of the workspace being removed, so that they do
+// not draw the spinner of the workspace which is gone
+func (b *BusyIndicator) destroy() {
+	b.delay.Stop()
+	b.ticker.Stop()
+	b.shown = false
+	b.delay.DestroyQTimer()
+	b.ticker.DestroyQTimer()
+}
+
+func (b *BusyIndicator) show() {
+	b.shown = true
+	b.frame = 0
+	b.draw(busySpinnerFrames[b.frame])
+	b.ticker.Start(80)
+}
+
+func (b *BusyIndicator) tick() {
+	if !b.shown {
+		return
+	}
+	b.frame = (b.frame + 1) % len(busySpinnerFrames)
+	b.draw(busySpinnerFrames[b.frame])
+}
+
+// updateTitle sets the window title of the workspace which becomes active,
+// with the spinner only if it is busy. The title keeps the spinner of the
+// previous workspace otherwise.
+func (b *BusyIndicator) updateTitle() {
+	if editor.config.Editor.BusyIndicator != "title" || editor.window == nil {
+		return
+	}
+	frame := ""
+	if b.shown {
+		frame = busySpinnerFrames[b.frame]
+	}
+	b.draw(frame)
+}
+
+func (b *BusyIndicator) draw(frame string) {
+	switch editor.config.Editor.BusyIndicator {
+	case "statusline":
+		if b.ws.statusline == nil {
+			return
+		}
+		b.ws.statusline.busy.redraw(frame)
+	case "title":
+		if editor.workspaces[editor.active] != b.ws {
+			return
+		}
+		title := b.ws.title
+		if title == "" {
+			// nvim has not set the title
+			title = "Neovim"
+		}
+		if frame != "" {
+			title = frame + " " + title
+		}
+		editor.window.SetupTitle(title)
+		if runtime.GOOS == "linux" {
+			editor.window.SetWindowTitle(title)
+		}
+	}
+}
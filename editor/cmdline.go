@@ -3,8 +3,7 @@ package editor
 import (
 	"fmt"
 	"strings"
-
-	"github.com/akiyosi/goneovim/util"
+	"unicode/utf8"
 )
 
 // CmdContent is the content of the cmdline
@@ -13,6 +12,10 @@ type CmdContent struct {
 	firstc  string
 	prompt  string
 	content string
+	raw     string
+	chunks  []hlChunk
+	level   int
+	pos     int
 }
 
 // Cmdline is the cmdline
@@ -22,9 +25,11 @@ type Cmdline struct {
 	pos           int
 	content       *CmdContent
 	preContent    *CmdContent
+	parents       []*CmdContent
 	function      []*CmdContent
 	inFunction    bool
-	rawItems      []interface{}
+	block         []string
+	rawItems      []popupmenuItem
 	wildmenuShown bool
 	top           int
 }
@@ -32,7 +37,7 @@ type Cmdline struct {
 func initCmdline() *Cmdline {
 	return &Cmdline{
 		content:  &CmdContent{},
-		rawItems: make([]interface{}, 0),
+		rawItems: make([]popupmenuItem, 0),
 	}
 }
 
@@ -67,53 +72,38 @@ func sanitize(s string) string {
 	return s
 }
 
-func (c *Cmdline) show(args []interface{}) {
+func (c *Cmdline) show(arg cmdlineShow) {
 	if c.ws.palette == nil {
 		return
 	}
 	palette := c.ws.palette
-	arg := args[0].([]interface{})
-
-	content := ""
-	contentChunks := arg[0].([]interface{})
-	for _, e := range contentChunks {
-		a := e.([]interface{})
-
-		if len(a) < 2 {
-			// content += a[0].(string)
-			content += strings.Replace(a[0].(string), "\t", " ", -1)
-		} else {
-			color := c.ws.foreground
-			_, ok := c.ws.screen.hlAttrDef[util.ReflectToInt(a[0])]
-			if ok {
-				color = c.ws.screen.hlAttrDef[util.ReflectToInt(a[0])].foreground
-			}
 
-			// I don't know how to set sticking out direction of
-			// the contents of a qlabel with html text to the left.
-			if len(contentChunks) == 1 {
-				// content += a[1].(string)
-				content += strings.Replace(a[1].(string), "\t", " ", -1)
-			} else {
-				content += fmt.Sprintf(
-					"<font color='%s'>%s</font>",
-					color.Hex(),
-					sanitize(a[1].(string)),
-				)
-				palette.isHTMLText = true
-			}
-		}
+	content := c.contentText(arg.content)
+	raw := ""
+	for _, chunk := range arg.content {
+		raw += chunk.text
 	}
-	// content := arg[0].([]interface{})[0].([]interface{})[1].(string)
 
-	pos := util.ReflectToInt(arg[1])
-	firstc := arg[2].(string)
-	prompt := arg[3].(string)
-	indent := util.ReflectToInt(arg[4])
-	// level := util.ReflectToInt(arg[5])
+	pos := arg.pos
+	firstc := arg.firstc
+	prompt := arg.prompt
+	indent := arg.indent
+	level := arg.level
 	// fmt.Println("cmdline show", content, pos, firstc, prompt, indent, level)
 
+	// A nested cmdline such as <C-r>= is shown,
+	// keep the parent level to restore it when the nested one is hidden
+	if c.shown && level > c.content.level {
+		c.content.pos = c.pos
+		c.parents = append(c.parents, c.content)
+		c.content = &CmdContent{}
+		c.updateBlock()
+	}
+
 	c.pos = pos
+	c.content.level = level
+	c.content.raw = raw
+	c.content.chunks = arg.content
 	c.content.firstc = firstc
 	isResize := c.content.content != content
 	c.content.content = content
@@ -185,10 +175,23 @@ func (c *Cmdline) cursorMove() {
 	c.ws.palette.cursorMove(c.pos + len(c.content.firstc) + c.content.indent)
 }
 
-func (c *Cmdline) hide() {
+func (c *Cmdline) hide(hides []cmdlineHide) {
 	if c.ws.palette == nil {
 		return
 	}
+
+	// cmdline_hide has the level since nvim 0.10
+	level := c.content.level
+	if len(hides) > 0 && hides[0].level >= 0 {
+		level = hides[0].level
+	}
+	if len(c.parents) > 0 && level > c.parents[len(c.parents)-1].level {
+		c.restoreParent()
+		return
+	}
+	c.parents = nil
+	c.updateBlock()
+
 	palette := c.ws.palette
 	palette.hide()
 	if c.inFunction {
@@ -208,12 +211,27 @@ func (c *Cmdline) hide() {
 		c.ws.cursor.widget.SetParent(win)
 		c.ws.cursor.isInPalette = false
 		c.ws.cursor.widget.Hide()
-		c.ws.cursor.widget.Show()
+		if !c.ws.cursor.isBusy {
+			c.ws.cursor.widget.Show()
+		}
 	}
 
 	c.shown = false
 }
 
+// restoreParent shows the parent level of the nested cmdline again
+func (c *Cmdline) restoreParent() {
+	c.content = c.parents[len(c.parents)-1]
+	c.parents = c.parents[:len(c.parents)-1]
+	c.pos = c.content.pos
+
+	palette := c.ws.palette
+	palette.setPattern(c.getText(""))
+	c.updateBlock()
+	palette.resize()
+	c.cursorMove()
+}
+
 func (c *Cmdline) functionShow() {
 	c.inFunction = true
 	c.function = []*CmdContent{c.preContent}
@@ -223,24 +241,148 @@ func (c *Cmdline) functionHide() {
 	c.inFunction = false
 }
 
-func (c *Cmdline) changePos(args []interface{}) {
-	args = args[0].([]interface{})
-	pos := util.ReflectToInt(args[0])
-	// level := util.ReflectToInt(args[1])
+func (c *Cmdline) blockShow(lines [][]hlChunk) {
+	c.block = []string{}
+	for _, line := range lines {
+		c.block = append(c.block, c.chunksToHTML(line))
+	}
+	c.updateBlock()
+}
+
+func (c *Cmdline) blockAppend(lines [][]hlChunk) {
+	for _, line := range lines {
+		c.block = append(c.block, c.chunksToHTML(line))
+	}
+	c.updateBlock()
+}
+
+func (c *Cmdline) blockHide() {
+	c.block = nil
+	c.updateBlock()
+}
+
+func (c *Cmdline) updateBlock() {
+	if c.ws.palette == nil {
+		return
+	}
+	lines := append([]string{}, c.block...)
+
+	// The parent levels of the nested cmdline are shown dimmed
+	color := c.ws.foreground
+	if editor.colors.inactiveFg != nil {
+		color = editor.colors.inactiveFg
+	}
+	for _, parent := range c.parents {
+		lines = append(lines, fmt.Sprintf(
+			"<font color='%s'>%s</font>",
+			color.Hex(),
+			sanitize(parent.firstc+strings.Repeat(" ", parent.indent)+parent.raw),
+		))
+	}
+
+	c.ws.palette.setBlock(lines)
+}
+
+// contentText returns the text of the chunks shown in the palette.
+// It is html text if there are several chunks.
+func (c *Cmdline) contentText(chunks []hlChunk) string {
+	// I don't know how to set sticking out direction of
+	// the contents of a qlabel with html text to the left.
+	if len(chunks) == 1 {
+		return strings.Replace(chunks[0].text, "\t", " ", -1)
+	}
+	if len(chunks) > 1 {
+		c.ws.palette.isHTMLText = true
+	}
+
+	return c.chunksToHTML(chunks)
+}
+
+// chunksToHTML converts the [attr_id, text] chunks of a cmdline line to html text
+func (c *Cmdline) chunksToHTML(chunks []hlChunk) string {
+	text := ""
+	for _, chunk := range chunks {
+		color := c.ws.foreground
+		hl, ok := c.ws.screen.hlAttrDef[chunk.attr]
+		if ok && hl.foreground != nil {
+			color = hl.foreground
+		}
+		text += fmt.Sprintf(
+			"<font color='%s'>%s</font>",
+			color.Hex(),
+			sanitize(chunk.text),
+		)
+	}
+
+	return text
+}
+
+func (c *Cmdline) changePos(arg cmdlinePos) {
+	pos := arg.pos
+	level := arg.level
 	// fmt.Println("change pos", pos, level)
+	if level != c.content.level {
+		return
+	}
 	c.pos = pos
 	c.cursorMove()
 }
 
-func (c *Cmdline) putChar(args []interface{}) {
+// specialChar shows the character which is pending to be inserted by
+// <C-v> or <C-r>. If shift is true, the text after the cursor is shifted,
+// otherwise the character is drawn over the character under the cursor.
+// The character is put in the chunks, since the content is html text when
+// the cmdline has several chunks.
+func (c *Cmdline) specialChar(arg cmdlineSpecialChar) {
+	if c.ws.palette == nil {
+		return
+	}
+	chunks := insertChunkText(c.content.chunks, c.pos, arg.c, !arg.shift)
+	c.ws.palette.setPattern(
+		c.content.firstc + strings.Repeat(" ", c.content.indent) + c.contentText(chunks),
+	)
+}
+
+// insertChunkText returns the chunks with text inserted at the byte offset
+// pos of their text. If replace is true, the character at pos is replaced.
+func insertChunkText(chunks []hlChunk, pos int, text string, replace bool) []hlChunk {
+	if len(chunks) == 0 {
+		return []hlChunk{{text: text}}
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	inserted := make([]hlChunk, len(chunks))
+	copy(inserted, chunks)
+	offset := 0
+	for i, chunk := range inserted {
+		// The end of the text belongs to the last chunk
+		if pos > offset+len(chunk.text) || pos == offset+len(chunk.text) && i < len(inserted)-1 {
+			offset += len(chunk.text)
+			continue
+		}
+		head := chunk.text[:pos-offset]
+		tail := chunk.text[pos-offset:]
+		if replace {
+			_, size := utf8.DecodeRuneInString(tail)
+			tail = tail[size:]
+		}
+		inserted[i].text = head + text + tail
+
+		return inserted
+	}
+
+	// pos is beyond the end of the text
+	inserted[len(inserted)-1].text += text
+
+	return inserted
+}
+
+func (c *Cmdline) putChar(ch string) {
 	if c.ws.palette == nil {
 		return
 	}
-	args = args[0].([]interface{})
-	ch := args[0].(string)
-	// shift := util.ReflectToInt(args[1])
-	// level := util.ReflectToInt(args[2])
-	// fmt.Println("putChar", ch, shift, level)
 	text := c.getText(ch)
 	palette := c.ws.palette
 	palette.setPattern(text)
@@ -330,14 +472,14 @@ func (c *Cmdline) putChar(args []interface{}) {
 // 	c.wildmenuShown = false
 // }
 
-func (c *Cmdline) cmdWildmenuShow(args []interface{}) {
+func (c *Cmdline) cmdWildmenuShow(shows []popupmenuShow) {
 	if c.ws.palette == nil {
 		return
 	}
 	c.wildmenuShown = true
 
-	for _, arg := range args {
-		c.rawItems = (arg.([]interface{}))[0].([]interface{})
+	for _, show := range shows {
+		c.rawItems = show.items
 
 		palette := c.ws.palette
 		c.top = 0
@@ -347,7 +489,7 @@ func (c *Cmdline) cmdWildmenuShow(args []interface{}) {
 				resultItem.hide()
 				continue
 			}
-			text := (c.rawItems[i].([]interface{}))[0].(string)
+			text := c.rawItems[i].word
 			resultItem.setItem(text, "", []int{})
 			resultItem.show()
 			resultItem.setSelected(false)
@@ -369,11 +511,10 @@ func (c *Cmdline) cmdWildmenuShow(args []interface{}) {
 	}
 }
 
-func (c *Cmdline) cmdWildmenuSelect(args []interface{}) {
+func (c *Cmdline) cmdWildmenuSelect(selected int) {
 	if c.ws.palette == nil {
 		return
 	}
-	selected := util.ReflectToInt(args[0].([]interface{})[0])
 	// fmt.Println("selected is", selected)
 	showTotal := c.ws.palette.showTotal
 	if selected == -1 && c.top > 0 {
@@ -400,11 +541,11 @@ func (c *Cmdline) cmdWildmenuScroll(n int) {
 	palette := c.ws.palette
 	for i := 0; i < palette.showTotal; i++ {
 		resultItem := palette.resultItems[i]
-		if i >= len(c.rawItems) {
+		if i+c.top >= len(c.rawItems) {
 			resultItem.hide()
 			continue
 		}
-		text := (c.rawItems[i+c.top].([]interface{}))[0].(string)
+		text := c.rawItems[i+c.top].word
 		resultItem.setItem(text, "", []int{})
 		resultItem.show()
 		resultItem.setSelected(false)
@@ -0,0 +1,34 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInsertChunkText(t *testing.T) {
+	chunks := []hlChunk{{attr: 1, text: "ec"}, {attr: 2, text: "ho é"}}
+	tests := []struct {
+		name    string
+		pos     int
+		replace bool
+		want    []hlChunk
+	}{
+		{"shift in the first chunk", 1, false, []hlChunk{{1, "e^c"}, {2, "ho é"}}},
+		{"replace at the head of a chunk", 2, true, []hlChunk{{1, "ec"}, {2, "^o é"}}},
+		{"replace a multibyte character", 5, true, []hlChunk{{1, "ec"}, {2, "ho ^"}}},
+		{"end of the text", 7, true, []hlChunk{{1, "ec"}, {2, "ho é^"}}},
+		{"beyond the end", 20, false, []hlChunk{{1, "ec"}, {2, "ho é^"}}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := insertChunkText(chunks, tt.pos, "^", tt.replace)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("insertChunkText() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if chunks[0].text != "ec" || chunks[1].text != "ho é" {
+		t.Errorf("insertChunkText() modified the chunks: %v", chunks)
+	}
+}
@@ -30,6 +30,9 @@ type editorConfig struct {
 	Height                   int
 	Gap                      int
 	FontFamily               string
+	FontFamilyBold           string
+	FontFamilyItalic         string
+	FontFamilyBoldItalic     string
 	FontSize                 int
 	Linespace                int
 	ExtCmdline               bool
@@ -44,6 +47,7 @@ type editorConfig struct {
 	StartFullscreen          bool
 	StartMaximizedWindow     bool
 	DisableLigatures         bool
+	FontFeatures             []string
 	Macmeta                  bool
 	Transparent              float64
 	DrawBorder               bool
@@ -56,6 +60,13 @@ type editorConfig struct {
 	IndentGuideIgnoreFtList  []string
 	OptionsToUseGuideWidth   string
 	SmoothScroll             bool
+	AnimatedCursor           bool
+	CursorAnimationDuration  int
+	CursorAnimationEasing    string
+	CursorTrail              bool
+	DimInactiveWindows       bool
+	DimInactiveOpacity       float64
+	DimInactiveDesaturation  float64
 	DisableHorizontalScroll  bool
 	DrawBorderForFloatWindow bool
 	DrawShadowForFloatWindow bool
@@ -65,6 +76,9 @@ type editorConfig struct {
 	DiffChangePattern        int
 	ClickEffect              bool
 	BorderlessWindow         bool
+	BusyIndicator            string
+	BusyIndicatorDelay       int
+	Bell                     string
 	// ExtWildmenu            bool
 	// ExtMultigrid           bool
 }
@@ -134,8 +148,9 @@ type sideBarConfig struct {
 }
 
 type workspaceConfig struct {
-	RestoreSession bool
-	PathStyle      string
+	RestoreSession   bool
+	PathStyle        string
+	AutoSaveInterval int
 }
 
 type fileExploreConfig struct {
@@ -260,6 +275,40 @@ func newConfig(home string) (string, gonvimConfig) {
 	if config.Workspace.PathStyle == "" {
 		config.Workspace.PathStyle = "minimum"
 	}
+	if config.Workspace.AutoSaveInterval < 0 {
+		config.Workspace.AutoSaveInterval = 0
+	}
+
+	switch config.Editor.BusyIndicator {
+	case "none", "statusline", "title":
+	default:
+		config.Editor.BusyIndicator = "none"
+	}
+	if config.Editor.BusyIndicatorDelay < 0 {
+		config.Editor.BusyIndicatorDelay = 0
+	}
+
+	if config.Editor.CursorAnimationDuration <= 0 {
+		config.Editor.CursorAnimationDuration = 80
+	}
+	switch config.Editor.CursorAnimationEasing {
+	case "linear", "outquad", "outcubic", "outquart", "outexpo":
+	default:
+		config.Editor.CursorAnimationEasing = "outcubic"
+	}
+
+	if config.Editor.DimInactiveOpacity < 0.0 || config.Editor.DimInactiveOpacity > 1.0 {
+		config.Editor.DimInactiveOpacity = 0.3
+	}
+	if config.Editor.DimInactiveDesaturation < 0.0 || config.Editor.DimInactiveDesaturation > 1.0 {
+		config.Editor.DimInactiveDesaturation = 0.5
+	}
+
+	switch config.Editor.Bell {
+	case "none", "visual", "audible", "notify":
+	default:
+		config.Editor.Bell = "none"
+	}
 
 	if config.MiniMap.Width == 0 || config.MiniMap.Width >= 250 {
 		config.MiniMap.Width = 100
@@ -318,12 +367,33 @@ func (c *gonvimConfig) init() {
 	c.Editor.SmoothScroll = false
 	c.Editor.DisableHorizontalScroll = true
 
+	// Animate the cursor movement by grid_cursor_goto for the duration (ms).
+	// The easing is one of linear, outquad, outcubic, outquart and outexpo.
+	// If CursorTrail is true, long jumps leave a fading trail.
+	c.Editor.AnimatedCursor = false
+	c.Editor.CursorAnimationDuration = 80
+	c.Editor.CursorAnimationEasing = "outcubic"
+	c.Editor.CursorTrail = false
+
+	// Dim the windows other than the current one and draw the accent border
+	// around the current one
+	c.Editor.DimInactiveWindows = false
+	c.Editor.DimInactiveOpacity = 0.3
+	c.Editor.DimInactiveDesaturation = 0.5
+
 	c.Editor.DrawBorderForFloatWindow = false
 	c.Editor.DrawShadowForFloatWindow = false
 
 	c.Editor.DesktopNotifications = false
 	c.Editor.ClickEffect = false
 
+	// Show a spinner when neovim stays busy for longer than the delay (ms)
+	c.Editor.BusyIndicator = "none"
+	c.Editor.BusyIndicatorDelay = 500
+
+	// How to notify the bell and visual_bell events; none, visual, audible or notify
+	c.Editor.Bell = "none"
+
 	// replace diff color drawing pattern
 	c.Editor.DiffAddPattern = 1
 	c.Editor.DiffDeletePattern = 1
@@ -391,4 +461,5 @@ func (c *gonvimConfig) init() {
 
 	c.Workspace.PathStyle = "minimum"
 	c.Workspace.RestoreSession = false
+	c.Workspace.AutoSaveInterval = 60
 }
@@ -3,8 +3,9 @@ package editor
 import (
 	"math"
 	"runtime"
+	"strings"
+	"time"
 
-	"github.com/akiyosi/goneovim/util"
 	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
 	"github.com/therecipe/qt/widgets"
@@ -26,6 +27,7 @@ type Cursor struct {
 	bufferGridid     int
 	shift            int
 	isShut           bool
+	isBusy           bool
 	timer            *core.QTimer
 	isTextDraw       bool
 	fg               *RGBA
@@ -45,8 +47,32 @@ type Cursor struct {
 	blinkWait            int
 	blinkOn              int
 	blinkOff             int
+
+	// animated cursor, see AnimatedCursor
+	animation   *core.QVariantAnimation
+	trail       *widgets.QWidget
+	isGoto      bool
+	isBurst     bool
+	lastGoto    time.Time
+	movedGridid int
+	toX         int
+	toY         int
+	headX       float64
+	headY       float64
+	tailX       float64
+	tailY       float64
 }
 
+const (
+	// cursorTypingInterval is the interval of the cursor movements in insert
+	// mode which are regarded as a typing burst and are not animated
+	cursorTypingInterval = 200 * time.Millisecond
+
+	// cursorTrailDistance is the distance in cells of the jumps which leave
+	// a trail when CursorTrail is true
+	cursorTrailDistance = 8
+)
+
 func initCursorNew() *Cursor {
 	widget := widgets.NewQWidget(nil, 0)
 	// widget := widgets.NewQLabel(nil, 0)
@@ -58,6 +84,12 @@ func initCursorNew() *Cursor {
 	}
 	widget.ConnectPaintEvent(c.paint)
 
+	trail := widgets.NewQWidget(nil, 0)
+	trail.SetAttribute(core.Qt__WA_TransparentForMouseEvents, true)
+	trail.ConnectPaintEvent(c.paintTrail)
+	trail.Hide()
+	c.trail = trail
+
 	return c
 }
 
@@ -109,10 +141,11 @@ func (c *Cursor) paint(event *gui.QPaintEvent) {
 		var image *gui.QImage
 		charCache := *c.charCache
 		imagev, err := charCache.get(HlChars{
-			text:   c.text,
-			fg:     c.fg,
-			italic: false,
-			bold:   false,
+			text:     c.text,
+			features: c.font.featureKey(),
+			fg:       c.fg,
+			italic:   false,
+			bold:     false,
 		})
 		if err != nil {
 			image = c.newCharCache(c.text, c.fg, c.normalWidth)
@@ -137,7 +170,8 @@ func (c *Cursor) paint(event *gui.QPaintEvent) {
 			p.SetFont(font.fontNew)
 		}
 		p.SetPen2(c.fg.QColor())
-		p.DrawText(
+		font.drawText(
+			p,
 			core.NewQPointF3(
 				0,
 				shift,
@@ -183,13 +217,14 @@ func (c *Cursor) newCharCache(text string, fg *RGBA, isNormalWidth bool) *gui.QI
 	// TODO
 	// Set bold, italic styles
 
-	pi.DrawText6(
+	font.drawTextInRect(
+		pi,
 		core.NewQRectF4(
 			0,
 			0,
 			width,
 			float64(font.height),
-		), text, gui.NewQTextOption2(core.Qt__AlignVCenter),
+		), text, false,
 	)
 
 	pi.DestroyQPainter()
@@ -200,10 +235,11 @@ func (c *Cursor) newCharCache(text string, fg *RGBA, isNormalWidth bool) *gui.QI
 func (c *Cursor) setCharCache(text string, fg *RGBA, image *gui.QImage) {
 	c.charCache.set(
 		HlChars{
-			text:   text,
-			fg:     c.fg,
-			italic: false,
-			bold:   false,
+			text:     text,
+			features: c.font.featureKey(),
+			fg:       c.fg,
+			italic:   false,
+			bold:     false,
 		},
 		image,
 	)
@@ -236,13 +272,40 @@ func (c *Cursor) setBlink() {
 	c.timer.SetInterval(off)
 }
 
+// setBusy hides the cursor while neovim is busy, see busy_start and busy_stop
+func (c *Cursor) setBusy(busy bool) {
+	if c.isBusy == busy {
+		return
+	}
+	c.isBusy = busy
+	if busy {
+		c.stopAnimation()
+		c.widget.Hide()
+		return
+	}
+	if c.mode != "terminal-input" {
+		c.widget.Show()
+	}
+}
+
 func (c *Cursor) move() {
-	c.widget.Move(
-		core.NewQPoint2(
-			c.x,
-			c.y,
-		),
-	)
+	isGoto := c.isGoto
+	c.isGoto = false
+	switch {
+	case c.animation != nil && c.toX == c.x && c.toY == c.y:
+		// The cursor is already moving to the position
+	case isGoto && c.shouldAnimate():
+		c.animateMove()
+	default:
+		c.stopAnimation()
+		c.widget.Move(
+			core.NewQPoint2(
+				c.x,
+				c.y,
+			),
+		)
+	}
+	c.movedGridid = c.gridid
 
 	// if c.ws.loc != nil {
 	// 	c.ws.loc.updatePos()
@@ -254,6 +317,143 @@ func (c *Cursor) move() {
 	}
 }
 
+// markGoto is called for grid_cursor_goto, the next move of the cursor is
+// animated if AnimatedCursor is true
+func (c *Cursor) markGoto() {
+	now := time.Now()
+	c.isBurst = now.Sub(c.lastGoto) < cursorTypingInterval
+	c.lastGoto = now
+	c.isGoto = true
+}
+
+// shouldAnimate returns false for the movements which should not be animated;
+// the movements to another grid, while neovim is busy and the typing bursts
+// in insert mode
+func (c *Cursor) shouldAnimate() bool {
+	if !editor.config.Editor.AnimatedCursor {
+		return false
+	}
+	if c.isBusy || c.isInPalette || c.movedGridid != c.gridid {
+		return false
+	}
+	if c.isBurst && (strings.HasPrefix(c.mode, "insert") || strings.HasPrefix(c.mode, "replace")) {
+		return false
+	}
+	pos := c.widget.Pos()
+
+	return pos.X() != c.x || pos.Y() != c.y
+}
+
+// animateMove moves the cursor from the current position to (c.x, c.y) with
+// the animation. Long jumps leave a trail if CursorTrail is true.
+func (c *Cursor) animateMove() {
+	pos := c.widget.Pos()
+	c.stopAnimation()
+
+	fromX, fromY := float64(pos.X()), float64(pos.Y())
+	toX, toY := float64(c.x), float64(c.y)
+	c.toX, c.toY = c.x, c.y
+
+	isTrail := false
+	if editor.config.Editor.CursorTrail && c.font != nil {
+		cols := math.Abs(toX-fromX) / c.font.truewidth
+		rows := math.Abs(toY-fromY) / float64(c.font.lineHeight)
+		isTrail = math.Max(cols, rows) >= cursorTrailDistance
+	}
+	if isTrail {
+		parent := c.widget.ParentWidget()
+		if parent != nil {
+			c.trail.SetParent(parent)
+			c.trail.Resize2(parent.Width(), parent.Height())
+			c.trail.Move2(0, 0)
+			c.trail.StackUnder(c.widget)
+			c.trail.Show()
+		} else {
+			isTrail = false
+		}
+	}
+
+	a := core.NewQVariantAnimation(c.widget)
+	a.ConnectValueChanged(func(value *core.QVariant) {
+		ok := false
+		v := value.ToDouble(&ok)
+		if !ok {
+			return
+		}
+		c.headX = fromX + (toX-fromX)*v
+		c.headY = fromY + (toY-fromY)*v
+		c.widget.Move2(int(math.Round(c.headX)), int(math.Round(c.headY)))
+		if isTrail {
+			// The tail follows the head with a delay
+			c.tailX = fromX + (toX-fromX)*v*v
+			c.tailY = fromY + (toY-fromY)*v*v
+			c.trail.Update()
+		}
+	})
+	a.ConnectFinished(func() {
+		c.animation = nil
+		c.trail.Hide()
+		c.widget.Move2(c.toX, c.toY)
+	})
+	a.SetDuration(editor.config.Editor.CursorAnimationDuration)
+	a.SetStartValue(core.NewQVariant10(0))
+	a.SetEndValue(core.NewQVariant10(1))
+	a.SetEasingCurve(core.NewQEasingCurve(cursorEasing()))
+	c.animation = a
+	a.Start(core.QAbstractAnimation__DeletionPolicy(core.QAbstractAnimation__DeleteWhenStopped))
+}
+
+// stopAnimation stops the animation of the cursor movement if it is running
+func (c *Cursor) stopAnimation() {
+	if c.animation == nil {
+		return
+	}
+	a := c.animation
+	c.animation = nil
+	a.Stop()
+	c.trail.Hide()
+}
+
+func cursorEasing() core.QEasingCurve__Type {
+	switch editor.config.Editor.CursorAnimationEasing {
+	case "linear":
+		return core.QEasingCurve__Linear
+	case "outquad":
+		return core.QEasingCurve__OutQuad
+	case "outquart":
+		return core.QEasingCurve__OutQuart
+	case "outexpo":
+		return core.QEasingCurve__OutExpo
+	default:
+		return core.QEasingCurve__OutCubic
+	}
+}
+
+// paintTrail paints the trail from the tail to the head of the moving cursor
+func (c *Cursor) paintTrail(event *gui.QPaintEvent) {
+	if c.animation == nil || c.ws == nil {
+		return
+	}
+	color := c.bg
+	if color == nil {
+		color = c.ws.foreground
+	}
+	if color == nil {
+		return
+	}
+
+	p := gui.NewQPainter2(c.trail)
+	p.SetRenderHint(gui.QPainter__Antialiasing, true)
+	pen := gui.NewQPen3(newRGBA(color.R, color.G, color.B, 0.35).QColor())
+	pen.SetWidthF(float64(c.height))
+	pen.SetCapStyle(core.Qt__RoundCap)
+	p.SetPen(pen)
+	w := float64(c.width) / 2.0
+	h := float64(c.height) / 2.0
+	p.DrawLine(core.NewQLineF3(c.tailX+w, c.tailY+h, c.headX+w, c.headY+h))
+	p.DestroyQPainter()
+}
+
 func (c *Cursor) updateFont(font *Font) {
 	c.font = font
 }
@@ -263,21 +463,24 @@ func (c *Cursor) updateCursorShape() {
 		return
 	}
 
-	if c.modeInfoModeIdx != c.modeIdx || c.isNeedUpdateModeInfo {
+	// mode_idx of mode_change may not be defined by mode_info_set
+	isModeInfoSet := c.modeIdx >= 0 && c.modeIdx < len(c.ws.modeInfo)
+	if (c.modeInfoModeIdx != c.modeIdx || c.isNeedUpdateModeInfo) && isModeInfoSet {
 		c.modeInfoModeIdx = c.modeIdx
 
 		modeInfo := c.ws.modeInfo[c.modeIdx]
-		attrIdITF, ok := modeInfo["attr_id"]
-		if ok {
-			c.currAttrId = util.ReflectToInt(attrIdITF)
+		if modeInfo.attrID >= 0 {
+			c.currAttrId = modeInfo.attrID
 		}
 		var bg, fg *RGBA
-		if c.currAttrId == 0 {
-			fg = c.ws.screen.hlAttrDef[0].background
-			bg = c.ws.screen.hlAttrDef[0].foreground
-		} else {
-			fg = c.ws.screen.hlAttrDef[c.currAttrId].fg()
-			bg = c.ws.screen.hlAttrDef[c.currAttrId].bg()
+		if hl, ok := c.ws.screen.hlAttrDef[c.currAttrId]; ok {
+			if c.currAttrId == 0 {
+				fg = hl.background
+				bg = hl.foreground
+			} else {
+				fg = hl.fg()
+				bg = hl.bg()
+			}
 		}
 		if fg == nil {
 			fg = c.ws.foreground
@@ -288,28 +491,17 @@ func (c *Cursor) updateCursorShape() {
 		c.fg = fg
 		c.bg = bg
 
-		c.cursorShape = "block"
-		cursorShapeITF, ok := modeInfo["cursor_shape"]
-		if ok {
-			c.cursorShape = cursorShapeITF.(string)
-		}
-		c.cellPercentage = 100
-		cellPercentageITF, ok := modeInfo["cell_percentage"]
-		if ok {
-			c.cellPercentage = util.ReflectToInt(cellPercentageITF)
-		}
+		c.cursorShape = modeInfo.cursorShape
+		c.cellPercentage = modeInfo.cellPercentage
 
-		blinkWaitITF, ok := modeInfo["blinkwait"]
-		if ok {
-			c.blinkWait = util.ReflectToInt(blinkWaitITF)
+		if modeInfo.blinkwait >= 0 {
+			c.blinkWait = modeInfo.blinkwait
 		}
-		blinkOnITF, ok := modeInfo["blinkon"]
-		if ok {
-			c.blinkOn = util.ReflectToInt(blinkOnITF)
+		if modeInfo.blinkon >= 0 {
+			c.blinkOn = modeInfo.blinkon
 		}
-		blinkOffITF, ok := modeInfo["blinkoff"]
-		if ok {
-			c.blinkOff = util.ReflectToInt(blinkOffITF)
+		if modeInfo.blinkoff >= 0 {
+			c.blinkOff = modeInfo.blinkoff
 		}
 
 		c.setBlink()
@@ -369,7 +561,7 @@ func (c *Cursor) update() {
 		if c.mode == "terminal-input" {
 			c.widget.Hide()
 			return
-		} else {
+		} else if !c.isBusy {
 			c.widget.Show()
 		}
 	}
@@ -385,17 +577,18 @@ func (c *Cursor) update() {
 	row := c.ws.screen.cursor[0]
 	col := c.ws.screen.cursor[1]
 
-	if row >= len(win.content) ||
-		col >= len(win.content[0]) ||
-		win.content[row][col] == nil ||
-		win.content[row][col].char == "" {
+	win.s.modelMutex.RLock()
+	cell := win.content.Cell(row, col)
+	if cell == nil ||
+		cell.Text == "" {
 		// c.ws.palette.widget.IsVisible() {
 		c.text = ""
 		c.normalWidth = true
 	} else {
-		c.text = win.content[row][col].char
-		c.normalWidth = win.content[row][col].normalWidth
+		c.text = cell.Text
+		c.normalWidth = cell.NormalWidth
 	}
+	win.s.modelMutex.RUnlock()
 	if c.ws.palette != nil {
 		if c.isInPalette {
 			c.text = ""
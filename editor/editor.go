@@ -26,7 +26,6 @@ var editor *Editor
 
 const (
 	GONEOVIMVERSION = "v0.4.11"
-	WORKSPACELEN    = 10
 )
 
 type editorSignal struct {
@@ -83,6 +82,9 @@ type Options struct {
 	Nvim   string `long:"nvim" description:"Excutable nvim path to attach [e.g. --nvim=/path/to/nvim]"`
 
 	Debug string `long:"debug" description:"Run debug mode with debug.log(default) file [e.g. --debug=/path/to/my-debug.log]" optional:"yes" optional-value:"debug.log"`
+
+	Record string `long:"record" description:"Record the redraw and Gui notifications from nvim to the file [e.g. --record=/path/to/goneovim.rec]"`
+	Replay string `long:"replay" description:"Replay the recorded file without starting nvim [e.g. --replay=/path/to/goneovim.rec]"`
 }
 
 // Editor is the editor
@@ -146,6 +148,18 @@ type Editor struct {
 
 	startuptime int64
 	file        *os.File
+
+	recorder  *Recorder
+	recording *Recording
+
+	session *SessionManifest
+
+	autosaveTimer   *core.QTimer
+	autosaveMutex   sync.Mutex
+	autosaveWait    sync.WaitGroup
+	autosaving      bool
+	autosaveStopped bool
+	autosaveOwner   bool
 }
 
 func (hl *Highlight) copy() Highlight {
@@ -212,6 +226,34 @@ func InitEditor(options Options, args []string) {
 	e.configDir = configDir
 	e.putLog("reading config")
 
+	// record or replay nvim notifications
+	if e.opts.Replay != "" {
+		e.recording, err = loadRecording(e.opts.Replay)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		err = e.recording.applyAttachOption()
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		e.putLog("loading the recording")
+	} else if e.opts.Record != "" {
+		e.recorder, err = newRecorder(e.opts.Record)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		e.putLog("start recording")
+	}
+
+	// the workspaces and the window state of the previous session
+	e.loadSession()
+
 	// application
 	e.putLog("start    generating the application")
 	core.QCoreApplication_SetAttribute(core.Qt__AA_EnableHighDpiScaling, true)
@@ -263,6 +305,7 @@ func InitEditor(options Options, args []string) {
 	e.showWindow()
 	e.setWindowSizeFromOpts()
 	e.setWindowOptions()
+	e.restoreWindowGeometry()
 	e.putLog("finished preparing the application window.")
 
 	// window layout
@@ -287,6 +330,9 @@ func InitEditor(options Options, args []string) {
 
 	e.connectAppSignals()
 
+	e.initAutosave()
+	e.putLog("initializing session autosave")
+
 	e.signal.ConnectSidebarSignal(func() {
 		if e.side != nil {
 			return
@@ -392,23 +438,10 @@ func (e *Editor) newSplitter() {
 
 func (e *Editor) initWorkspaces() {
 	e.workspaces = []*Workspace{}
-	sessionExists := false
-	if e.config.Workspace.RestoreSession {
-		for i := 0; i <= WORKSPACELEN; i++ {
-			path := filepath.Join(e.configDir, "sessions", strconv.Itoa(i)+".vim")
-			_, err := os.Stat(path)
-			if err != nil {
-				break
-			}
-			sessionExists = true
-			ws, err := newWorkspace(path)
-			if err != nil {
-				break
-			}
-			e.workspaces = append(e.workspaces, ws)
-		}
+	if e.session != nil {
+		e.workspaces, e.active = e.restoreWorkspaces(filepath.Join(e.configDir, "sessions"), e.session)
 	}
-	if !sessionExists {
+	if len(e.workspaces) == 0 {
 		ws, err := newWorkspace("")
 		if err != nil {
 			return
@@ -739,9 +772,6 @@ func (e *Editor) copyClipBoard() {
 }
 
 func (e *Editor) workspaceNew() {
-	if len(e.workspaces) == 10 {
-		return
-	}
 	editor.isSetGuiColor = false
 	ws, err := newWorkspace("")
 	if err != nil {
@@ -762,6 +792,7 @@ func (e *Editor) workspaceSwitch(index int) {
 	}
 	e.active = index
 	e.workspaceUpdate()
+	e.autosaveSession()
 }
 
 func (e *Editor) workspaceNext() {
@@ -770,6 +801,7 @@ func (e *Editor) workspaceNext() {
 		e.active = 0
 	}
 	e.workspaceUpdate()
+	e.autosaveSession()
 }
 
 func (e *Editor) workspacePrevious() {
@@ -778,6 +810,121 @@ func (e *Editor) workspacePrevious() {
 		e.active = len(e.workspaces) - 1
 	}
 	e.workspaceUpdate()
+	e.autosaveSession()
+}
+
+// workspaceClose closes the workspace of index, which counts from 1 like
+// workspaceSwitch. The workspace is removed when its nvim exits.
+func (e *Editor) workspaceClose(index int) {
+	index--
+	if index < 0 || index >= len(e.workspaces) {
+		return
+	}
+	w := e.workspaces[index]
+	if e.recording != nil {
+		return
+	}
+	if w.uiRemoteAttached {
+		// Leave the remote nvim running
+		go func() {
+			w.nvim.DetachUI()
+			w.nvim.Close()
+		}()
+		return
+	}
+	go w.nvim.Command("confirm qa")
+}
+
+// workspaceRename sets the name of the workspace shown in the sidebar.
+// The empty name shows the working directory again.
+func (e *Editor) workspaceRename(w *Workspace, name string) {
+	w.name = name
+	e.workspaceUpdate()
+}
+
+// workspaceMove moves the workspace to index, which counts from 1
+func (e *Editor) workspaceMove(w *Workspace, index int) {
+	index--
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(e.workspaces) {
+		index = len(e.workspaces) - 1
+	}
+	e.moveWorkspace(w.getNum(), index)
+}
+
+// moveWorkspace moves the workspace at from to to, keeping the active
+// workspace active
+func (e *Editor) moveWorkspace(from, to int) {
+	if from == to {
+		return
+	}
+	if from < 0 || from >= len(e.workspaces) || to < 0 || to >= len(e.workspaces) {
+		return
+	}
+	order := []int{}
+	for i := range e.workspaces {
+		if i != from {
+			order = append(order, i)
+		}
+	}
+	order = append(order[:to], append([]int{from}, order[to:]...)...)
+	e.reorderWorkspaces(order, e.workspaces[e.active])
+}
+
+// workspaceRemove removes the workspace whose nvim has exited
+func (e *Editor) workspaceRemove(w *Workspace) {
+	index := -1
+	order := []int{}
+	for i, ws := range e.workspaces {
+		if ws == w {
+			index = i
+		} else {
+			order = append(order, i)
+		}
+	}
+	if index < 0 {
+		return
+	}
+	if w.busy != nil {
+		w.busy.destroy()
+	}
+	if len(order) == 0 {
+		e.close()
+		return
+	}
+
+	active := e.workspaces[e.active]
+	if active == w {
+		if index > 0 {
+			active = e.workspaces[index-1]
+		} else {
+			active = e.workspaces[1]
+		}
+	}
+	w.hide()
+	e.reorderWorkspaces(order, active)
+}
+
+// reorderWorkspaces rearranges the workspaces so that the i-th workspace is
+// the order[i]-th one of the current workspaces
+func (e *Editor) reorderWorkspaces(order []int, active *Workspace) {
+	workspaces := make([]*Workspace, len(order))
+	for i, j := range order {
+		workspaces[i] = e.workspaces[j]
+	}
+	e.workspaces = workspaces
+	e.active = 0
+	for i, ws := range workspaces {
+		if ws == active {
+			e.active = i
+		}
+	}
+	if e.side != nil {
+		e.side.rebind(order)
+	}
+	e.workspaceUpdate()
 }
 
 func (e *Editor) workspaceUpdate() {
@@ -791,9 +938,13 @@ func (e *Editor) workspaceUpdate() {
 			ws.hide()
 		}
 	}
+	if e.active < len(e.workspaces) && e.workspaces[e.active].busy != nil {
+		e.workspaces[e.active].busy.updateTitle()
+	}
+	e.side.ensureItems(len(e.workspaces))
 	for i := 0; i < len(e.side.items) && i < len(e.workspaces); i++ {
 		e.side.items[i].setSideItemLabel(i)
-		e.side.items[i].setText(e.workspaces[i].cwdlabel)
+		e.side.items[i].setText(e.workspaces[i].sideLabel())
 		e.side.items[i].show()
 	}
 	for i := len(e.workspaces); i < len(e.side.items); i++ {
@@ -805,13 +956,6 @@ func (e *Editor) keyRelease(event *gui.QKeyEvent) {
 	if !e.isKeyAutoRepeating {
 		return
 	}
-	ws := e.workspaces[e.active]
-	win, ok := ws.screen.getWindow(ws.cursor.gridid)
-	if !ok {
-		return
-	}
-	win.snapshots[1] = win.snapshots[0]
-	win.snapshots[0] = win.Grab(win.Rect())
 	e.isKeyAutoRepeating = false
 }
 
@@ -1055,9 +1199,21 @@ func (e *Editor) close() {
 }
 
 func (e *Editor) cleanup() {
+	if e.recorder != nil {
+		e.recorder.close()
+	}
+
+	// The replay does not have the nvim sessions
+	if e.recording != nil {
+		return
+	}
+
+	// Wait for the autosave in progress, so that the autosave does not
+	// remain after the clean quit
+	e.stopAutosave()
+
 	sessions := filepath.Join(e.configDir, "sessions")
-	os.RemoveAll(sessions)
-	os.MkdirAll(sessions, 0755)
+	e.clearSessions(sessions)
 
 	select {
 	case <-e.stop:
@@ -1065,10 +1221,5 @@ func (e *Editor) cleanup() {
 	default:
 	}
 
-	for i, ws := range e.workspaces {
-		sessionPath := filepath.Join(sessions, strconv.Itoa(i)+".vim")
-		fmt.Println(sessionPath)
-		fmt.Println(ws.nvim.Command("mksession " + sessionPath))
-		fmt.Println("mksession finished")
-	}
+	e.saveSession(sessions)
 }
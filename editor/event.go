@@ -0,0 +1,1064 @@
+package editor
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/akiyosi/goneovim/grid"
+	"github.com/akiyosi/goneovim/util"
+	"github.com/neovim/go-client/nvim"
+)
+
+// argKind is the expected type of a field of an event
+type argKind int
+
+const (
+	kindAny argKind = iota
+	kindInt
+	kindFloat
+	kindString
+	kindBool
+	kindArray
+	kindMap
+	kindWindow
+	kindTabpage
+)
+
+func (k argKind) String() string {
+	switch k {
+	case kindInt:
+		return "int"
+	case kindFloat:
+		return "float"
+	case kindString:
+		return "string"
+	case kindBool:
+		return "bool"
+	case kindArray:
+		return "array"
+	case kindMap:
+		return "map"
+	case kindWindow:
+		return "window"
+	case kindTabpage:
+		return "tabpage"
+	default:
+		return "any"
+	}
+}
+
+func (k argKind) match(v interface{}) bool {
+	switch k {
+	case kindInt:
+		switch v.(type) {
+		case int64, uint64, int, uint:
+			return true
+		}
+		return false
+	case kindFloat:
+		switch v.(type) {
+		case float64, float32, int64, uint64, int, uint:
+			return true
+		}
+		return false
+	case kindString:
+		_, ok := v.(string)
+		return ok
+	case kindBool:
+		_, ok := v.(bool)
+		return ok
+	case kindArray:
+		_, ok := v.([]interface{})
+		return ok
+	case kindMap:
+		_, ok := v.(map[string]interface{})
+		return ok
+	case kindWindow:
+		_, ok := v.(nvim.Window)
+		return ok
+	case kindTabpage:
+		_, ok := v.(nvim.Tabpage)
+		return ok
+	default:
+		return true
+	}
+}
+
+// redrawSchemas is the leading fields of the argument tuples of the redraw
+// events handled by goneovim. The fields appended by newer versions of
+// neovim are allowed. The events without arguments are not listed.
+var redrawSchemas = map[string][]argKind{
+	"set_title":            {kindString},
+	"mode_info_set":        {kindBool, kindArray},
+	"option_set":           {kindString, kindAny},
+	"mode_change":          {kindString, kindInt},
+	"grid_resize":          {kindInt, kindInt, kindInt},
+	"default_colors_set":   {kindInt, kindInt, kindInt},
+	"hl_attr_define":       {kindInt, kindMap},
+	"hl_group_set":         {kindString, kindInt},
+	"grid_line":            {kindInt, kindInt, kindInt, kindArray},
+	"grid_clear":           {kindInt},
+	"grid_destroy":         {kindInt},
+	"grid_cursor_goto":     {kindInt, kindInt, kindInt},
+	"grid_scroll":          {kindInt, kindInt, kindInt, kindInt, kindInt, kindInt},
+	"win_pos":              {kindInt, kindWindow, kindInt, kindInt, kindInt, kindInt},
+	"win_float_pos":        {kindInt, kindWindow, kindString, kindInt, kindFloat, kindFloat},
+	"win_external_pos":     {kindInt},
+	"win_hide":             {kindInt},
+	"win_close":            {kindInt},
+	"msg_set_pos":          {kindInt, kindInt, kindBool},
+	"win_viewport":         {kindInt, kindAny, kindInt, kindInt, kindInt, kindInt},
+	"popupmenu_show":       {kindArray, kindInt, kindInt, kindInt, kindInt},
+	"popupmenu_select":     {kindInt},
+	"tabline_update":       {kindTabpage, kindArray},
+	"cmdline_show":         {kindArray, kindInt, kindString, kindString, kindInt, kindInt},
+	"cmdline_pos":          {kindInt, kindInt},
+	"cmdline_special_char": {kindString, kindBool},
+	"cmdline_char":         {kindString},
+	"cmdline_block_show":   {kindArray},
+	"cmdline_block_append": {kindArray},
+	"msg_show":             {kindString, kindArray},
+	"msg_showmode":         {kindArray},
+	"msg_showcmd":          {kindArray},
+	"msg_ruler":            {kindArray},
+	"msg_history_show":     {kindArray},
+}
+
+// guiSchemas is the leading fields following the event name of the Gui
+// notifications which take arguments
+var guiSchemas = map[string][]argKind{
+	"gonvim_resize":             {kindString},
+	"Font":                      {kindString},
+	"Linespace":                 {kindAny},
+	"finder_pattern":            {kindString, kindInt},
+	"finder_pattern_pos":        {kindInt},
+	"finder_show_result":        {kindArray, kindInt, kindArray, kindAny, kindInt, kindInt},
+	"finder_select":             {kindInt},
+	"filer_item_add":            {kindString, kindString},
+	"filer_item_select":         {kindInt},
+	"gonvim_grid_font":          {kindString},
+	"gonvim_ligatures":          {kindAny},
+	"gonvim_font_features":      {},
+	"gonvim_font_style":         {kindString, kindString},
+	"gonvim_workspace_switch":   {kindInt},
+	"gonvim_workspace_close":    {kindString},
+	"gonvim_workspace_rename":   {kindString},
+	"gonvim_workspace_move":     {kindInt},
+	"gonvim_workspace_cwd":      {kindMap},
+	"gonvim_workspace_filepath": {kindString},
+	"gonvim_optionset":          {kindString},
+	"gonvim_bufenter":           {kindInt, kindInt, kindString},
+	"gonvim_winenter_filetype":  {kindString, kindInt, kindString},
+	"gonvim_textchanged":        {kindInt},
+}
+
+// hlChunk is a [attr_id, text] chunk of the cmdline and message events
+type hlChunk struct {
+	attr int
+	text string
+}
+
+// modeInfo is a mode of mode_info_set. The properties which neovim does not
+// set are -1, except for the cursor shape and the cell percentage which
+// have the defaults of neovim.
+type modeInfo struct {
+	cursorShape    string
+	cellPercentage int
+	attrID         int
+	blinkwait      int
+	blinkon        int
+	blinkoff       int
+}
+
+// modeInfoSet is a single mode_info_set event
+type modeInfoSet struct {
+	enabled bool
+	modes   []modeInfo
+}
+
+// optionSet is a single option_set event. The value is set to the field of
+// its type.
+type optionSet struct {
+	name string
+	str  string
+	num  int
+	flag bool
+}
+
+// modeChange is a single mode_change event
+type modeChange struct {
+	mode string
+	idx  int
+}
+
+// defaultColorsSet is a single default_colors_set event
+type defaultColorsSet struct {
+	fg int
+	bg int
+	sp int
+}
+
+// hlAttrDefine is a single hl_attr_define event with the parsed highlight
+type hlAttrDefine struct {
+	id int
+	hl *grid.Highlight
+}
+
+// hlGroupSet is a single hl_group_set event
+type hlGroupSet struct {
+	name string
+	id   int
+}
+
+// gridCursorGoto is a single grid_cursor_goto event
+type gridCursorGoto struct {
+	grid gridId
+	row  int
+	col  int
+}
+
+// winPos is a single win_pos event
+type winPos struct {
+	grid gridId
+	win  nvim.Window
+	row  int
+	col  int
+}
+
+// winFloatPos is a single win_float_pos event
+type winFloatPos struct {
+	grid       gridId
+	win        nvim.Window
+	anchor     string
+	anchorGrid gridId
+	anchorRow  float64
+	anchorCol  float64
+}
+
+// msgSetPos is a single msg_set_pos event
+type msgSetPos struct {
+	grid     gridId
+	row      int
+	scrolled bool
+}
+
+// winViewport is a single win_viewport event. The lines are 0-based.
+type winViewport struct {
+	grid    gridId
+	topline int
+	botline int
+	curline int
+	curcol  int
+
+	// scrollDelta is sent since neovim 0.10
+	scrollDelta    int
+	hasScrollDelta bool
+}
+
+// popupmenuItem is an item [word, kind, menu, info] of popupmenu_show
+type popupmenuItem struct {
+	word string
+	kind string
+	menu string
+	info string
+}
+
+// popupmenuShow is a single popupmenu_show event
+type popupmenuShow struct {
+	items    []popupmenuItem
+	selected int
+	row      int
+	col      int
+	grid     gridId
+}
+
+// tabInfo is a tab of tabline_update
+type tabInfo struct {
+	tab  nvim.Tabpage
+	name string
+}
+
+// tablineUpdate is a single tabline_update event
+type tablineUpdate struct {
+	current nvim.Tabpage
+	tabs    []tabInfo
+}
+
+// cmdlineShow is a single cmdline_show event
+type cmdlineShow struct {
+	content []hlChunk
+	pos     int
+	firstc  string
+	prompt  string
+	indent  int
+	level   int
+}
+
+// cmdlinePos is a single cmdline_pos event
+type cmdlinePos struct {
+	pos   int
+	level int
+}
+
+// cmdlineSpecialChar is a single cmdline_special_char event
+type cmdlineSpecialChar struct {
+	c     string
+	shift bool
+}
+
+// cmdlineHide is a single cmdline_hide event. level is -1 if neovim does not
+// send it, since cmdline_hide has the level since neovim 0.10.
+type cmdlineHide struct {
+	level int
+}
+
+// msgShow is a single msg_show event or an entry of msg_history_show
+type msgShow struct {
+	kind        string
+	content     []hlChunk
+	replaceLast bool
+}
+
+// validateFields checks that fields has at least the fields of schema
+// with the expected types
+func validateFields(fields []interface{}, schema []argKind) error {
+	if len(fields) < len(schema) {
+		return fmt.Errorf("expected at least %d fields, got %d", len(schema), len(fields))
+	}
+	for i, kind := range schema {
+		if !kind.match(fields[i]) {
+			return fmt.Errorf("field %d: expected %s, got %T", i, kind, fields[i])
+		}
+	}
+
+	return nil
+}
+
+// validateTuples checks that each argument of a redraw event is a tuple
+// which matches schema, and returns the tuples. The malformed arguments are
+// skipped, and the errors of them are returned with the tuples.
+func validateTuples(args []interface{}, schema []argKind) ([][]interface{}, []error) {
+	tuples := make([][]interface{}, 0, len(args))
+	var skipped []error
+	for i, arg := range args {
+		tuple, ok := arg.([]interface{})
+		if !ok {
+			skipped = append(skipped, fmt.Errorf("argument %d: expected array, got %T", i, arg))
+			continue
+		}
+		if err := validateFields(tuple, schema); err != nil {
+			skipped = append(skipped, fmt.Errorf("argument %d: %s", i, err))
+			continue
+		}
+		tuples = append(tuples, tuple)
+	}
+
+	return tuples, skipped
+}
+
+// argsLen returns the number of the decoded arguments of an event
+func argsLen(args interface{}) int {
+	v := reflect.ValueOf(args)
+	if v.Kind() != reflect.Slice {
+		return 0
+	}
+
+	return v.Len()
+}
+
+// reflectToNumber converts the field validated as kindFloat to float64
+func reflectToNumber(v interface{}) float64 {
+	if kindInt.match(v) {
+		return float64(util.ReflectToInt(v))
+	}
+
+	return util.ReflectToFloat(v)
+}
+
+// decodeRedrawEvent decodes an update of the redraw notification into the
+// typed arguments of the event. It returns an error instead of panicking when
+// the update does not have the shape of the event. The malformed arguments
+// are skipped and recorded in the skipped of the event, so that the rest of
+// the batch is still applied. It returns an error if all of them are
+// malformed.
+func decodeRedrawEvent(update []interface{}) (redrawEvent, error) {
+	if len(update) == 0 {
+		return redrawEvent{}, fmt.Errorf("empty redraw event")
+	}
+	name, ok := update[0].(string)
+	if !ok {
+		return redrawEvent{}, fmt.Errorf("invalid redraw event name: %v", update[0])
+	}
+	tuples, skipped := validateTuples(update[1:], redrawSchemas[name])
+	if _, ok := redrawSchemas[name]; ok && len(tuples) == 0 {
+		if len(skipped) > 0 {
+			return redrawEvent{}, fmt.Errorf("%s: %s", name, skipped[0])
+		}
+		return redrawEvent{}, fmt.Errorf("%s: no arguments", name)
+	}
+	args, errs := decodeRedrawArgs(name, tuples)
+	if len(errs) > 0 && argsLen(args) == 0 {
+		return redrawEvent{}, fmt.Errorf("%s: %s", name, errs[0])
+	}
+	skipped = append(skipped, errs...)
+	for i, err := range skipped {
+		skipped[i] = fmt.Errorf("%s: %s", name, err)
+	}
+
+	return redrawEvent{
+		name:    name,
+		args:    args,
+		skipped: skipped,
+	}, nil
+}
+
+// decodeRedrawArgs decodes the tuples of the event validated against
+// redrawSchemas. The events without arguments and the events which goneovim
+// does not handle have no arguments. The tuples which fail to be decoded are
+// skipped, and the errors of them are returned with the arguments.
+func decodeRedrawArgs(name string, tuples [][]interface{}) (interface{}, []error) {
+	switch name {
+	case "set_title", "cmdline_char":
+		strs := make([]string, len(tuples))
+		for i, t := range tuples {
+			strs[i] = t[0].(string)
+		}
+		return strs, nil
+	case "grid_clear", "grid_destroy", "win_external_pos", "win_hide", "win_close":
+		grids := make([]gridId, len(tuples))
+		for i, t := range tuples {
+			grids[i] = util.ReflectToInt(t[0])
+		}
+		return grids, nil
+	case "popupmenu_select":
+		selected := make([]int, len(tuples))
+		for i, t := range tuples {
+			selected[i] = util.ReflectToInt(t[0])
+		}
+		return selected, nil
+	case "mode_info_set":
+		return decodeModeInfoSet(tuples)
+	case "option_set":
+		return decodeOptionSet(tuples), nil
+	case "mode_change":
+		changes := make([]modeChange, len(tuples))
+		for i, t := range tuples {
+			changes[i] = modeChange{
+				mode: t[0].(string),
+				idx:  util.ReflectToInt(t[1]),
+			}
+		}
+		return changes, nil
+	case "default_colors_set":
+		colors := make([]defaultColorsSet, len(tuples))
+		for i, t := range tuples {
+			colors[i] = defaultColorsSet{
+				fg: util.ReflectToInt(t[0]),
+				bg: util.ReflectToInt(t[1]),
+				sp: util.ReflectToInt(t[2]),
+			}
+		}
+		return colors, nil
+	case "hl_attr_define":
+		defines := make([]hlAttrDefine, len(tuples))
+		for i, t := range tuples {
+			defines[i] = hlAttrDefine{
+				id: util.ReflectToInt(t[0]),
+				hl: grid.ParseHighlight(t),
+			}
+		}
+		return defines, nil
+	case "hl_group_set":
+		groups := make([]hlGroupSet, len(tuples))
+		for i, t := range tuples {
+			groups[i] = hlGroupSet{
+				name: t[0].(string),
+				id:   util.ReflectToInt(t[1]),
+			}
+		}
+		return groups, nil
+	case "grid_resize":
+		return decodeGridResize(tuples)
+	case "grid_line":
+		return decodeGridLine(tuples), nil
+	case "grid_scroll":
+		return decodeGridScroll(tuples), nil
+	case "grid_cursor_goto":
+		gotos := make([]gridCursorGoto, len(tuples))
+		for i, t := range tuples {
+			gotos[i] = gridCursorGoto{
+				grid: util.ReflectToInt(t[0]),
+				row:  util.ReflectToInt(t[1]),
+				col:  util.ReflectToInt(t[2]),
+			}
+		}
+		return gotos, nil
+	case "win_pos":
+		positions := make([]winPos, len(tuples))
+		for i, t := range tuples {
+			positions[i] = winPos{
+				grid: util.ReflectToInt(t[0]),
+				win:  t[1].(nvim.Window),
+				row:  util.ReflectToInt(t[2]),
+				col:  util.ReflectToInt(t[3]),
+			}
+		}
+		return positions, nil
+	case "win_float_pos":
+		positions := make([]winFloatPos, len(tuples))
+		for i, t := range tuples {
+			positions[i] = winFloatPos{
+				grid:       util.ReflectToInt(t[0]),
+				win:        t[1].(nvim.Window),
+				anchor:     t[2].(string),
+				anchorGrid: util.ReflectToInt(t[3]),
+				anchorRow:  reflectToNumber(t[4]),
+				anchorCol:  reflectToNumber(t[5]),
+			}
+		}
+		return positions, nil
+	case "msg_set_pos":
+		positions := make([]msgSetPos, len(tuples))
+		for i, t := range tuples {
+			positions[i] = msgSetPos{
+				grid:     util.ReflectToInt(t[0]),
+				row:      util.ReflectToInt(t[1]),
+				scrolled: t[2].(bool),
+			}
+		}
+		return positions, nil
+	case "win_viewport":
+		return decodeWinViewport(tuples), nil
+	case "popupmenu_show":
+		return decodePopupmenuShow(tuples)
+	case "tabline_update":
+		return decodeTablineUpdate(tuples)
+	case "cmdline_show":
+		return decodeCmdlineShow(tuples)
+	case "cmdline_pos":
+		positions := make([]cmdlinePos, len(tuples))
+		for i, t := range tuples {
+			positions[i] = cmdlinePos{
+				pos:   util.ReflectToInt(t[0]),
+				level: util.ReflectToInt(t[1]),
+			}
+		}
+		return positions, nil
+	case "cmdline_special_char":
+		chars := make([]cmdlineSpecialChar, len(tuples))
+		for i, t := range tuples {
+			chars[i] = cmdlineSpecialChar{
+				c:     t[0].(string),
+				shift: t[1].(bool),
+			}
+		}
+		return chars, nil
+	case "cmdline_hide":
+		hides := make([]cmdlineHide, len(tuples))
+		for i, t := range tuples {
+			hides[i] = cmdlineHide{
+				level: -1,
+			}
+			if len(t) > 0 && kindInt.match(t[0]) {
+				hides[i].level = util.ReflectToInt(t[0])
+			}
+		}
+		return hides, nil
+	case "cmdline_block_show":
+		var lines [][]hlChunk
+		var skipped []error
+		for i, t := range tuples {
+			for j, l := range t[0].([]interface{}) {
+				line, err := decodeChunks(l)
+				if err != nil {
+					skipped = append(skipped, fmt.Errorf("argument %d: line %d: %s", i, j, err))
+					continue
+				}
+				lines = append(lines, line)
+			}
+		}
+		return lines, skipped
+	case "cmdline_block_append", "msg_showmode", "msg_showcmd", "msg_ruler":
+		lines := make([][]hlChunk, 0, len(tuples))
+		var skipped []error
+		for i, t := range tuples {
+			line, err := decodeChunks(t[0])
+			if err != nil {
+				skipped = append(skipped, fmt.Errorf("argument %d: %s", i, err))
+				continue
+			}
+			lines = append(lines, line)
+		}
+		return lines, skipped
+	case "msg_show":
+		return decodeMsgShow(tuples)
+	case "msg_history_show":
+		var entries []msgShow
+		var skipped []error
+		for i, t := range tuples {
+			items, errs := validateTuples(t[0].([]interface{}), []argKind{kindString, kindArray})
+			decoded, decodeErrs := decodeMsgShow(items)
+			for _, err := range append(errs, decodeErrs...) {
+				skipped = append(skipped, fmt.Errorf("argument %d: entry: %s", i, err))
+			}
+			entries = append(entries, decoded...)
+		}
+		return entries, skipped
+	}
+
+	return nil, nil
+}
+
+// decodeChunks decodes the [attr_id, text] chunks of the cmdline and message
+// events. neovim 0.11 appends hl_id to the chunks.
+func decodeChunks(v interface{}) ([]hlChunk, error) {
+	chunks, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected chunks, got %T", v)
+	}
+	decoded := make([]hlChunk, len(chunks))
+	for i, c := range chunks {
+		chunk, ok := c.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("chunk %d: expected array, got %T", i, c)
+		}
+		// The chunks of the old cmdline_show have no attr_id
+		if len(chunk) == 1 {
+			text, ok := chunk[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("chunk %d: expected string, got %T", i, chunk[0])
+			}
+			decoded[i] = hlChunk{text: text}
+			continue
+		}
+		if err := validateFields(chunk, []argKind{kindInt, kindString}); err != nil {
+			return nil, fmt.Errorf("chunk %d: %s", i, err)
+		}
+		decoded[i] = hlChunk{
+			attr: util.ReflectToInt(chunk[0]),
+			text: chunk[1].(string),
+		}
+	}
+
+	return decoded, nil
+}
+
+func decodeModeInfoSet(tuples [][]interface{}) ([]modeInfoSet, []error) {
+	sets := make([]modeInfoSet, 0, len(tuples))
+	var skipped []error
+	for i, t := range tuples {
+		modes, err := decodeModes(t[1].([]interface{}))
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("argument %d: %s", i, err))
+			continue
+		}
+		sets = append(sets, modeInfoSet{
+			enabled: t[0].(bool),
+			modes:   modes,
+		})
+	}
+
+	return sets, skipped
+}
+
+// decodeModes decodes the modes of mode_info_set. The index of a mode is
+// referred to by mode_change, so a malformed mode fails the whole list.
+func decodeModes(props []interface{}) ([]modeInfo, error) {
+	modes := make([]modeInfo, len(props))
+	for j, p := range props {
+		prop, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("mode %d: expected map, got %T", j, p)
+		}
+		modes[j] = decodeModeInfo(prop)
+	}
+
+	return modes, nil
+}
+
+// decodeModeInfo decodes the properties of a mode. The properties of an
+// unexpected type are ignored as if they are not set.
+func decodeModeInfo(prop map[string]interface{}) modeInfo {
+	info := modeInfo{
+		cursorShape:    "block",
+		cellPercentage: 100,
+		attrID:         -1,
+		blinkwait:      -1,
+		blinkon:        -1,
+		blinkoff:       -1,
+	}
+	if shape, ok := prop["cursor_shape"].(string); ok {
+		info.cursorShape = shape
+	}
+	for key, field := range map[string]*int{
+		"cell_percentage": &info.cellPercentage,
+		"attr_id":         &info.attrID,
+		"blinkwait":       &info.blinkwait,
+		"blinkon":         &info.blinkon,
+		"blinkoff":        &info.blinkoff,
+	} {
+		if v, ok := prop[key]; ok && kindInt.match(v) {
+			*field = util.ReflectToInt(v)
+		}
+	}
+
+	return info
+}
+
+func decodeOptionSet(tuples [][]interface{}) []optionSet {
+	options := make([]optionSet, len(tuples))
+	for i, t := range tuples {
+		option := optionSet{
+			name: t[0].(string),
+		}
+		switch v := t[1].(type) {
+		case string:
+			option.str = v
+		case bool:
+			option.flag = v
+		default:
+			option.num = util.ReflectToInt(v)
+		}
+		options[i] = option
+	}
+
+	return options
+}
+
+func decodeWinViewport(tuples [][]interface{}) []winViewport {
+	viewports := make([]winViewport, len(tuples))
+	for i, t := range tuples {
+		viewports[i] = winViewport{
+			grid:    util.ReflectToInt(t[0]),
+			topline: util.ReflectToInt(t[2]),
+			botline: util.ReflectToInt(t[3]),
+			curline: util.ReflectToInt(t[4]),
+			curcol:  util.ReflectToInt(t[5]),
+		}
+		if len(t) > 7 && kindInt.match(t[7]) {
+			viewports[i].scrollDelta = util.ReflectToInt(t[7])
+			viewports[i].hasScrollDelta = true
+		}
+	}
+
+	return viewports
+}
+
+func decodePopupmenuShow(tuples [][]interface{}) ([]popupmenuShow, []error) {
+	shows := make([]popupmenuShow, len(tuples))
+	var skipped []error
+	for i, t := range tuples {
+		items, errs := validateTuples(t[0].([]interface{}), []argKind{kindString, kindString, kindString, kindString})
+		for _, err := range errs {
+			skipped = append(skipped, fmt.Errorf("argument %d: item: %s", i, err))
+		}
+		show := popupmenuShow{
+			items:    make([]popupmenuItem, len(items)),
+			selected: util.ReflectToInt(t[1]),
+			row:      util.ReflectToInt(t[2]),
+			col:      util.ReflectToInt(t[3]),
+			grid:     util.ReflectToInt(t[4]),
+		}
+		for j, item := range items {
+			show.items[j] = popupmenuItem{
+				word: item[0].(string),
+				kind: item[1].(string),
+				menu: item[2].(string),
+				info: item[3].(string),
+			}
+		}
+		shows[i] = show
+	}
+
+	return shows, skipped
+}
+
+func decodeTablineUpdate(tuples [][]interface{}) ([]tablineUpdate, []error) {
+	updates := make([]tablineUpdate, 0, len(tuples))
+	var skipped []error
+	for i, t := range tuples {
+		tabs, err := decodeTabs(t[1].([]interface{}))
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("argument %d: %s", i, err))
+			continue
+		}
+		updates = append(updates, tablineUpdate{
+			current: t[0].(nvim.Tabpage),
+			tabs:    tabs,
+		})
+	}
+
+	return updates, skipped
+}
+
+func decodeTabs(tabs []interface{}) ([]tabInfo, error) {
+	infos := make([]tabInfo, len(tabs))
+	for j, tab := range tabs {
+		m, ok := tab.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tab %d: expected map, got %T", j, tab)
+		}
+		id, ok := m["tab"].(nvim.Tabpage)
+		if !ok {
+			return nil, fmt.Errorf("tab %d: invalid tab: %v", j, m["tab"])
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil, fmt.Errorf("tab %d: invalid name: %v", j, m["name"])
+		}
+		infos[j] = tabInfo{
+			tab:  id,
+			name: name,
+		}
+	}
+
+	return infos, nil
+}
+
+func decodeCmdlineShow(tuples [][]interface{}) ([]cmdlineShow, []error) {
+	shows := make([]cmdlineShow, 0, len(tuples))
+	var skipped []error
+	for i, t := range tuples {
+		content, err := decodeChunks(t[0])
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("argument %d: %s", i, err))
+			continue
+		}
+		shows = append(shows, cmdlineShow{
+			content: content,
+			pos:     util.ReflectToInt(t[1]),
+			firstc:  t[2].(string),
+			prompt:  t[3].(string),
+			indent:  util.ReflectToInt(t[4]),
+			level:   util.ReflectToInt(t[5]),
+		})
+	}
+
+	return shows, skipped
+}
+
+func decodeMsgShow(tuples [][]interface{}) ([]msgShow, []error) {
+	msgs := make([]msgShow, 0, len(tuples))
+	var skipped []error
+	for i, t := range tuples {
+		content, err := decodeChunks(t[1])
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("argument %d: %s", i, err))
+			continue
+		}
+		msg := msgShow{
+			kind:    t[0].(string),
+			content: content,
+		}
+		if len(t) > 2 {
+			msg.replaceLast, _ = t[2].(bool)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, skipped
+}
+
+// guiEvent is a Gui notification decoded into the typed arguments of the event
+type guiEvent struct {
+	name string
+	args interface{}
+}
+
+// fontStyleSet is the gonvim_font_style notification
+type fontStyleSet struct {
+	style   string
+	guifont string
+}
+
+// finderPattern is the finder_pattern notification
+type finderPattern struct {
+	pattern string
+	pos     int
+}
+
+// finderResult is the finder_show_result notification. match has the
+// matched positions of each item.
+type finderResult struct {
+	items      []string
+	selected   int
+	match      [][]int
+	resultType string
+	start      int
+	total      int
+}
+
+// filerItem is the filer_item_add notification
+type filerItem struct {
+	name     string
+	filetype string
+}
+
+// workspaceCwd is the v:event of DirChanged sent by gonvim_workspace_cwd
+type workspaceCwd struct {
+	cwd   string
+	scope string
+}
+
+// bufEnter is the gonvim_bufenter notification
+type bufEnter struct {
+	maxLine int
+	win     nvim.Window
+	name    string
+}
+
+// winEnterFiletype is the gonvim_winenter_filetype notification
+type winEnterFiletype struct {
+	filetype string
+	win      nvim.Window
+	name     string
+}
+
+// decodeGuiEvent decodes the Gui notification into the typed arguments of
+// the event. It returns an error instead of panicking when the notification
+// does not have the shape of the event.
+func decodeGuiEvent(updates []interface{}) (guiEvent, error) {
+	if len(updates) == 0 {
+		return guiEvent{}, fmt.Errorf("empty Gui event")
+	}
+	name, ok := updates[0].(string)
+	if !ok {
+		return guiEvent{}, fmt.Errorf("invalid Gui event name: %v", updates[0])
+	}
+	fields := updates[1:]
+	if err := validateFields(fields, guiSchemas[name]); err != nil {
+		return guiEvent{}, fmt.Errorf("%s: %s", name, err)
+	}
+	args, err := decodeGuiArgs(name, fields)
+	if err != nil {
+		return guiEvent{}, fmt.Errorf("%s: %s", name, err)
+	}
+
+	return guiEvent{
+		name: name,
+		args: args,
+	}, nil
+}
+
+// decodeGuiArgs decodes the fields of the Gui notification validated
+// against guiSchemas
+func decodeGuiArgs(name string, fields []interface{}) (interface{}, error) {
+	switch name {
+	case "gonvim_resize", "Font", "gonvim_grid_font", "gonvim_workspace_close",
+		"gonvim_workspace_rename", "gonvim_workspace_filepath", "gonvim_optionset":
+		return fields[0].(string), nil
+	case "finder_pattern_pos", "finder_select", "filer_item_select",
+		"gonvim_workspace_switch", "gonvim_workspace_move", "gonvim_textchanged":
+		return util.ReflectToInt(fields[0]), nil
+	case "Linespace":
+		// :GonvimLinespace sends the argument as a string
+		if s, ok := fields[0].(string); ok {
+			return strconv.Atoi(s)
+		}
+		if !kindInt.match(fields[0]) {
+			return nil, fmt.Errorf("expected int, got %T", fields[0])
+		}
+		return util.ReflectToInt(fields[0]), nil
+	case "gonvim_ligatures":
+		// v:true and v:false are sent as bool
+		if b, ok := fields[0].(bool); ok {
+			return b, nil
+		}
+		if !kindInt.match(fields[0]) {
+			return nil, fmt.Errorf("expected bool or int, got %T", fields[0])
+		}
+		return util.ReflectToInt(fields[0]) != 0, nil
+	case "gonvim_font_features":
+		features := make([]string, 0, len(fields))
+		for i, field := range fields {
+			feature, ok := field.(string)
+			if !ok {
+				return nil, fmt.Errorf("feature %d: expected string, got %T", i, field)
+			}
+			features = append(features, feature)
+		}
+		return features, nil
+	case "gonvim_font_style":
+		return fontStyleSet{
+			style:   fields[0].(string),
+			guifont: fields[1].(string),
+		}, nil
+	case "finder_pattern":
+		return finderPattern{
+			pattern: fields[0].(string),
+			pos:     util.ReflectToInt(fields[1]),
+		}, nil
+	case "finder_show_result":
+		return decodeFinderResult(fields)
+	case "filer_item_add":
+		return filerItem{
+			name:     fields[0].(string),
+			filetype: fields[1].(string),
+		}, nil
+	case "gonvim_workspace_cwd":
+		info := fields[0].(map[string]interface{})
+		cwd, ok := info["cwd"].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid cwd: %v", info["cwd"])
+		}
+		scope, ok := info["scope"].(string)
+		if !ok {
+			scope = "global"
+		}
+		return workspaceCwd{
+			cwd:   cwd,
+			scope: scope,
+		}, nil
+	case "gonvim_bufenter":
+		return bufEnter{
+			maxLine: util.ReflectToInt(fields[0]),
+			win:     nvim.Window(util.ReflectToInt(fields[1])),
+			name:    fields[2].(string),
+		}, nil
+	case "gonvim_winenter_filetype":
+		return winEnterFiletype{
+			filetype: fields[0].(string),
+			win:      nvim.Window(util.ReflectToInt(fields[1])),
+			name:     fields[2].(string),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func decodeFinderResult(fields []interface{}) (finderResult, error) {
+	result := finderResult{
+		selected: util.ReflectToInt(fields[1]),
+		start:    util.ReflectToInt(fields[4]),
+		total:    util.ReflectToInt(fields[5]),
+	}
+	for i, item := range fields[0].([]interface{}) {
+		text, ok := item.(string)
+		if !ok {
+			return result, fmt.Errorf("item %d: expected string, got %T", i, item)
+		}
+		result.items = append(result.items, text)
+	}
+	for i, m := range fields[2].([]interface{}) {
+		positions, ok := m.([]interface{})
+		if !ok {
+			return result, fmt.Errorf("match %d: expected array, got %T", i, m)
+		}
+		match := make([]int, len(positions))
+		for j, n := range positions {
+			if !kindInt.match(n) {
+				return result, fmt.Errorf("match %d: expected int, got %T", i, n)
+			}
+			match[j] = util.ReflectToInt(n)
+		}
+		result.match = append(result.match, match)
+	}
+	if len(result.match) < len(result.items) {
+		return result, fmt.Errorf("expected the matches of %d items, got %d", len(result.items), len(result.match))
+	}
+	// The type is nil unless the finder has it
+	result.resultType, _ = fields[3].(string)
+
+	return result, nil
+}
@@ -0,0 +1,415 @@
+package editor
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/akiyosi/goneovim/grid"
+	"github.com/neovim/go-client/nvim"
+)
+
+func TestDecodeRedrawEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  []interface{}
+		wantErr bool
+	}{
+		{
+			"grid_line",
+			[]interface{}{"grid_line", []interface{}{int64(2), int64(0), int64(3), []interface{}{[]interface{}{"a", int64(7), int64(2)}}}},
+			false,
+		},
+		{
+			"newer api with trailing fields",
+			[]interface{}{"grid_line", []interface{}{int64(2), int64(0), int64(3), []interface{}{}, true}},
+			false,
+		},
+		{
+			"no arguments",
+			[]interface{}{"flush"},
+			false,
+		},
+		{
+			"unknown event",
+			[]interface{}{"foo_bar", []interface{}{"baz"}},
+			false,
+		},
+		{
+			"empty",
+			[]interface{}{},
+			true,
+		},
+		{
+			"invalid name",
+			[]interface{}{int64(1), []interface{}{}},
+			true,
+		},
+		{
+			"argument is not a tuple",
+			[]interface{}{"grid_clear", int64(2)},
+			true,
+		},
+		{
+			"missing field",
+			[]interface{}{"grid_cursor_goto", []interface{}{int64(2), int64(0)}},
+			true,
+		},
+		{
+			"wrong type",
+			[]interface{}{"win_pos", []interface{}{int64(4), int64(1000), int64(0), int64(0), int64(80), int64(24)}},
+			true,
+		},
+		{
+			"tabline_update",
+			[]interface{}{"tabline_update", []interface{}{nvim.Tabpage(1), []interface{}{}}},
+			false,
+		},
+		{
+			"negative grid size",
+			[]interface{}{"grid_resize", []interface{}{int64(2), int64(-1), int64(3)}},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeRedrawEvent(tt.update)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeRedrawEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeRedrawArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		update []interface{}
+		want   interface{}
+	}{
+		{
+			"win_viewport without scroll delta",
+			[]interface{}{"win_viewport", []interface{}{int64(2), nvim.Window(1000), int64(0), int64(20), int64(3), int64(4)}},
+			[]winViewport{{grid: 2, topline: 0, botline: 20, curline: 3, curcol: 4}},
+		},
+		{
+			"win_viewport with scroll delta",
+			[]interface{}{"win_viewport", []interface{}{int64(2), nvim.Window(1000), int64(0), int64(20), int64(3), int64(4), int64(30), int64(-2)}},
+			[]winViewport{{grid: 2, topline: 0, botline: 20, curline: 3, curcol: 4, scrollDelta: -2, hasScrollDelta: true}},
+		},
+		{
+			"cmdline_special_char",
+			[]interface{}{"cmdline_special_char", []interface{}{"^", true, int64(1)}},
+			[]cmdlineSpecialChar{{c: "^", shift: true}},
+		},
+		{
+			"cmdline_hide without level",
+			[]interface{}{"cmdline_hide", []interface{}{}},
+			[]cmdlineHide{{level: -1}},
+		},
+		{
+			"grid_clear",
+			[]interface{}{"grid_clear", []interface{}{int64(2)}, []interface{}{int64(3)}},
+			[]gridId{2, 3},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := decodeRedrawEvent(tt.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(e.args, tt.want) {
+				t.Errorf("decodeRedrawEvent() args = %#v, want %#v", e.args, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRedrawEventSkipped(t *testing.T) {
+	tests := []struct {
+		name        string
+		update      []interface{}
+		want        interface{}
+		wantSkipped int
+	}{
+		{
+			"argument is not a tuple",
+			[]interface{}{"grid_clear", []interface{}{int64(2)}, "x", []interface{}{int64(3)}},
+			[]gridId{2, 3},
+			1,
+		},
+		{
+			"missing field",
+			[]interface{}{"grid_cursor_goto", []interface{}{int64(2), int64(0)}, []interface{}{int64(2), int64(1), int64(4)}},
+			[]gridCursorGoto{{grid: 2, row: 1, col: 4}},
+			1,
+		},
+		{
+			"negative grid size",
+			[]interface{}{"grid_resize", []interface{}{int64(2), int64(-1), int64(3)}, []interface{}{int64(3), int64(10), int64(2)}},
+			[]gridResize{{grid: 3, cols: 10, rows: 2}},
+			1,
+		},
+		{
+			"malformed chunks",
+			[]interface{}{"msg_show", []interface{}{"echo", int64(1)}, []interface{}{"echo", []interface{}{[]interface{}{int64(0), "a"}}}},
+			[]msgShow{{kind: "echo", content: []hlChunk{{text: "a"}}}},
+			1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := decodeRedrawEvent(tt.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(e.args, tt.want) {
+				t.Errorf("decodeRedrawEvent() args = %#v, want %#v", e.args, tt.want)
+			}
+			if len(e.skipped) != tt.wantSkipped {
+				t.Errorf("decodeRedrawEvent() skipped = %v, want %d errors", e.skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestDecodeGuiEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"ligatures by v:true", []interface{}{"gonvim_ligatures", true}, true, false},
+		{"ligatures by 0", []interface{}{"gonvim_ligatures", int64(0)}, false, false},
+		{"ligatures by string", []interface{}{"gonvim_ligatures", "on"}, nil, true},
+		{"font features", []interface{}{"gonvim_font_features", "ss01", "-calt"}, []string{"ss01", "-calt"}, false},
+		{"no font features", []interface{}{"gonvim_font_features"}, []string{}, false},
+		{"font feature is not a string", []interface{}{"gonvim_font_features", int64(1)}, nil, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := decodeGuiEvent(tt.updates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeGuiEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(e.args, tt.want) {
+				t.Errorf("decodeGuiEvent() args = %#v, want %#v", e.args, tt.want)
+			}
+		})
+	}
+}
+
+// fuzzInput builds the msgpack-rpc values from the input of the fuzz tests.
+// The exhausted input is read as zeros so that the values keep their shape.
+type fuzzInput struct {
+	data []byte
+}
+
+func (in *fuzzInput) byte() byte {
+	if len(in.data) == 0 {
+		return 0
+	}
+	b := in.data[0]
+	in.data = in.data[1:]
+	return b
+}
+
+func (in *fuzzInput) int() int64 {
+	return int64(int8(in.byte()))
+}
+
+func (in *fuzzInput) string() string {
+	return []string{"", "a", "漢", " ", "grid_line", "\n"}[int(in.byte())%6]
+}
+
+// value returns a value of any type which can be sent by msgpack-rpc
+func (in *fuzzInput) value(depth int) interface{} {
+	n := 11
+	if depth > 3 {
+		n = 8
+	}
+	switch int(in.byte()) % n {
+	case 0:
+		return nil
+	case 1:
+		return in.int()
+	case 2:
+		return uint64(in.byte())
+	case 3:
+		return float64(in.int()) / 4
+	case 4:
+		return in.string()
+	case 5:
+		return in.byte()%2 == 0
+	case 6:
+		return nvim.Window(1000 + int(in.byte())%3)
+	case 7:
+		return nvim.Tabpage(in.byte() % 3)
+	case 8:
+		m := map[string]interface{}{}
+		for i := 0; i < int(in.byte())%4; i++ {
+			m[in.string()] = in.value(depth + 1)
+		}
+		return m
+	case 9:
+		// The cell of grid_line
+		return []interface{}{in.string(), in.int(), in.int()}
+	default:
+		a := make([]interface{}, int(in.byte())%6)
+		for i := range a {
+			a[i] = in.value(depth + 1)
+		}
+		return a
+	}
+}
+
+// tuple returns a tuple of the shape of the schema. The shape is broken when
+// the input has 0xff in the place of a field or of the tuple length.
+func (in *fuzzInput) tuple(schema []argKind) []interface{} {
+	tuple := make([]interface{}, 0, len(schema)+1)
+	for _, kind := range schema {
+		if in.byte() == 0xff {
+			tuple = append(tuple, in.value(0))
+			continue
+		}
+		var v interface{}
+		switch kind {
+		case kindInt:
+			v = in.int()
+		case kindFloat:
+			v = float64(in.int()) / 4
+		case kindString:
+			v = in.string()
+		case kindBool:
+			v = in.byte()%2 == 0
+		case kindArray:
+			a := make([]interface{}, int(in.byte())%6)
+			for i := range a {
+				a[i] = in.value(1)
+			}
+			v = a
+		case kindMap:
+			v = in.value(3)
+			if _, ok := v.(map[string]interface{}); !ok {
+				v = map[string]interface{}{}
+			}
+		case kindWindow:
+			v = nvim.Window(1000 + int(in.byte())%3)
+		case kindTabpage:
+			v = nvim.Tabpage(in.byte() % 3)
+		default:
+			v = in.value(0)
+		}
+		tuple = append(tuple, v)
+	}
+	switch in.byte() {
+	case 0xfe:
+		tuple = tuple[:len(tuple)/2]
+	case 0xff:
+		tuple = append(tuple, in.value(0))
+	}
+
+	return tuple
+}
+
+func sortedNames(schemas map[string][]argKind, extra ...string) []string {
+	names := make([]string, 0, len(schemas)+len(extra))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, extra...)
+}
+
+// fuzzEvent returns the fuzz input of the event followed by the fields. The
+// fields are the raw input bytes read by fuzzInput.tuple.
+func fuzzEvent(names []string, name string, fields ...byte) []byte {
+	for i, n := range names {
+		if n == name {
+			return append([]byte{byte(i), 0}, fields...)
+		}
+	}
+	panic("unknown event: " + name)
+}
+
+func FuzzDecodeRedrawEvent(f *testing.F) {
+	names := sortedNames(redrawSchemas, "flush", "cmdline_hide", "unknown_event")
+
+	f.Add([]byte{})
+	f.Add(append(append(append(append(
+		// grid_resize 2 10 3
+		fuzzEvent(names, "grid_resize", 0, 2, 0, 10, 0, 3, 0),
+		// grid_line 2 1 2 [["a", 7, 2], ...]
+		fuzzEvent(names, "grid_line", 0, 2, 0, 1, 0, 2, 0, 3, 9, 1, 7, 2, 9, 3, 0, 3, 10, 2, 4, 1, 1, 0)...),
+		// grid_scroll 2 0 3 0 10 1
+		fuzzEvent(names, "grid_scroll", 0, 2, 0, 0, 0, 3, 0, 0, 0, 10, 0, 1, 0)...),
+		fuzzEvent(names, "flush")...),
+		// grid_destroy 2
+		fuzzEvent(names, "grid_destroy", 0, 2, 0)...))
+	f.Add(append(
+		// hl_attr_define 7 {"a": 0xff}
+		fuzzEvent(names, "hl_attr_define", 0, 7, 0, 8, 1, 1, 2, 0xff, 0),
+		fuzzEvent(names, "flush")...))
+	f.Add(fuzzEvent(names, "win_viewport", 0, 2, 0xff, 6, 0, 0, 0, 20, 0, 3, 0, 4, 0xff, 1, 30))
+	f.Add(fuzzEvent(names, "cmdline_show", 0, 2, 9, 1, 7, 0, 4, 1, 0, 3, 0, 0, 0, 0, 0, 0, 0, 1, 0))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := &Screen{
+			ws:    &Workspace{},
+			model: grid.NewModel(),
+		}
+		s.redraw = newRedrawModel(s)
+		m := grid.NewModel()
+
+		in := &fuzzInput{data: data}
+		for i := 0; i < 64 && len(in.data) > 0; i++ {
+			name := names[int(in.byte())%len(names)]
+			update := []interface{}{name}
+			for j := 0; j <= int(in.byte())%3; j++ {
+				update = append(update, in.tuple(redrawSchemas[name]))
+			}
+
+			m.Apply(update)
+			e, err := decodeRedrawEvent(update)
+			if err != nil {
+				continue
+			}
+			if e.name != name {
+				t.Fatalf("decodeRedrawEvent(%#v) name = %q", update, e.name)
+			}
+			s.redraw.apply(&e)
+		}
+	})
+}
+
+func FuzzDecodeGuiEvent(f *testing.F) {
+	names := sortedNames(guiSchemas, "unknown_event")
+
+	f.Add([]byte{})
+	for i := range names {
+		f.Add([]byte{byte(i)})
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &fuzzInput{data: data}
+		name := names[int(in.byte())%len(names)]
+		updates := append([]interface{}{name}, in.tuple(guiSchemas[name])...)
+
+		e, err := decodeGuiEvent(updates)
+		if err != nil {
+			return
+		}
+		if e.name != name {
+			t.Fatalf("decodeGuiEvent(%#v) name = %q", updates, e.name)
+		}
+		if _, ok := guiSchemas[name]; ok && e.args == nil {
+			t.Fatalf("decodeGuiEvent(%#v) has no arguments", updates)
+		}
+	})
+}
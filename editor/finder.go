@@ -5,8 +5,6 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-
-	"github.com/akiyosi/goneovim/util"
 )
 
 // Finder is a fuzzy finder window
@@ -31,7 +29,9 @@ func (f *Finder) hide() {
 	if ok {
 		f.ws.cursor.widget.SetParent(win)
 		f.ws.cursor.widget.Hide()
-		f.ws.cursor.widget.Show()
+		if !f.ws.cursor.isBusy {
+			f.ws.cursor.widget.Show()
+		}
 	}
 }
 
@@ -40,54 +40,39 @@ func (f *Finder) show() {
 	f.ws.fpalette.show()
 }
 
-func (f *Finder) cursorPos(args []interface{}) {
-	x := util.ReflectToInt(args[0])
+func (f *Finder) cursorPos(x int) {
 	f.ws.fpalette.cursorMove(x)
 }
 
-func (f *Finder) selectResult(args []interface{}) {
-	selected := util.ReflectToInt(args[0])
+func (f *Finder) selectResult(selected int) {
 	f.ws.fpalette.showSelected(selected)
 }
 
-func (f *Finder) showPattern(args []interface{}) {
+func (f *Finder) showPattern(pattern finderPattern) {
 	palette := f.ws.fpalette
-	p := args[0].(string)
+	p := pattern.pattern
 	isResize := palette.patternText != p
 	palette.setPattern(p)
-	palette.cursorMove(util.ReflectToInt(args[1]))
+	palette.cursorMove(pattern.pos)
 	if isResize {
 		palette.resize()
 	}
 }
 
-func (f *Finder) showResult(args []interface{}) {
+func (f *Finder) showResult(result finderResult) {
 	palette := f.ws.fpalette
 
-	selected := util.ReflectToInt(args[1])
-	match := [][]int{}
-	for _, i := range args[2].([]interface{}) {
-		m := []int{}
-		for _, n := range i.([]interface{}) {
-			m = append(m, util.ReflectToInt(n))
-		}
-		match = append(match, m)
-	}
+	selected := result.selected
+	match := result.match
 
-	resultType := ""
-	if args[3] != nil {
-		resultType = args[3].(string)
-	}
+	resultType := result.resultType
 	results := []string{}
 	palette.resultType = resultType
 
-	rawItems := args[0].([]interface{})
-
 	lastFile := ""
 	itemTypes := []string{}
 	itemMatches := [][]int{}
-	for i, item := range rawItems {
-		text := item.(string)
+	for i, text := range result.items {
 		if resultType == "file_line" {
 			parts := strings.SplitN(text, ":", 2)
 			if len(parts) < 2 {
@@ -158,8 +143,8 @@ func (f *Finder) showResult(args []interface{}) {
 	}
 	palette.showSelected(selected)
 
-	start := util.ReflectToInt(args[4])
-	total := util.ReflectToInt(args[5])
+	start := result.start
+	total := result.total
 
 	// if len(rawItems) == f.showTotal {
 	// 	f.scrollCol.Show()
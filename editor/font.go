@@ -4,7 +4,13 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
+	"github.com/akiyosi/goneovim/opentype"
+	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
 )
 
@@ -23,6 +29,68 @@ type Font struct {
 	lineHeight         int
 	lineSpace          int
 	shift              int
+
+	// fallbackFamilies is the families following the first one in guifont
+	fallbackFamilies []string
+	fallbacks        []*fallbackFont
+	fallbackCache    map[rune]*fallbackFont
+	primaryMetrics   *gui.QFontMetricsF
+
+	// styleFamilies is the families of the bold, italic and bold-italic
+	// faces. The style of the primary font is used if it is empty.
+	styleFamilies [styleLen]string
+	styleFonts    [styleLen]*gui.QFont
+
+	// styledFonts caches the faces to rasterize the glyphs with
+	styledFonts map[styledFontKey]*styledFont
+
+	// features is the OpenType font features such as "ss01" and "-calt"
+	features []string
+	// ligatures is false if a feature which forms ligatures is turned off
+	ligatures bool
+	// substitutedTags is the tags of the enabled features which are applied
+	// by substituting the glyphs
+	substitutedTags []string
+	// substitutions caches the glyph substitutions of the features for each
+	// face the text is shaped with
+	substitutions map[string]*opentype.Substitution
+
+	// widthMutex guards the fallbacks and the width of the cells measured
+	// by the redraw worker, which runs off the Qt thread
+	widthMutex   sync.Mutex
+	widthMetrics *gui.QFontMetricsF
+	normalWidths map[string]bool
+}
+
+// fontStyle is a style of the font faces which can have its own family
+type fontStyle int
+
+const (
+	styleBold fontStyle = iota
+	styleItalic
+	styleBoldItalic
+	styleLen
+)
+
+// styledFontKey is a style of a face of the font
+type styledFontKey struct {
+	base   *gui.QFont
+	bold   bool
+	italic bool
+}
+
+// styledFont is a face to rasterize the glyphs with, and its key in the
+// glyph atlas
+type styledFont struct {
+	font *gui.QFont
+	key  string
+}
+
+// fallbackFont is a font of the fallback chain of guifont, which is scaled to
+// fit the cell of the primary font
+type fallbackFont struct {
+	font    *gui.QFont
+	metrics *gui.QFontMetricsF
 }
 
 func fontSizeNew(font *gui.QFont) (int, int, float64, float64, float64) {
@@ -66,9 +134,10 @@ func initFontNew(family string, size float64, lineSpace int) *Font {
 	width, height, truewidth, ascent, italicWidth := fontSizeNew(font)
 
 	defaultFont := gui.NewQFont()
-	return &Font{
+	f := &Font{
 		fontNew:            font,
 		fontMetrics:        gui.NewQFontMetricsF(font),
+		widthMetrics:       gui.NewQFontMetricsF(font),
 		defaultFont:        defaultFont,
 		defaultFontMetrics: gui.NewQFontMetricsF(defaultFont),
 		width:              width,
@@ -80,6 +149,15 @@ func initFontNew(family string, size float64, lineSpace int) *Font {
 		ascent:             ascent,
 		italicWidth:        italicWidth,
 	}
+	f.styleFamilies = [styleLen]string{
+		editor.config.Editor.FontFamilyBold,
+		editor.config.Editor.FontFamilyItalic,
+		editor.config.Editor.FontFamilyBoldItalic,
+	}
+	f.updateStyleFonts()
+	f.setFeatures(editor.config.Editor.FontFeatures)
+
+	return f
 }
 
 func (f *Font) change(family string, size float64, weight gui.QFont__Weight, stretch int) {
@@ -97,10 +175,410 @@ func (f *Font) change(family string, size float64, weight gui.QFont__Weight, str
 	f.shift = int(float64(f.lineSpace)/2 + ascent)
 	f.italicWidth = italicWidth
 
+	f.updateStyleFonts()
+	f.updateFallbacks()
+	f.applyFeatures()
+
 	f.putDebugLog()
 	f.ws.screen.purgeTextCacheForWins()
 }
 
+// setFallbacks sets the font families to draw the glyphs which the primary
+// font does not have, in order of priority
+func (f *Font) setFallbacks(families []string) {
+	f.fallbackFamilies = families
+	f.updateFallbacks()
+	f.ws.screen.purgeTextCacheForWins()
+}
+
+// setStyleFamily sets the family of the face of the style.
+// The face is derived from the primary font if family is empty.
+func (f *Font) setStyleFamily(style fontStyle, family string) {
+	f.styleFamilies[style] = family
+	f.updateStyleFonts()
+	f.ws.screen.purgeTextCacheForWins()
+}
+
+// updateStyleFonts creates the faces of the styles which have their own
+// family. The faces are scaled if their metrics do not match the cell of the
+// primary font, so that the grid does not break.
+func (f *Font) updateStyleFonts() {
+	f.styledFonts = nil
+	size := f.fontNew.PointSizeF()
+	for i, family := range f.styleFamilies {
+		f.styleFonts[i] = nil
+		if family == "" {
+			continue
+		}
+
+		font := gui.NewQFont2(family, 1, int(gui.QFont__Normal), false)
+		font.SetPointSizeF(size)
+		font.SetFixedPitch(true)
+		font.SetKerning(false)
+		font.SetStyleStrategy(f.fontNew.StyleStrategy())
+		style := fontStyle(i)
+		if style == styleBold || style == styleBoldItalic {
+			font.SetWeight(f.fontNew.Weight() + 25)
+		} else {
+			font.SetWeight(f.fontNew.Weight())
+		}
+		font.SetItalic(style == styleItalic || style == styleBoldItalic)
+
+		metrics := gui.NewQFontMetricsF(font)
+		w := metrics.HorizontalAdvance("w", -1)
+		h := metrics.Height()
+		if w <= 0 || h <= 0 {
+			editor.putLog("invalid font family for the style:", family)
+			continue
+		}
+		scale := 1.0
+		if math.Abs(w-f.truewidth) > 0.01 {
+			scale = f.truewidth / w
+		}
+		if h*scale > float64(f.height) {
+			scale = float64(f.height) / h
+		}
+		if scale != 1.0 {
+			editor.putLog(
+				fmt.Sprintf(
+					"the metrics of %s (%.2fx%.2f) do not match the cell (%.2fx%d), scaled by %.3f",
+					family, w, h, f.truewidth, f.height, scale,
+				),
+			)
+			font.SetPointSizeF(size * scale)
+		}
+
+		f.styleFonts[i] = font
+	}
+}
+
+// styleFont returns the face of the style which has its own family,
+// or nil if the style is derived from the primary font
+func (f *Font) styleFont(bold, italic bool) *gui.QFont {
+	switch {
+	case bold && italic:
+		return f.styleFonts[styleBoldItalic]
+	case bold:
+		return f.styleFonts[styleBold]
+	case italic:
+		return f.styleFonts[styleItalic]
+	default:
+		return nil
+	}
+}
+
+// styled returns the face of base, which is the primary font or a fallback
+// font of f, in the style. The faces are cached until the fonts of f change.
+func (f *Font) styled(base *gui.QFont, bold, italic bool) *styledFont {
+	key := styledFontKey{base, bold, italic}
+	if s, ok := f.styledFonts[key]; ok {
+		return s
+	}
+
+	font := base
+	if base == f.fontNew {
+		if sf := f.styleFont(bold, italic); sf != nil {
+			font = sf
+		}
+	}
+	if font == base && (bold || italic) {
+		font = gui.NewQFont2(base.Family(), 1, int(gui.QFont__Normal), false)
+		font.SetPointSizeF(base.PointSizeF())
+		font.SetFixedPitch(true)
+		font.SetKerning(false)
+		font.SetStyleStrategy(base.StyleStrategy())
+		if bold {
+			font.SetWeight(f.fontNew.Weight() + 25)
+		}
+		if italic {
+			font.SetItalic(true)
+		}
+	}
+
+	s := &styledFont{
+		font: font,
+		key:  font.ToString(),
+	}
+	if f.styledFonts == nil {
+		f.styledFonts = make(map[styledFontKey]*styledFont)
+	}
+	f.styledFonts[key] = s
+
+	return s
+}
+
+// setFeatures sets the OpenType font features
+func (f *Font) setFeatures(features []string) {
+	f.features = nil
+	for _, feature := range features {
+		if _, _, ok := opentype.ParseFeature(feature); !ok {
+			editor.putLog("invalid font feature:", feature)
+			continue
+		}
+		f.features = append(f.features, feature)
+	}
+	f.applyFeatures()
+}
+
+// applyFeatures applies the font features to the font.
+// Qt 5 can not set the OpenType features of a font. The features which form
+// ligatures are applied by the text shaping of Qt, so turning one of them off
+// stops drawing the characters which form ligatures together. The other
+// features are applied by replacing the glyphs shaped by Qt with the ones the
+// GSUB table of the face substitutes for the features.
+func (f *Font) applyFeatures() {
+	enabled := map[string]bool{}
+	for _, feature := range f.features {
+		tag, on, _ := opentype.ParseFeature(feature)
+		enabled[tag] = on
+	}
+
+	f.ligatures = true
+	f.substitutedTags = nil
+	for tag, on := range enabled {
+		switch {
+		case opentype.IsLigatureFeature(tag):
+			if !on {
+				f.ligatures = false
+			}
+		case on:
+			f.substitutedTags = append(f.substitutedTags, tag)
+		}
+	}
+	sort.Strings(f.substitutedTags)
+	f.substitutions = nil
+}
+
+// featureKey returns the key of the features for the text caches
+func (f *Font) featureKey() string {
+	return strings.Join(f.features, ",")
+}
+
+// substitution returns the glyph substitutions of the features in the face,
+// or nil if the face substitutes no glyph for them
+func (f *Font) substitution(face *gui.QRawFont) *opentype.Substitution {
+	key := face.FamilyName() + " " + face.StyleName()
+	if s, ok := f.substitutions[key]; ok {
+		return s
+	}
+	if f.substitutions == nil {
+		f.substitutions = make(map[string]*opentype.Substitution)
+	}
+	f.substitutions[key] = nil
+
+	s, err := opentype.ParseGSUB([]byte(face.FontTable("GSUB").ConstData()), f.substitutedTags)
+	if err != nil {
+		editor.putLog("can not read the font features of", key+":", err)
+		return nil
+	}
+	found := map[string]bool{}
+	for _, tag := range s.Found {
+		found[tag] = true
+	}
+	for _, tag := range f.substitutedTags {
+		if !found[tag] {
+			editor.putLog("font feature", tag, "is not found in", key)
+		}
+	}
+	if len(s.Unsupported) > 0 {
+		editor.putLog("font features", strings.Join(s.Unsupported, ","), "of", key, "have contextual substitutions, which are not applied")
+	}
+	if s.Empty() {
+		return nil
+	}
+	f.substitutions[key] = s
+
+	return s
+}
+
+// drawText draws text from the point on the baseline with the font of p,
+// applying the font features which substitute the glyphs
+func (f *Font) drawText(p *gui.QPainter, point *core.QPointF, text string) {
+	if len(f.substitutedTags) == 0 {
+		p.DrawText(point, text)
+		return
+	}
+
+	layout := gui.NewQTextLayout2(text)
+	layout.SetFont(p.Font())
+	layout.BeginLayout()
+	line := layout.CreateLine()
+	layout.EndLayout()
+	if !line.IsValid() {
+		layout.DestroyQTextLayout()
+		p.DrawText(point, text)
+		return
+	}
+
+	// The positions of the glyphs are relative to the top of the line
+	origin := core.NewQPointF3(point.X(), point.Y()-line.Ascent())
+	for _, run := range layout.GlyphRuns(-1, -1) {
+		if s := f.substitution(run.RawFont()); s != nil {
+			glyphs := run.GlyphIndexes()
+			for i, g := range glyphs {
+				glyphs[i] = uint(s.Glyph(uint16(g)))
+			}
+			run.SetGlyphIndexes(glyphs)
+		}
+		p.DrawGlyphRun(origin, run)
+	}
+	layout.DestroyQTextLayout()
+}
+
+// drawTextInRect draws text vertically centred in rect, and also
+// horizontally if centered is true, applying the font features
+func (f *Font) drawTextInRect(p *gui.QPainter, rect *core.QRectF, text string, centered bool) {
+	if len(f.substitutedTags) == 0 {
+		align := core.Qt__AlignVCenter
+		if centered {
+			align = core.Qt__AlignCenter
+		}
+		p.DrawText6(rect, text, gui.NewQTextOption2(align))
+		return
+	}
+
+	metrics := gui.NewQFontMetricsF(p.Font())
+	x := rect.X()
+	if centered {
+		x += (rect.Width() - metrics.HorizontalAdvance(text, -1)) / 2
+	}
+	y := rect.Y() + (rect.Height()-metrics.Height())/2 + metrics.Ascent()
+	f.drawText(p, core.NewQPointF3(x, y), text)
+}
+
+// newUnmergedFont returns the font which does not fall back to the other
+// fonts, to check whether the font itself has a glyph
+func newUnmergedFont(family string, size float64, weight int) *gui.QFont {
+	font := gui.NewQFont()
+	font.SetFamily(family)
+	font.SetPointSizeF(size)
+	font.SetWeight(weight)
+	font.SetFixedPitch(true)
+	font.SetKerning(false)
+	font.SetStyleStrategy(gui.QFont__NoFontMerging)
+
+	return font
+}
+
+// updateFallbacks scales the fallback fonts to the cell metrics of the
+// primary font
+func (f *Font) updateFallbacks() {
+	f.widthMutex.Lock()
+	defer f.widthMutex.Unlock()
+
+	f.widthMetrics = gui.NewQFontMetricsF(f.fontNew)
+	f.normalWidths = nil
+	f.styledFonts = nil
+	f.fallbacks = nil
+	f.fallbackCache = make(map[rune]*fallbackFont)
+	if len(f.fallbackFamilies) == 0 {
+		f.primaryMetrics = nil
+		return
+	}
+
+	size := f.fontNew.PointSizeF()
+	weight := f.fontNew.Weight()
+	f.primaryMetrics = gui.NewQFontMetricsF(
+		newUnmergedFont(f.fontNew.Family(), size, weight),
+	)
+
+	for _, family := range f.fallbackFamilies {
+		font := newUnmergedFont(family, size, weight)
+		metrics := gui.NewQFontMetricsF(font)
+
+		// Fit the glyphs in the height of the cell,
+		// and in the width of the cell if the font has the latin glyphs
+		scale := float64(f.height) / metrics.Height()
+		if metrics.InFontUcs4('w') {
+			w := metrics.HorizontalAdvance("w", -1)
+			if w > 0 && f.truewidth/w < scale {
+				scale = f.truewidth / w
+			}
+		}
+		font.SetPointSizeF(size * scale)
+
+		f.fallbacks = append(f.fallbacks, &fallbackFont{
+			font:    font,
+			metrics: gui.NewQFontMetricsF(font),
+		})
+	}
+}
+
+// fallbackFor returns the first font in the fallback chain which has the
+// glyph of text, if the primary font does not have it
+func (f *Font) fallbackFor(text string) (*fallbackFont, bool) {
+	f.widthMutex.Lock()
+	defer f.widthMutex.Unlock()
+
+	return f.fallbackForLocked(text)
+}
+
+func (f *Font) fallbackForLocked(text string) (*fallbackFont, bool) {
+	if len(f.fallbacks) == 0 || text == "" || text[0] <= 127 {
+		return nil, false
+	}
+	r, _ := utf8.DecodeRuneInString(text)
+	font, ok := f.fallbackCache[r]
+	if ok {
+		return font, font != nil
+	}
+
+	if !f.primaryMetrics.InFontUcs4(uint(r)) {
+		for _, fallback := range f.fallbacks {
+			if fallback.metrics.InFontUcs4(uint(r)) {
+				font = fallback
+				break
+			}
+		}
+	}
+	f.fallbackCache[r] = font
+
+	return font, font != nil
+}
+
+// horizontalAdvance returns the advance width of text with the font which
+// draws it
+func (f *Font) horizontalAdvance(text string) float64 {
+	f.widthMutex.Lock()
+	defer f.widthMutex.Unlock()
+
+	if fallback, ok := f.fallbackForLocked(text); ok {
+		return fallback.metrics.HorizontalAdvance(text, -1)
+	}
+
+	return f.fontMetrics.HorizontalAdvance(text, -1)
+}
+
+// isNormalWidth reports whether the single cell text, which is not ASCII,
+// is drawn in exactly one cell with the font. The result is cached until the
+// font is changed.
+//
+// On Windows, HorizontalAdvance() may take a long time to get the width of CJK characters.
+// This issue may also be related to the following.
+// https://github.com/equalsraf/neovim-qt/issues/614
+func (f *Font) isNormalWidth(text string) bool {
+	f.widthMutex.Lock()
+	defer f.widthMutex.Unlock()
+
+	normalWidth, ok := f.normalWidths[text]
+	if ok {
+		return normalWidth
+	}
+
+	// if the glyph is drawn with the fallback font
+	if _, ok := f.fallbackForLocked(text); ok {
+		normalWidth = false
+	} else {
+		normalWidth = f.widthMetrics.HorizontalAdvance(text, -1) == f.widthMetrics.HorizontalAdvance("w", -1)
+	}
+	if f.normalWidths == nil {
+		f.normalWidths = make(map[string]bool)
+	}
+	f.normalWidths[text] = normalWidth
+
+	return normalWidth
+}
+
 func (f *Font) putDebugLog() {
 	if editor.opts.Debug == "" {
 		return
@@ -3,6 +3,7 @@ package editor
 import (
 	"bytes"
 	"fmt"
+	"html"
 	"strings"
 	"time"
 
@@ -27,6 +28,12 @@ type Message struct {
 	pos      *core.QPoint
 	isDrag   bool
 	isExpand bool
+
+	// indicator shows msg_showmode, msg_showcmd and msg_ruler
+	indicator *widgets.QWidget
+	showmode  *widgets.QLabel
+	showcmd   *widgets.QLabel
+	ruler     *widgets.QLabel
 }
 
 // MessageItem is
@@ -123,6 +130,25 @@ func initMessage() *Message {
 	m.widget.SetGraphicsEffect(util.DropShadow(-2, 4, 40, 200))
 	m.widget.Hide()
 
+	// showmode, showcmd and ruler indicator
+	indicatorLayout := widgets.NewQHBoxLayout()
+	indicatorLayout.SetContentsMargins(margin, 0, margin, 0)
+	indicatorLayout.SetSpacing(margin * 2)
+	indicatorLayout.SetSizeConstraint(widgets.QLayout__SetFixedSize)
+	m.indicator = widgets.NewQWidget(nil, 0)
+	m.indicator.SetObjectName("msgindicator")
+	m.indicator.SetAttribute(core.Qt__WA_TransparentForMouseEvents, true)
+	m.indicator.SetLayout(indicatorLayout)
+	m.showmode = widgets.NewQLabel(nil, 0)
+	m.showcmd = widgets.NewQLabel(nil, 0)
+	m.ruler = widgets.NewQLabel(nil, 0)
+	for _, l := range []*widgets.QLabel{m.showmode, m.showcmd, m.ruler} {
+		l.SetTextFormat(core.Qt__RichText)
+		l.Hide()
+		indicatorLayout.AddWidget(l, 0, 0)
+	}
+	m.indicator.Hide()
+
 	// hide messgaes at startup.
 	m.update()
 
@@ -144,6 +170,13 @@ func (m *Message) setColor() {
 		transparent,
 		fg,
 	))
+	m.indicator.SetStyleSheet(fmt.Sprintf(
+		" #msgindicator { background-color: rgba(%d, %d, %d, %f); }",
+		bg.R,
+		bg.G,
+		bg.B,
+		transparent,
+	))
 }
 
 func (m *Message) updateFont() {
@@ -155,6 +188,9 @@ func (m *Message) updateFont() {
 		item.icon.Move2(margin*5/4, margin)
 		item.label.SetFont(m.ws.font.fontNew)
 	}
+	m.showmode.SetFont(m.ws.font.fontNew)
+	m.showcmd.SetFont(m.ws.font.fontNew)
+	m.ruler.SetFont(m.ws.font.fontNew)
 }
 
 func (m *Message) connectUI() {
@@ -243,6 +279,25 @@ func (m *Message) resize() {
 		}
 	}
 	m.widget.Move2(x, y)
+
+	m.resizeIndicator()
+}
+
+func (m *Message) resizeIndicator() {
+	if m.ws == nil || m.ws.screen == nil {
+		return
+	}
+	scrollbarwidth := 0
+	if editor.config.ScrollBar.Visible {
+		if m.ws.scrollBar != nil {
+			scrollbarwidth = m.ws.scrollBar.widget.Width()
+		}
+	}
+	m.indicator.AdjustSize()
+	m.indicator.Move2(
+		m.ws.screen.widget.Width()-m.indicator.Width()-scrollbarwidth-12,
+		m.ws.screen.widget.Height()-m.indicator.Height()-4,
+	)
 }
 
 func (m *Message) resizeMessages() bool {
@@ -268,16 +323,13 @@ func (m *Message) resizeMessages() bool {
 	return ok
 }
 
-func (m *Message) msgShow(args []interface{}) {
+func (m *Message) msgShow(msgs []msgShow) {
 	prevKind := ""
 	isActiveState := editor.window.IsActiveWindow()
 	notifyText := ""
 
-	for _, arg := range args {
-		kind, ok := arg.([]interface{})[0].(string)
-		if !ok {
-			continue
-		}
+	for _, arg := range msgs {
+		kind := arg.kind
 		// text := ""
 		var buffer bytes.Buffer
 		length := 0
@@ -290,22 +342,9 @@ func (m *Message) msgShow(args []interface{}) {
 		}
 		maxLen := m.ws.screen.widget.Width() - scrollbarwidth - 12
 		var attrId int
-		for _, tupple := range arg.([]interface{})[1].([]interface{}) {
-			chunk, ok := tupple.([]interface{})
-			if !ok {
-				continue
-			}
-			if len(chunk) != 2 {
-				continue
-			}
-			attrId = util.ReflectToInt(chunk[0])
-			if !ok {
-				continue
-			}
-			msg, ok := chunk[1].(string)
-			if !ok {
-				continue
-			}
+		for _, chunk := range arg.content {
+			attrId = chunk.attr
+			msg := chunk.text
 			var color *RGBA
 			if m.ws.screen.hlAttrDef[attrId] != nil {
 				color = (m.ws.screen.hlAttrDef[attrId]).foreground
@@ -350,10 +389,7 @@ func (m *Message) msgShow(args []interface{}) {
 			return
 		}
 
-		replaceLast := false
-		if len(arg.([]interface{})) > 2 {
-			replaceLast, _ = arg.([]interface{})[2].(bool)
-		}
+		replaceLast := arg.replaceLast
 		if kind == prevKind {
 			// Do not show message icon if the same kind as the previous kind
 			m.makeMessage("_dup", attrId, buffer.String(), length, replaceLast)
@@ -408,10 +444,78 @@ func (m *Message) msgClear() {
 	}
 }
 
-func (m *Message) msgHistoryShow(args []interface{}) {
-	for _, arg := range args {
-		m.msgShow((arg.([]interface{})[0]).([]interface{}))
+func (m *Message) msgShowmode(contents [][]hlChunk) {
+	m.updateIndicator(m.showmode, contents)
+}
+
+func (m *Message) msgShowcmd(contents [][]hlChunk) {
+	m.updateIndicator(m.showcmd, contents)
+}
+
+func (m *Message) msgRuler(contents [][]hlChunk) {
+	m.updateIndicator(m.ruler, contents)
+}
+
+// updateIndicator sets the last content of the msg_showmode, msg_showcmd or
+// msg_ruler events to label
+func (m *Message) updateIndicator(label *widgets.QLabel, contents [][]hlChunk) {
+	if len(contents) == 0 {
+		return
+	}
+
+	text := m.chunksToHTML(contents[len(contents)-1])
+	label.SetText(text)
+	if text == "" {
+		label.Hide()
+	} else {
+		label.Show()
+	}
+
+	if m.showmode.Text() == "" && m.showcmd.Text() == "" && m.ruler.Text() == "" {
+		m.indicator.Hide()
+		return
 	}
+	m.resizeIndicator()
+	m.indicator.Show()
+	m.indicator.Raise()
+}
+
+// chunksToHTML converts the [attr_id, text] chunks to rich text
+func (m *Message) chunksToHTML(content []hlChunk) string {
+	var buffer bytes.Buffer
+	for _, chunk := range content {
+		attrId := chunk.attr
+		msg := chunk.text
+		if msg == "" {
+			continue
+		}
+		msg = strings.Replace(html.EscapeString(msg), " ", `&nbsp;`, -1)
+
+		hl := m.ws.screen.hlAttrDef[attrId]
+		if hl == nil || attrId == 0 {
+			buffer.WriteString(fmt.Sprintf("<font color='%s'>%s</font>", m.ws.foreground.Hex(), msg))
+			continue
+		}
+		style := fmt.Sprintf("color: %s;", hl.fg().Hex())
+		// getHighlight fills in the default background, so only a background
+		// that differs from it is drawn
+		if (hl.background != nil && !hl.background.equals(m.ws.background)) || hl.reverse {
+			style += fmt.Sprintf(" background-color: %s;", hl.bg().Hex())
+		}
+		if hl.bold {
+			style += " font-weight: bold;"
+		}
+		if hl.italic {
+			style += " font-style: italic;"
+		}
+		buffer.WriteString(fmt.Sprintf("<span style='%s'>%s</span>", style, msg))
+	}
+
+	return buffer.String()
+}
+
+func (m *Message) msgHistoryShow(entries []msgShow) {
+	m.msgShow(entries)
 }
 
 func (i *MessageItem) setText(text string) {
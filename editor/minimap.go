@@ -10,7 +10,7 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/akiyosi/goneovim/util"
+	"github.com/akiyosi/goneovim/grid"
 	"github.com/neovim/go-client/nvim"
 	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
@@ -70,6 +70,7 @@ func newMiniMap() *MiniMap {
 			// windows:        make(map[gridId]*Window),
 			windows:        sync.Map{},
 			cursor:         [2]int{0, 0},
+			model:          grid.NewModel(),
 			highlightGroup: make(map[string]int),
 		},
 		visible:       editor.config.MiniMap.Visible,
@@ -78,6 +79,7 @@ func newMiniMap() *MiniMap {
 		signal:        NewMiniMapSignal(nil),
 		redrawUpdates: make(chan [][]interface{}, 1000),
 	}
+	m.redraw = newRedrawModel(&m.Screen)
 	m.signal.ConnectRedrawSignal(func() {
 		updates := <-m.redrawUpdates
 		m.handleRedraw(updates)
@@ -509,40 +511,53 @@ func isWindowFloatForConfig(wc *nvim.WindowConfig) bool {
 }
 
 func (m *MiniMap) handleRedraw(updates [][]interface{}) {
+	// The events are applied to the redraw model first, so that the grids
+	// are copied to the model the minimap paints at flush before they are
+	// handled
+	events := make([]redrawEvent, 0, len(updates))
 	for _, update := range updates {
-		event := update[0].(string)
-		args := update[1:]
+		e, err := decodeRedrawEvent(update)
+		if err != nil {
+			editor.putLog("skip malformed redraw event:", err)
+			continue
+		}
+		for _, err := range e.skipped {
+			editor.putLog("skip malformed redraw event argument:", err)
+		}
+		m.redraw.apply(&e)
+		events = append(events, e)
+	}
+	for _, e := range events {
+		event := e.name
+		args := e.args
 		switch event {
 		case "grid_resize":
-			m.gridResize(args)
+			m.gridResize(args.([]gridResize))
 		// case "default_colors_set":
 		// 	args := update[1].([]interface{})
 		// 	w.setColorsSet(args)
 		case "hl_attr_define":
-			m.setHlAttrDef(args)
+			m.hlAttrDef = e.hlAttrDef
 		case "hl_group_set":
-			m.setHighlightGroup(args)
+			m.setHighlightGroup(args.([]hlGroupSet))
 			m.setColor()
-		case "grid_line":
-			m.gridLine(args)
-		case "grid_clear":
-			m.gridClear(args)
 		case "grid_destroy":
-			m.gridDestroy(args)
+			m.gridDestroy(args.([]gridId))
 		case "grid_cursor_goto":
 			// m.gridCursorGoto(args)
 		case "grid_scroll":
-			m.gridScroll(args)
+			m.gridScroll(args.([]gridScroll))
 
 		case "win_viewport":
-			vp := args[0].([]interface{})
+			vp := args.([]winViewport)[0]
 			m.viewport = [4]int{
-				util.ReflectToInt(vp[2]) + 1,
-				util.ReflectToInt(vp[3]) + 1,
-				util.ReflectToInt(vp[4]) + 1,
-				util.ReflectToInt(vp[5]) + 1,
+				vp.topline + 1,
+				vp.botline + 1,
+				vp.curline + 1,
+				vp.curcol + 1,
 			}
 		case "flush":
+			m.applyDamage(e.damage)
 			m.update()
 			m.mapScroll()
 
@@ -649,6 +664,17 @@ func (m *MiniMap) mouseEvent(event *gui.QMouseEvent) {
 		m.nvim.Eval("line('w0')", &absMapTop)
 		targetPos = absMapTop + y
 	}
+
+	// If the mouse is disabled, only the view is moved without leaving
+	// the current mode, as the wheel scrolling does
+	if !m.ws.mouseEnabled {
+		win, ok := m.ws.screen.getWindow(m.ws.cursor.gridid)
+		if ok {
+			win.scrollViewTo(targetPos)
+		}
+		return
+	}
+
 	m.ws.nvim.Command(fmt.Sprintf("%d", targetPos))
 
 	mappings, err := m.ws.nvim.KeyMap("normal")
@@ -667,13 +693,13 @@ func (m *MiniMap) mouseEvent(event *gui.QMouseEvent) {
 }
 
 func (w *Window) drawMinimap(p *gui.QPainter, y int, col int, cols int) {
-	if y >= len(w.content) {
+	if y >= len(w.content.Cells) {
 		return
 	}
 	wsfont := w.getFont()
 	p.SetFont(wsfont.fontNew)
 	p.SetRenderHint(gui.QPainter__Antialiasing, true)
-	line := w.content[y]
+	line := w.content.Cells[y]
 	chars := map[*Highlight][]int{}
 
 	for x := col; x < col+cols; x++ {
@@ -683,14 +709,14 @@ func (w *Window) drawMinimap(p *gui.QPainter, y int, col int, cols int) {
 		if line[x] == nil {
 			continue
 		}
-		if line[x].char == " " {
+		if line[x].Text == " " {
 			continue
 		}
-		if line[x].char == "" {
+		if line[x].Text == "" {
 			continue
 		}
 
-		highlight := line[x].highlight
+		highlight := w.cellHighlight(line[x])
 		colorSlice, ok := chars[highlight]
 		if !ok {
 			colorSlice = []int{}
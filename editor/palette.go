@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"strings"
 
 	"github.com/akiyosi/goneovim/fuzzy"
 	"github.com/akiyosi/goneovim/util"
@@ -34,6 +35,7 @@ type Palette struct {
 	max              int
 	showTotal        int
 	pattern          *widgets.QLabel
+	block            *widgets.QLabel
 	patternPadding   int
 	patternWidget    *widgets.QWidget
 	scrollBar        *widgets.QWidget
@@ -104,7 +106,14 @@ func initPalette() *Palette {
 	pattern.SetContentsMargins(padding, padding, padding, padding)
 	pattern.SetFixedWidth(width - padding*2)
 	pattern.SetSizePolicy2(widgets.QSizePolicy__Preferred, widgets.QSizePolicy__Maximum)
+	// block shows the lines of the cmdline block above the pattern
+	block := widgets.NewQLabel(nil, 0)
+	block.SetContentsMargins(padding, padding, padding, 0)
+	block.SetTextFormat(core.Qt__RichText)
+	block.SetSizePolicy2(widgets.QSizePolicy__Preferred, widgets.QSizePolicy__Maximum)
+	block.Hide()
 	patternLayout := widgets.NewQVBoxLayout()
+	patternLayout.AddWidget(block, 0, 0)
 	patternLayout.AddWidget(pattern, 0, 0)
 	patternLayout.SetContentsMargins(0, 0, 0, 0)
 	patternLayout.SetSpacing(0)
@@ -123,6 +132,7 @@ func initPalette() *Palette {
 		resultWidget:     resultWidget,
 		resultMainWidget: resultMainWidget,
 		pattern:          pattern,
+		block:            block,
 		patternPadding:   padding,
 		patternWidget:    patternWidget,
 		scrollCol:        scrollCol,
@@ -216,6 +226,7 @@ func (p *Palette) resize() {
 	}
 	p.width = width
 	p.pattern.SetFixedWidth(p.width - p.padding*2)
+	p.block.SetFixedWidth(p.width - p.padding*2)
 	p.widget.SetMaximumWidth(p.width)
 	p.widget.SetMinimumWidth(p.width)
 
@@ -269,6 +280,17 @@ func (p *Palette) setPattern(text string) {
 	p.pattern.SetText(text)
 }
 
+// setBlock shows lines above the pattern, an empty lines hides the block
+func (p *Palette) setBlock(lines []string) {
+	if len(lines) == 0 {
+		p.block.SetText("")
+		p.block.Hide()
+		return
+	}
+	p.block.SetText(strings.Join(lines, "<br>"))
+	p.block.Show()
+}
+
 func (p *Palette) cursorMove(x int) {
 	X := p.textLength()
 	var stickOutLen int
@@ -284,6 +306,7 @@ func (p *Palette) cursorMove(x int) {
 	p.cursorX = pos
 	p.ws.cursor.x = p.cursorX + p.patternPadding
 	p.ws.cursor.y = p.patternPadding + p.ws.cursor.shift
+	p.ws.cursor.stopAnimation()
 	p.ws.cursor.widget.Move2(p.ws.cursor.x, p.ws.cursor.y+p.ws.cursor.shift+1)
 	p.ws.cursor.widget.SetParent(p.pattern)
 	p.ws.cursor.isInPalette = true
@@ -311,6 +334,7 @@ func (p *Palette) updateFont() {
 	font := gui.NewQFont2(editor.extFontFamily, editor.extFontSize, 1, false)
 	p.widget.SetFont(font)
 	p.pattern.SetFont(font)
+	p.block.SetFont(font)
 }
 
 func (p *Palette) textLength() int {
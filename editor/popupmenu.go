@@ -21,7 +21,7 @@ type PopupMenu struct {
 	gridid          int
 	itemLayout      *widgets.QGridLayout
 	items           []*PopupItem
-	rawItems        []interface{}
+	rawItems        []popupmenuItem
 	total           int
 	showTotal       int
 	selected        int
@@ -33,6 +33,10 @@ type PopupMenu struct {
 	scrollCol       *widgets.QWidget
 	detailLabel     *widgets.QLabel
 	hideItemIdx     [2]bool
+
+	// bounds reported to neovim, and the queue to send them in order
+	bounds   [4]float64
+	boundsCh chan [4]float64
 }
 
 // PopupItem is
@@ -104,6 +108,7 @@ func initPopupmenuNew() *PopupMenu {
 		itemLayout:  itemLayout,
 		detailLabel: detailLabel,
 		total:       total,
+		boundsCh:    make(chan [4]float64, 1),
 		scrollBar:   scrollBar,
 		scrollCol:   scrollCol,
 	}
@@ -222,13 +227,12 @@ func (p *PopupMenu) setPumblend(pumblend int) {
 	)
 }
 
-func (p *PopupMenu) showItems(args []interface{}) {
-	arg := args[0].([]interface{})
-	items := arg[0].([]interface{})
-	selected := util.ReflectToInt(arg[1])
-	row := util.ReflectToInt(arg[2])
-	col := util.ReflectToInt(arg[3])
-	gridid := util.ReflectToInt(arg[4])
+func (p *PopupMenu) showItems(show popupmenuShow) {
+	items := show.items
+	selected := show.selected
+	row := show.row
+	col := show.col
+	gridid := show.grid
 
 	p.rawItems = items
 	p.selected = selected
@@ -280,7 +284,7 @@ func (p *PopupMenu) showItems(args []interface{}) {
 			continue
 		}
 
-		item := items[i].([]interface{})
+		item := items[i]
 		itemLen := p.detectItemLen(item)
 		if itemLen > maxItemLen {
 			maxItemLen = itemLen
@@ -340,12 +344,13 @@ func (p *PopupMenu) showItems(args []interface{}) {
 
 	p.moveWidget(x, y, lineHeight, isCursorBelowTheCenter, itemNum)
 
+	p.reportBounds()
 }
 
-func (p *PopupMenu) detectItemLen(item []interface{}) int {
+func (p *PopupMenu) detectItemLen(item popupmenuItem) int {
 	itemlen := 0
-	for _, i := range item {
-		if i.(string) == "" {
+	for _, i := range []string{item.word, item.kind, item.menu, item.info} {
+		if i == "" {
 			continue
 		}
 		itemlen++
@@ -455,10 +460,64 @@ func (p *PopupMenu) moveWidget(x int, y int, lineHeight int, isCursorBelowTheCen
 
 func (p *PopupMenu) hide() {
 	p.widget.Hide()
+	p.bounds = [4]float64{}
+}
+
+// reportBounds tells neovim the position and the size of the popupmenu in
+// grid cells, so that plugins can place their floating windows next to it
+func (p *PopupMenu) reportBounds() {
+	font := p.ws.font
+	if font == nil || font.truewidth == 0 || font.lineHeight == 0 {
+		return
+	}
+
+	y := p.widget.Y()
+	if p.ws.drawTabline && p.ws.tabline != nil {
+		y -= p.ws.tabline.widget.Height()
+	}
+	width := float64(p.widget.Width()) / font.truewidth
+	height := float64(p.widget.Height()) / float64(font.lineHeight)
+	row := float64(y) / float64(font.lineHeight)
+	col := float64(p.widget.X()) / font.truewidth
+
+	bounds := [4]float64{width, height, row, col}
+	if bounds == p.bounds {
+		return
+	}
+	p.bounds = bounds
+
+	// Only the latest bounds is worth sending
+	select {
+	case <-p.boundsCh:
+	default:
+	}
+	p.boundsCh <- bounds
 }
 
-func (p *PopupMenu) selectItem(args []interface{}) {
-	selected := util.ReflectToInt(args[0].([]interface{})[0])
+// reportLoop tells neovim the height of the popupmenu once, and then sends
+// the bounds one by one, so that a stale bounds never arrives after a newer
+// one
+func (p *PopupMenu) reportLoop() {
+	err := p.ws.nvim.SetPumHeight(p.total)
+	if err != nil {
+		editor.putLog("nvim_ui_pum_set_height:", err)
+	}
+
+	for {
+		select {
+		case bounds := <-p.boundsCh:
+			// nvim_ui_pum_set_bounds is available in neovim 0.5 or later
+			err := p.ws.nvim.Request("nvim_ui_pum_set_bounds", nil, bounds[0], bounds[1], bounds[2], bounds[3])
+			if err != nil {
+				editor.putLog("nvim_ui_pum_set_bounds:", err)
+			}
+		case <-p.ws.stop:
+			return
+		}
+	}
+}
+
+func (p *PopupMenu) selectItem(selected int) {
 	if selected == -1 && p.top > 0 {
 		p.scroll(-p.top)
 	}
@@ -498,7 +557,10 @@ func (p *PopupMenu) scroll(n int) {
 	maxItemLen := 0
 	for i := 0; i < p.showTotal; i++ {
 		popupItem := popupItems[i]
-		item := items[i+p.top].([]interface{})
+		if i+p.top >= len(items) {
+			break
+		}
+		item := items[i+p.top]
 		itemLen := p.detectItemLen(item)
 		if itemLen > maxItemLen {
 			maxItemLen = itemLen
@@ -620,11 +682,11 @@ func (p *PopupItem) setSelected(selected bool) {
 	p.updateContent()
 }
 
-func (p *PopupItem) setItem(item []interface{}, selected bool) {
-	word := item[0].(string)
-	kind := item[1].(string)
-	menu := item[2].(string)
-	info := item[3].(string)
+func (p *PopupItem) setItem(item popupmenuItem, selected bool) {
+	word := item.word
+	kind := item.kind
+	menu := item.menu
+	info := item.info
 
 	p.wordRequest = word
 	p.menuRequest = menu
@@ -0,0 +1,358 @@
+package editor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neovim/go-client/nvim"
+)
+
+const (
+	recordKindAttach = "attach"
+	recordKindRedraw = "redraw"
+	recordKindGui    = "gui"
+)
+
+// RecordEntry is a line of the recording file
+type RecordEntry struct {
+	// Time is the elapsed time in microseconds since the recording started
+	Time      int64                  `json:"time"`
+	Workspace int                    `json:"workspace"`
+	Kind      string                 `json:"kind"`
+	Cols      int                    `json:"cols,omitempty"`
+	Rows      int                    `json:"rows,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	API5      bool                   `json:"api5,omitempty"`
+	Args      interface{}            `json:"args,omitempty"`
+}
+
+// Recorder writes the redraw and Gui notifications received from nvim to a file
+// as JSON lines, so that the rendering can be reproduced with --replay.
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	start  time.Time
+	nextID int
+}
+
+// Recording is a loaded recording file
+type Recording struct {
+	attach  *RecordEntry
+	entries []*RecordEntry
+}
+
+func newRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		file:  file,
+		enc:   json.NewEncoder(file),
+		start: time.Now(),
+	}, nil
+}
+
+// newWorkspaceID returns the id which distinguishes workspaces in the recording
+func (r *Recorder) newWorkspaceID() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextID
+	r.nextID++
+
+	return id
+}
+
+func (r *Recorder) write(entry *RecordEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	entry.Time = time.Since(r.start).Microseconds()
+	err := r.enc.Encode(entry)
+	if err != nil {
+		editor.putLog("failed to record:", err)
+	}
+}
+
+func (r *Recorder) attach(id, cols, rows int, options map[string]interface{}, api5 bool) {
+	r.write(&RecordEntry{
+		Workspace: id,
+		Kind:      recordKindAttach,
+		Cols:      cols,
+		Rows:      rows,
+		Options:   options,
+		API5:      api5,
+	})
+}
+
+func (r *Recorder) redraw(id int, updates [][]interface{}) {
+	args := make([]interface{}, len(updates))
+	for i, update := range updates {
+		args[i] = encodeRecordValue(update)
+	}
+	r.write(&RecordEntry{
+		Workspace: id,
+		Kind:      recordKindRedraw,
+		Args:      args,
+	})
+}
+
+func (r *Recorder) gui(id int, updates []interface{}) {
+	r.write(&RecordEntry{
+		Workspace: id,
+		Kind:      recordKindGui,
+		Args:      encodeRecordValue(updates),
+	})
+}
+
+func (r *Recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	r.file.Close()
+	r.file = nil
+}
+
+// encodeRecordValue converts the nvim types which can not be represented in JSON
+// into tagged objects.
+func encodeRecordValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nvim.Window:
+		return map[string]interface{}{"$window": int(v)}
+	case nvim.Buffer:
+		return map[string]interface{}{"$buffer": int(v)}
+	case nvim.Tabpage:
+		return map[string]interface{}{"$tabpage": int(v)}
+	case []byte:
+		return string(v)
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, item := range v {
+			a[i] = encodeRecordValue(item)
+		}
+		return a
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = encodeRecordValue(item)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = encodeRecordValue(item)
+		}
+		return m
+	default:
+		return v
+	}
+}
+
+// decodeRecordValue restores the values decoded from JSON to the types
+// which are delivered by the nvim rpc client.
+func decodeRecordValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, item := range v {
+			v[i] = decodeRecordValue(item)
+		}
+		return v
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for key, item := range v {
+				n, ok := item.(json.Number)
+				if !ok {
+					break
+				}
+				i, err := strconv.Atoi(string(n))
+				if err != nil {
+					break
+				}
+				switch key {
+				case "$window":
+					return nvim.Window(i)
+				case "$buffer":
+					return nvim.Buffer(i)
+				case "$tabpage":
+					return nvim.Tabpage(i)
+				}
+			}
+		}
+		for key, item := range v {
+			v[key] = decodeRecordValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func loadRecording(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := &Recording{}
+	dec := json.NewDecoder(bufio.NewReader(file))
+	dec.UseNumber()
+	for {
+		entry := &RecordEntry{}
+		err := dec.Decode(entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The replay has a single workspace, and the notifications of the
+		// workspaces can not be told apart after they are merged into it
+		if entry.Workspace != 0 {
+			return nil, fmt.Errorf("the recording has multiple workspaces, which can not be replayed: %s", path)
+		}
+		entry.Args = decodeRecordValue(entry.Args)
+		for key, option := range entry.Options {
+			entry.Options[key] = decodeRecordValue(option)
+		}
+		if entry.Kind == recordKindAttach && r.attach == nil {
+			r.attach = entry
+		}
+		r.entries = append(r.entries, entry)
+	}
+	if len(r.entries) == 0 {
+		return nil, errors.New("no entries in the recording: " + path)
+	}
+	if r.attach == nil {
+		return nil, errors.New("no attach options in the recording: " + path)
+	}
+
+	return r, nil
+}
+
+// recordFixedOptions is the attach options goneovim always enables, the
+// recording attached without them can not be replayed
+var recordFixedOptions = []string{"rgb", "ext_multigrid", "ext_hlstate"}
+
+// applyAttachOption makes the ui extensions the same as the recording.
+// It returns an error if the recording was attached with the options which
+// goneovim can not render.
+func (r *Recording) applyAttachOption() error {
+	for _, key := range recordFixedOptions {
+		b, ok := r.attach.Options[key].(bool)
+		if !ok || !b {
+			return fmt.Errorf("the recording was attached without %s", key)
+		}
+	}
+	options := map[string]*bool{
+		"ext_cmdline":   &editor.config.Editor.ExtCmdline,
+		"ext_messages":  &editor.config.Editor.ExtMessages,
+		"ext_popupmenu": &editor.config.Editor.ExtPopupmenu,
+		"ext_tabline":   &editor.config.Editor.ExtTabline,
+	}
+	for key, value := range options {
+		b, ok := r.attach.Options[key].(bool)
+		*value = ok && b
+	}
+
+	return nil
+}
+
+// applyRecordedSize resizes the application window so that the workspace has
+// the grid size of the recording, and restores the state which goneovim got
+// from nvim when it attached.
+func (w *Workspace) applyRecordedSize(r *Recording) {
+	w.api5 = r.attach.API5
+	cols, rows := r.attach.Cols, r.attach.Rows
+	if cols <= 0 || rows <= 0 || w.screen == nil {
+		return
+	}
+	font := w.screen.font
+	dw := int(math.Ceil(float64(cols)*font.truewidth)) - w.screen.width
+	dh := rows*font.lineHeight - w.screen.height
+	if dw != 0 || dh != 0 {
+		editor.window.Resize2(editor.window.Width()+dw, editor.window.Height()+dh)
+		w.updateSize()
+	}
+	w.cols = cols
+	w.rows = rows
+}
+
+// redrawUpdates returns the updates of the redraw entry in the form the
+// redraw handler receives them
+func (e *RecordEntry) redrawUpdates() [][]interface{} {
+	args, ok := e.Args.([]interface{})
+	if !ok || e.Kind != recordKindRedraw {
+		return nil
+	}
+	updates := [][]interface{}{}
+	for _, arg := range args {
+		update, ok := arg.([]interface{})
+		if !ok {
+			continue
+		}
+		updates = append(updates, update)
+	}
+
+	return updates
+}
+
+// replay feeds the recording to the workspace with the recorded timing
+func (w *Workspace) replay(r *Recording) {
+	var last int64
+	for _, entry := range r.entries {
+		if entry.Time > last {
+			time.Sleep(time.Duration(entry.Time-last) * time.Microsecond)
+			last = entry.Time
+		}
+
+		switch entry.Kind {
+		case recordKindRedraw:
+			w.redrawQueue <- entry.redrawUpdates()
+		case recordKindGui:
+			args, ok := entry.Args.([]interface{})
+			if !ok {
+				continue
+			}
+			w.guiUpdates <- args
+			w.signal.GuiSignal()
+		}
+	}
+	editor.putLog("finished replaying", editor.opts.Replay)
+}
+
+// newReplayNvim returns a nvim client which is not connected to nvim.
+// Every request is answered with an error by the peer endpoint, so that
+// the UI does not block during the replay.
+func newReplayNvim() (*nvim.Nvim, error) {
+	conn, peerConn := net.Pipe()
+	peer, err := nvim.New(peerConn, peerConn, peerConn, log.Printf)
+	if err != nil {
+		return nil, err
+	}
+	go peer.Serve()
+
+	return nvim.New(conn, conn, conn, log.Printf)
+}
@@ -0,0 +1,140 @@
+package editor
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akiyosi/goneovim/grid"
+	"github.com/neovim/go-client/nvim"
+)
+
+func TestRecordValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{
+			"grid_line",
+			[]interface{}{
+				"grid_line",
+				[]interface{}{int64(2), int64(0), int64(3), []interface{}{[]interface{}{"a", int64(7), int64(2)}}},
+			},
+		},
+		{
+			"win_pos",
+			[]interface{}{
+				"win_pos",
+				[]interface{}{int64(4), nvim.Window(1000), int64(0), int64(0), int64(80), int64(24)},
+			},
+		},
+		{
+			"tabline_update",
+			[]interface{}{
+				"tabline_update",
+				[]interface{}{nvim.Tabpage(1), []interface{}{map[string]interface{}{"tab": nvim.Tabpage(1), "name": "foo"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(encodeRecordValue(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec := json.NewDecoder(strings.NewReader(string(b)))
+			dec.UseNumber()
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			if got := decodeRecordValue(v); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("decodeRecordValue() = %v, want %v", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestReplayRecording(t *testing.T) {
+	batches := [][][]interface{}{
+		{
+			{"grid_resize", []interface{}{int64(2), int64(6), int64(3)}},
+			{"hl_attr_define", []interface{}{int64(7), map[string]interface{}{"bold": true}, map[string]interface{}{}, []interface{}{}}},
+			{"grid_line",
+				[]interface{}{int64(2), int64(0), int64(0), []interface{}{[]interface{}{"a", int64(7)}, []interface{}{"b"}, []interface{}{" ", int64(0), int64(4)}}},
+				[]interface{}{int64(2), int64(1), int64(0), []interface{}{[]interface{}{"あ", int64(7)}, []interface{}{""}, []interface{}{"c"}}},
+			},
+		},
+		{
+			{"grid_scroll", []interface{}{int64(2), int64(0), int64(3), int64(0), int64(6), int64(1)}},
+			{"grid_line", []interface{}{int64(2), int64(2), int64(0), []interface{}{[]interface{}{"d", int64(7), int64(6)}}}},
+			{"win_pos", []interface{}{int64(2), nvim.Window(1000), int64(0), int64(0), int64(6), int64(3)}},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "goneovim.rec")
+	recorder, err := newRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := map[string]interface{}{"rgb": true, "ext_multigrid": true, "ext_hlstate": true}
+	recorder.attach(0, 6, 3, options, true)
+	for _, batch := range batches {
+		recorder.redraw(0, batch)
+	}
+	recorder.close()
+
+	recording, err := loadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recording.attach.Cols != 6 || recording.attach.Rows != 3 || !recording.attach.API5 {
+		t.Errorf("attach = %+v, want 6x3 with api5", recording.attach)
+	}
+	replayed := grid.NewModel()
+	for _, entry := range recording.entries {
+		for _, update := range entry.redrawUpdates() {
+			replayed.Apply(update)
+		}
+	}
+
+	want := grid.NewModel()
+	for _, batch := range batches {
+		for _, update := range batch {
+			want.Apply(update)
+		}
+	}
+	for _, id := range want.Grids() {
+		wg, _ := want.Grid(id)
+		rg, ok := replayed.Grid(id)
+		if !ok {
+			t.Fatalf("grid %d is not replayed", id)
+		}
+		if !reflect.DeepEqual(rg.Cells, wg.Cells) {
+			t.Errorf("grid %d: replayed cells differ from the recorded ones", id)
+		}
+	}
+	g, _ := replayed.Grid(2)
+	if c := g.Cell(2, 0); c == nil || c.Text != "d" || c.HlID != 7 {
+		t.Errorf("cell (2, 0) = %+v, want d with highlight 7", c)
+	}
+}
+
+func TestLoadRecordingMultipleWorkspaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goneovim.rec")
+	recorder, err := newRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := map[string]interface{}{"rgb": true, "ext_multigrid": true, "ext_hlstate": true}
+	recorder.attach(recorder.newWorkspaceID(), 80, 24, options, false)
+	recorder.attach(recorder.newWorkspaceID(), 80, 24, options, false)
+	recorder.close()
+
+	if _, err := loadRecording(path); err == nil {
+		t.Error("loadRecording() succeeded with multiple workspaces")
+	}
+}
@@ -0,0 +1,598 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/akiyosi/goneovim/grid"
+	"github.com/akiyosi/goneovim/util"
+)
+
+// redrawEvent is a redraw event decoded by the redraw worker
+type redrawEvent struct {
+	name string
+
+	// args is the typed arguments decoded by decodeRedrawArgs,
+	// e.g. []winPos for win_pos
+	args interface{}
+
+	// hlAttrDef is the highlights defined by the redraw model, which is set
+	// for hl_attr_define
+	hlAttrDef map[int]*Highlight
+
+	// damage is the part of the grids to repaint, which is set for flush
+	damage map[gridId]*gridDamage
+
+	// skipped is the errors of the malformed arguments which are skipped
+	skipped []error
+}
+
+// gridLine is a single grid_line event with the decoded cells
+type gridLine struct {
+	grid  gridId
+	row   int
+	col   int
+	cells []grid.LineCell
+}
+
+// gridResize is a single grid_resize event
+type gridResize struct {
+	grid gridId
+	cols int
+	rows int
+}
+
+// gridScroll is a single grid_scroll event
+type gridScroll struct {
+	grid  gridId
+	top   int
+	bot   int
+	left  int
+	right int
+	rows  int
+
+	// scrollback holds the rows scrolled out of the region for the smooth
+	// scroll, keyed by their position relative to the contents after the
+	// scroll
+	scrollback map[int][]*grid.Cell
+}
+
+// gridLayout is the layout of a grid which the redraw model computes from
+// the cells
+type gridLayout struct {
+	lenLine     []int
+	lenContent  []int
+	isPopupmenu bool
+	wb          int
+
+	drawn   bool
+	changed bool
+}
+
+// gridDamage is the part of a grid to repaint and the layout of the grid,
+// which the redraw model hands to the Qt thread at flush
+type gridDamage struct {
+	spans       []grid.Span
+	lenLine     []int
+	lenContent  []int
+	isPopupmenu bool
+	wb          int
+
+	// drawn is whether grid_line has drawn the grid since the last flush
+	drawn bool
+}
+
+// redrawModel applies the grid events to its own grid model and computes the
+// layout of the grids, so that the Qt thread only paints them. The changed
+// cells are copied to the model of the screen, which the Qt thread paints, at
+// flush, so that a paint never shows a batch applied halfway.
+// The redraw worker of a workspace uses it off the Qt thread, and the minimap
+// uses it on the Qt thread.
+type redrawModel struct {
+	s *Screen
+
+	// model is the grid model the events are applied to. Only the user of
+	// the redraw model accesses it.
+	model *grid.Model
+
+	// hlAttrDef is copied on every hl_attr_define, since the Qt thread reads
+	// the highlights handed to it without locking
+	hlAttrDef map[int]*Highlight
+
+	// foreground and background are the default colors set by
+	// default_colors_set, -1 if they are not set yet
+	foreground int
+	background int
+
+	widthOptions grid.WidthOptions
+	grids        map[gridId]*gridLayout
+}
+
+func newRedrawModel(s *Screen) *redrawModel {
+	return &redrawModel{
+		s:            s,
+		model:        grid.NewModel(),
+		foreground:   -1,
+		background:   -1,
+		widthOptions: grid.DefaultWidthOptions,
+		grids:        make(map[gridId]*gridLayout),
+	}
+}
+
+// decodeGridLine decodes the arguments of grid_line validated by
+// decodeRedrawEvent
+func decodeGridLine(tuples [][]interface{}) []gridLine {
+	lines := make([]gridLine, 0, len(tuples))
+	for _, a := range tuples {
+		gridid := util.ReflectToInt(a[0])
+		if isSkipGlobalId(gridid) {
+			continue
+		}
+		lines = append(lines, gridLine{
+			grid:  gridid,
+			row:   util.ReflectToInt(a[1]),
+			col:   util.ReflectToInt(a[2]),
+			cells: grid.DecodeLine(a[3].([]interface{})),
+		})
+	}
+
+	return lines
+}
+
+// decodeGridResize decodes the arguments of grid_resize validated by
+// decodeRedrawEvent
+func decodeGridResize(tuples [][]interface{}) ([]gridResize, []error) {
+	resizes := make([]gridResize, 0, len(tuples))
+	var skipped []error
+	for i, a := range tuples {
+		gridid := util.ReflectToInt(a[0])
+		if isSkipGlobalId(gridid) {
+			continue
+		}
+		rs := gridResize{
+			grid: gridid,
+			cols: util.ReflectToInt(a[1]),
+			rows: util.ReflectToInt(a[2]),
+		}
+		if rs.cols < 0 || rs.rows < 0 {
+			skipped = append(skipped, fmt.Errorf("argument %d: invalid size %dx%d", i, rs.cols, rs.rows))
+			continue
+		}
+		resizes = append(resizes, rs)
+	}
+
+	return resizes, skipped
+}
+
+// decodeGridScroll decodes the arguments of grid_scroll validated by
+// decodeRedrawEvent
+func decodeGridScroll(tuples [][]interface{}) []gridScroll {
+	scrolls := make([]gridScroll, 0, len(tuples))
+	for _, a := range tuples {
+		gridid := util.ReflectToInt(a[0])
+		if isSkipGlobalId(gridid) {
+			continue
+		}
+		scrolls = append(scrolls, gridScroll{
+			grid:  gridid,
+			top:   util.ReflectToInt(a[1]),
+			bot:   util.ReflectToInt(a[2]),
+			left:  util.ReflectToInt(a[3]),
+			right: util.ReflectToInt(a[4]),
+			rows:  util.ReflectToInt(a[5]),
+		})
+	}
+
+	return scrolls
+}
+
+// decodeRedraw decodes the redraw notifications pushed to redrawQueue in a
+// goroutine other than the Qt thread, and applies the grid events to the grid
+// model of the redraw model. The events are collected until flush and handed
+// to the Qt thread as a batch with the damage of the grids, so that the Qt
+// thread only paints.
+func (w *Workspace) decodeRedraw() {
+	r := w.screen.redraw
+	var batch []redrawEvent
+	for {
+		select {
+		case <-w.stop:
+			return
+		case updates := <-w.redrawQueue:
+			for _, update := range updates {
+				event, err := decodeRedrawEvent(update)
+				if err != nil {
+					editor.putLog("skip malformed redraw event:", err)
+					continue
+				}
+				for _, err := range event.skipped {
+					editor.putLog("skip malformed redraw event argument:", err)
+				}
+				r.apply(&event)
+				batch = append(batch, event)
+
+				if event.name != "flush" {
+					continue
+				}
+				select {
+				case w.redrawUpdates <- batch:
+				case <-w.stop:
+					return
+				}
+				w.signal.RedrawSignal()
+				batch = nil
+			}
+		}
+	}
+}
+
+// apply applies the event to the grid model of the redraw model. The results
+// the Qt thread needs, such as the highlights and the damage at flush, are
+// set to the event.
+func (r *redrawModel) apply(e *redrawEvent) {
+	switch e.name {
+	case "option_set":
+		r.setOption(e.args.([]optionSet))
+	case "default_colors_set":
+		for _, c := range e.args.([]defaultColorsSet) {
+			r.foreground = c.fg
+			r.background = c.bg
+		}
+	case "hl_attr_define":
+		e.hlAttrDef = r.defineHighlights(e.args.([]hlAttrDefine))
+	case "grid_resize":
+		for _, rs := range e.args.([]gridResize) {
+			r.resize(rs)
+		}
+	case "grid_clear":
+		for _, gridid := range e.args.([]gridId) {
+			r.clear(gridid)
+		}
+	case "grid_destroy":
+		for _, gridid := range e.args.([]gridId) {
+			if isSkipGlobalId(gridid) {
+				continue
+			}
+			r.model.Destroy(gridid)
+			delete(r.grids, gridid)
+		}
+	case "grid_line":
+		for _, line := range e.args.([]gridLine) {
+			r.putLine(line)
+		}
+	case "grid_scroll":
+		scrolls := e.args.([]gridScroll)
+		for i := range scrolls {
+			r.scroll(&scrolls[i])
+		}
+	case "flush":
+		e.damage = r.takeDamage()
+	}
+}
+
+func (r *redrawModel) setOption(options []optionSet) {
+	for _, o := range options {
+		switch o.name {
+		case "ambiwidth":
+			r.widthOptions.AmbiwidthDouble = o.str == "double"
+		case "emoji":
+			r.widthOptions.Emoji = o.flag
+		}
+	}
+}
+
+// defineHighlights defines the highlights in the grid model and returns a
+// copy of the highlights to render which includes them
+func (r *redrawModel) defineHighlights(defines []hlAttrDefine) map[int]*Highlight {
+	h := make(map[int]*Highlight, len(r.hlAttrDef)+len(defines))
+	for id, hl := range r.hlAttrDef {
+		h[id] = hl
+	}
+
+	h[0] = &Highlight{
+		foreground: r.s.ws.foreground,
+		background: r.s.ws.background,
+	}
+
+	// Cells refer to the highlight by its id,
+	// so redefined highlights are applied to all cells.
+	for _, d := range defines {
+		r.model.SetHighlight(d.id, d.hl)
+		h[d.id] = r.s.getHighlight(d.hl)
+	}
+	r.hlAttrDef = h
+
+	return h
+}
+
+func (r *redrawModel) resize(rs gridResize) {
+	gridid, cols, rows := rs.grid, rs.cols, rs.rows
+	content := r.model.Resize(gridid, cols, rows)
+	if gridid == 1 {
+		content.Clear()
+	}
+	content.IsNormalWidth = func(text string) bool {
+		return r.isNormalWidth(gridid, text)
+	}
+
+	layout := &gridLayout{
+		lenLine:    make([]int, rows),
+		lenContent: make([]int, rows),
+		changed:    true,
+	}
+	for i := 0; i < rows; i++ {
+		layout.lenContent[i] = cols - 1
+	}
+	if old, ok := r.grids[gridid]; ok && gridid != 1 {
+		copy(layout.lenLine, old.lenLine)
+		copy(layout.lenContent, old.lenContent)
+		layout.isPopupmenu = old.isPopupmenu
+		layout.wb = old.wb
+	}
+	r.grids[gridid] = layout
+}
+
+func (r *redrawModel) clear(gridid gridId) {
+	layout, ok := r.grids[gridid]
+	if !ok {
+		return
+	}
+	content, ok := r.model.Clear(gridid)
+	if !ok {
+		return
+	}
+	for i := range layout.lenLine {
+		layout.lenLine[i] = 0
+		layout.lenContent[i] = content.Cols - 1
+	}
+	layout.changed = true
+}
+
+func (r *redrawModel) putLine(line gridLine) {
+	layout, ok := r.grids[line.grid]
+	if !ok {
+		return
+	}
+	content, _ := r.model.Grid(line.grid)
+
+	// We should control to draw statusline, vsplitter
+	if editor.config.Editor.DrawWindowSeparator && line.grid == 1 && r.s.name != "minimap" {
+		// Draw bottom statusline and tabline
+		if line.row != content.Rows-2 && line.row != 0 {
+			return
+		}
+	}
+
+	colEnd, ok := content.SetLine(line.row, line.col, line.cells)
+	if !ok {
+		return
+	}
+
+	cells := content.Cells[line.row]
+	for x := line.col; x < colEnd; x++ {
+		hl, ok := r.model.Highlight(cells[x].HlID)
+		if !ok {
+			continue
+		}
+
+		// Detect popupmenu
+		if hl.UIName == "Pmenu" ||
+			hl.UIName == "PmenuSel" ||
+			hl.UIName == "PmenuSbar" {
+			layout.isPopupmenu = true
+		}
+
+		// Detect winblend
+		if hl.Blend > 0 {
+			layout.wb = hl.Blend
+		}
+	}
+
+	r.countContent(content, layout, line.row)
+	layout.drawn = true
+	layout.changed = true
+}
+
+// scroll scrolls the region of the grid, bot and right are exclusive.
+func (r *redrawModel) scroll(sc *gridScroll) {
+	layout, ok := r.grids[sc.grid]
+	if !ok {
+		return
+	}
+	content, _ := r.model.Grid(sc.grid)
+
+	top, bot, left, right := sc.top, sc.bot, sc.left, sc.right
+	if top == 0 && bot == 0 && left == 0 && right == 0 {
+		bot = content.Rows
+		right = content.Cols
+	}
+	if top < 0 {
+		top = 0
+	}
+	if bot > content.Rows {
+		bot = content.Rows
+	}
+	if left < 0 {
+		left = 0
+	}
+	if right > content.Cols {
+		right = content.Cols
+	}
+	if top >= bot || left >= right {
+		return
+	}
+
+	if editor.config.Editor.SmoothScroll && r.s.name != "minimap" && left == 0 && right >= content.Cols {
+		sc.scrollback = make(map[int][]*grid.Cell)
+		for row := top; row < bot; row++ {
+			if (sc.rows > 0 && row >= top+sc.rows) || (sc.rows < 0 && row < bot+sc.rows) {
+				continue
+			}
+			// The cells are copied, since the Qt thread reads them while
+			// the model is updated
+			line := make([]*grid.Cell, len(content.Cells[row]))
+			for x, c := range content.Cells[row] {
+				if c != nil {
+					cell := *c
+					line[x] = &cell
+				}
+			}
+			sc.scrollback[row-sc.rows] = line
+		}
+	}
+
+	content.Scroll(top, bot, left, right, sc.rows)
+	for row := top; row < bot; row++ {
+		r.countContent(content, layout, row)
+	}
+	layout.changed = true
+}
+
+// countContent counts the columns up to the last non blank cell of the row,
+// and the columns up to the last cell which has to be painted
+func (r *redrawModel) countContent(content *grid.Grid, layout *gridLayout, row int) {
+	line := content.Cells[row]
+	lenLine := len(line) - 1
+	width := len(line) - 1
+	var breakFlag [2]bool
+	for j := len(line) - 1; j >= 0; j-- {
+		cell := line[j]
+
+		if !breakFlag[0] {
+			if cell == nil {
+				lenLine--
+			} else if cell.Text == " " {
+				lenLine--
+			} else {
+				breakFlag[0] = true
+			}
+		}
+
+		if !breakFlag[1] {
+			if cell == nil {
+				width--
+			} else if cell.Text == " " && r.hasDefaultBackground(cell) {
+				width--
+			} else {
+				breakFlag[1] = true
+			}
+		}
+
+		if breakFlag[0] && breakFlag[1] {
+			break
+		}
+	}
+	lenLine++
+	width++
+
+	layout.lenLine[row] = lenLine
+	layout.lenContent[row] = width
+}
+
+// hasDefaultBackground reports whether the cell is painted with the default
+// background color
+func (r *redrawModel) hasDefaultBackground(c *grid.Cell) bool {
+	hl, ok := r.model.Highlight(c.HlID)
+	if !ok {
+		return true
+	}
+	fg, bg := hl.Foreground, hl.Background
+	if fg == -1 {
+		fg = r.foreground
+	}
+	if bg == -1 {
+		bg = r.background
+	}
+	if hl.Reverse {
+		bg = fg
+	}
+
+	return bg == r.background
+}
+
+// isNormalWidth reports whether the text of a cell of the grid is drawn in
+// exactly one cell with the font of the window
+func (r *redrawModel) isNormalWidth(gridid gridId, text string) bool {
+	if len(text) == 0 {
+		return true
+	}
+
+	// if ASCII
+	if text[0] <= 127 {
+		return true
+	}
+
+	// if wide characters such as CJK characters and emoji
+	if grid.ClusterWidth(text, r.widthOptions) != 1 {
+		return false
+	}
+
+	font := r.s.font
+	if win, ok := r.s.getWindow(gridid); ok {
+		win.propMutex.RLock()
+		if win.font != nil {
+			font = win.font
+		}
+		win.propMutex.RUnlock()
+	}
+
+	return font.isNormalWidth(text)
+}
+
+// takeDamage copies the grids which have been changed since the last flush to
+// the model of the screen, and returns their damage and layout
+func (r *redrawModel) takeDamage() map[gridId]*gridDamage {
+	r.s.modelMutex.Lock()
+	defer r.s.modelMutex.Unlock()
+
+	for _, gridid := range r.s.model.Grids() {
+		if _, ok := r.grids[gridid]; !ok {
+			r.s.model.Destroy(gridid)
+		}
+	}
+
+	damage := make(map[gridId]*gridDamage)
+	for gridid, layout := range r.grids {
+		content, ok := r.model.Grid(gridid)
+		if !ok {
+			continue
+		}
+		spans := content.TakeDamage()
+		if len(spans) == 0 && !layout.changed {
+			continue
+		}
+		r.publish(content, spans)
+
+		d := &gridDamage{
+			spans:       spans,
+			lenLine:     make([]int, len(layout.lenLine)),
+			lenContent:  make([]int, len(layout.lenContent)),
+			isPopupmenu: layout.isPopupmenu,
+			wb:          layout.wb,
+			drawn:       layout.drawn,
+		}
+		copy(d.lenLine, layout.lenLine)
+		copy(d.lenContent, layout.lenContent)
+		damage[gridid] = d
+
+		layout.drawn = false
+		layout.changed = false
+	}
+
+	return damage
+}
+
+// publish copies the cells in the spans of content to the grid of the same id
+// in the model of the screen. The whole grid is copied if the size differs.
+func (r *redrawModel) publish(content *grid.Grid, spans []grid.Span) {
+	painted, ok := r.s.model.Grid(content.ID)
+	if !ok || painted.Cols != content.Cols || painted.Rows != content.Rows {
+		painted = r.s.model.Resize(content.ID, content.Cols, content.Rows)
+		spans = make([]grid.Span, content.Rows)
+		for row := range spans {
+			spans[row] = grid.Span{Row: row, Start: 0, End: content.Cols}
+		}
+	}
+	painted.CopySpans(content, spans)
+	// The damage is handed to the Qt thread with the one of content
+	painted.TakeDamage()
+}
@@ -0,0 +1,235 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/akiyosi/goneovim/grid"
+)
+
+func TestRedrawModelDamage(t *testing.T) {
+	s := &Screen{
+		ws:    &Workspace{},
+		model: grid.NewModel(),
+	}
+	s.redraw = newRedrawModel(s)
+	apply := func(update ...interface{}) redrawEvent {
+		e, err := decodeRedrawEvent(update)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.redraw.apply(&e)
+		return e
+	}
+
+	apply("default_colors_set", []interface{}{int64(0xffffff), int64(0), int64(-1)})
+	e := apply("hl_attr_define", []interface{}{
+		int64(7),
+		map[string]interface{}{"background": int64(0xff0000)},
+		map[string]interface{}{},
+		[]interface{}{},
+	})
+	if e.hlAttrDef[0] == nil || e.hlAttrDef[7] == nil {
+		t.Fatalf("highlights are not defined: %v", e.hlAttrDef)
+	}
+
+	apply("grid_resize", []interface{}{int64(2), int64(10), int64(3)})
+	if _, ok := s.model.Grid(2); ok {
+		t.Fatal("the grid is painted before flush")
+	}
+	e = apply("flush")
+	d, ok := e.damage[2]
+	if !ok || len(d.spans) != 3 {
+		t.Fatalf("resized grid is not damaged: %v", e.damage)
+	}
+	if !reflect.DeepEqual(d.lenContent, []int{9, 9, 9}) {
+		t.Errorf("lenContent = %v", d.lenContent)
+	}
+
+	apply("grid_line", []interface{}{int64(2), int64(1), int64(2), []interface{}{
+		[]interface{}{"a", int64(0)},
+		[]interface{}{" ", int64(7), int64(2)},
+	}})
+	painted, ok := s.model.Grid(2)
+	if !ok {
+		t.Fatal("the grid is not painted at flush")
+	}
+	if painted.Cell(1, 2) != nil {
+		t.Fatal("the line is painted before flush")
+	}
+	e = apply("flush")
+	d, ok = e.damage[2]
+	if !ok {
+		t.Fatal("drawn grid is not damaged")
+	}
+	if want := []grid.Span{{Row: 1, Start: 2, End: 5}}; !reflect.DeepEqual(d.spans, want) {
+		t.Errorf("spans = %v, want %v", d.spans, want)
+	}
+	if !d.drawn {
+		t.Error("drawn is not set")
+	}
+	if got := painted.Text(1); got != "  a       " {
+		t.Errorf("painted text = %q", got)
+	}
+	if d.lenLine[1] != 3 {
+		t.Errorf("lenLine = %d, want 3", d.lenLine[1])
+	}
+	// The spaces with the non default background have to be painted
+	if d.lenContent[1] != 5 {
+		t.Errorf("lenContent = %d, want 5", d.lenContent[1])
+	}
+
+	apply("grid_scroll", []interface{}{int64(2), int64(0), int64(3), int64(0), int64(10), int64(1)})
+	e = apply("flush")
+	d = e.damage[2]
+	if d.lenLine[0] != 3 || d.lenLine[1] != 0 {
+		t.Errorf("lenLine after scroll = %v", d.lenLine)
+	}
+	if len(d.spans) != 3 {
+		t.Errorf("spans after scroll = %v", d.spans)
+	}
+
+	if e = apply("flush"); len(e.damage) != 0 {
+		t.Errorf("damage without changes = %v", e.damage)
+	}
+
+	apply("grid_destroy", []interface{}{int64(2)})
+	if _, ok := s.model.Grid(2); !ok {
+		t.Fatal("the grid is destroyed before flush")
+	}
+	apply("flush")
+	if _, ok := s.model.Grid(2); ok {
+		t.Error("the destroyed grid is still painted")
+	}
+}
+
+func TestRedrawModel_putLine(t *testing.T) {
+	type args struct {
+		col   int
+		row   int
+		cells []interface{}
+	}
+
+	// Def grid for test
+	gridid := 6
+	row := 1
+	rows := 2
+	cols := 5
+
+	s := &Screen{
+		ws:    &Workspace{},
+		model: grid.NewModel(),
+	}
+	r := newRedrawModel(s)
+	r.resize(gridResize{grid: gridid, cols: cols, rows: rows})
+
+	// Def tests
+	tests := []struct {
+		name string
+		args args
+		want []grid.Cell
+	}{
+		{
+			"test_putline() 1",
+			args{
+				col: 0,
+				row: row,
+				cells: []interface{}{
+					[]interface{}{"~", 7},
+					[]interface{}{" ", 7, 4},
+				},
+			},
+			[]grid.Cell{
+				{Text: "~", HlID: 7, NormalWidth: true},
+				{Text: " ", HlID: 7, NormalWidth: true},
+				{Text: " ", HlID: 7, NormalWidth: true},
+				{Text: " ", HlID: 7, NormalWidth: true},
+				{Text: " ", HlID: 7, NormalWidth: true},
+			},
+		},
+		{
+			"test_putline() 2",
+			args{
+				col: 3,
+				row: row,
+				cells: []interface{}{
+					[]interface{}{"*", 6, 2},
+				},
+			},
+			[]grid.Cell{
+				{Text: "~", HlID: 7, NormalWidth: true},
+				{Text: " ", HlID: 7, NormalWidth: true},
+				{Text: " ", HlID: 7, NormalWidth: true},
+				{Text: "*", HlID: 6, NormalWidth: true},
+				{Text: "*", HlID: 6, NormalWidth: true},
+			},
+		},
+		{
+			"test_putline() 3",
+			args{
+				col: 1,
+				row: row,
+				cells: []interface{}{
+					[]interface{}{"@", 6},
+					[]interface{}{"v"},
+					[]interface{}{"i"},
+					[]interface{}{"m"},
+				},
+			},
+			[]grid.Cell{
+				{Text: "~", HlID: 7, NormalWidth: true},
+				{Text: "@", HlID: 6, NormalWidth: true},
+				{Text: "v", HlID: 6, NormalWidth: true},
+				{Text: "i", HlID: 6, NormalWidth: true},
+				{Text: "m", HlID: 6, NormalWidth: true},
+			},
+		},
+		{
+			"test_putline() 4",
+			args{
+				col: 0,
+				row: row,
+				cells: []interface{}{
+					[]interface{}{" ", 7, 2},
+					[]interface{}{"J"},
+				},
+			},
+			[]grid.Cell{
+				{Text: " ", HlID: 7, NormalWidth: true},
+				{Text: " ", HlID: 7, NormalWidth: true},
+				{Text: "J", HlID: 7, NormalWidth: true},
+				{Text: "i", HlID: 6, NormalWidth: true},
+				{Text: "m", HlID: 6, NormalWidth: true},
+			},
+		},
+	}
+
+	// Do tests. The cases are applied in order to the same grid.
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r.putLine(gridLine{
+				grid:  gridid,
+				row:   tt.args.row,
+				col:   tt.args.col,
+				cells: grid.DecodeLine(tt.args.cells),
+			})
+
+			content, _ := r.model.Grid(gridid)
+			for i, cell := range content.Cells[row] {
+				if cell == nil {
+					continue
+				}
+				if cell.Text != tt.want[i].Text {
+					t.Errorf("col: %v, actual: %v, want: %v", i, cell.Text, tt.want[i].Text)
+				}
+				if cell.HlID != tt.want[i].HlID {
+					t.Errorf("col: %v, actual: %v, want: %v", i, cell.HlID, tt.want[i].HlID)
+				}
+				if cell.NormalWidth != tt.want[i].NormalWidth {
+					t.Errorf("col: %v, actual: %v, want: %v", i, cell.NormalWidth, tt.want[i].NormalWidth)
+				}
+			}
+		})
+	}
+}
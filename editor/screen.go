@@ -10,9 +10,9 @@ import (
 	"strings"
 	"sync"
 	"time"
-	"unicode"
 	"unsafe"
 
+	"github.com/akiyosi/goneovim/grid"
 	"github.com/akiyosi/goneovim/util"
 	"github.com/bluele/gcache"
 	"github.com/neovim/go-client/nvim"
@@ -42,14 +42,20 @@ type Highlight struct {
 	bold          bool
 	underline     bool
 	undercurl     bool
+	underdouble   bool
+	underdotted   bool
+	underdashed   bool
 	blend         int
 	strikethrough bool
+	altfont       bool
+	nocombine     bool
 }
 
 // HlChars is used in screen cache
 type HlChars struct {
-	text string
-	fg   *RGBA
+	text     string
+	features string
+	fg       *RGBA
 	// bg     *RGBA
 	italic bool
 	bold   bool
@@ -58,18 +64,15 @@ type HlChars struct {
 // HlDecoration is used in screen cache
 type HlDecoration struct {
 	fg            *RGBA
+	sp            *RGBA
 	underline     bool
 	undercurl     bool
+	underdouble   bool
+	underdotted   bool
+	underdashed   bool
 	strikethrough bool
 }
 
-// Cell is
-type Cell struct {
-	normalWidth bool
-	char        string
-	highlight   *Highlight
-}
-
 type IntInt [2]int
 
 // ExternalWin is
@@ -82,16 +85,12 @@ type Window struct {
 	widgets.QWidget
 	_ float64 `property:"scrollDiff"`
 
-	snapshots [2]*gui.QPixmap
-
 	paintMutex  sync.RWMutex
 	redrawMutex sync.Mutex
 	updateMutex sync.RWMutex
 
-	doErase bool
-
 	s             *Screen
-	content       [][]*Cell
+	content       *grid.Grid
 	lenLine       []int
 	lenContent    []int
 	lenOldContent []int
@@ -116,14 +115,20 @@ type Window struct {
 	isExternal  bool
 	isPopupmenu bool
 
-	scrollRegion    []int
-	queueRedrawArea [4]int
-
 	scrollPixels       [2]int
 	scrollPixelsDeltaY int
 	isWheelScrolling   bool
 	scrollPixels2      int
-	scrollCols         int
+
+	// smooth scroll
+	topline         int
+	scrollDelta     int
+	scrollRows      int
+	scrollback      map[int][]*grid.Cell
+	scrollAnimation *core.QPropertyAnimation
+
+	// damage is the part of the grid to be repainted by update
+	damage []grid.Span
 
 	devicePixelRatio float64
 	fgCache          Cache
@@ -161,12 +166,21 @@ type Screen struct {
 
 	cursor [2]int
 
+	// modelMutex guards the grids of model, which the redraw model updates
+	// at flush while the Qt thread paints them
+	modelMutex     sync.RWMutex
+	model          *grid.Model
+	redraw         *redrawModel
 	hlAttrDef      map[int]*Highlight
 	highlightGroup map[string]int
 
 	tooltip *widgets.QLabel
 
+	selection     Selection
+	separatorDrag *SeparatorDrag
+
 	fgCache Cache
+	atlas   *GlyphAtlas
 
 	resizeCount uint
 }
@@ -184,9 +198,11 @@ func newScreen() *Screen {
 		widget:         widget,
 		windows:        sync.Map{},
 		cursor:         [2]int{0, 0},
+		model:          grid.NewModel(),
 		highlightGroup: make(map[string]int),
 		fgCache:        newCache(),
 	}
+	screen.redraw = newRedrawModel(screen)
 
 	widget.SetAcceptDrops(true)
 	widget.ConnectDragEnterEvent(screen.dragEnterEvent)
@@ -416,7 +432,7 @@ func (s *Screen) lenWindows() int {
 	return length
 }
 
-func (s *Screen) gridFont(update interface{}) {
+func (s *Screen) gridFont(updateStr string) {
 
 	// Get current window
 	grid := s.ws.cursor.gridid
@@ -429,10 +445,6 @@ func (s *Screen) gridFont(update interface{}) {
 		return
 	}
 
-	updateStr, ok := update.(string)
-	if !ok {
-		return
-	}
 	if updateStr == "" {
 		return
 	}
@@ -467,7 +479,10 @@ func (s *Screen) gridFont(update interface{}) {
 	win.height = oldHeight
 	win.localWindows = &[4]localWindow{}
 
+	win.propMutex.Lock()
 	win.font = initFontNew(fontfamily, float64(height), 1)
+	win.font.setFeatures(win.s.ws.font.features)
+	win.propMutex.Unlock()
 
 	// Calculate new cols, rows of current grid
 	newCols := int(oldWidth / win.font.truewidth)
@@ -498,6 +513,10 @@ func (s *Screen) purgeTextCacheForWins() {
 		return
 	}
 	s.fgCache.purge()
+	if s.atlas != nil {
+		s.atlas.logStats("purge")
+		s.atlas.clear()
+	}
 	s.windows.Range(func(_, winITF interface{}) bool {
 		win := winITF.(*Window)
 		if win == nil {
@@ -609,11 +628,6 @@ func (w *Window) paint(event *gui.QPaintEvent) {
 	w.paintMutex.Lock()
 
 	p := gui.NewQPainter2(w)
-	if w.doErase {
-		p.EraseRect3(w.Rect())
-		p.DestroyQPainter()
-		return
-	}
 	font := w.getFont()
 
 	// Set devicePixelRatio if it is not set
@@ -621,24 +635,29 @@ func (w *Window) paint(event *gui.QPaintEvent) {
 		w.devicePixelRatio = float64(p.PaintEngine().PaintDevice().DevicePixelRatio())
 	}
 
+	w.s.modelMutex.RLock()
+	defer w.s.modelMutex.RUnlock()
+
 	rect := event.Rect()
-	col := int(float64(rect.Left()) / font.truewidth)
-	row := int(float64(rect.Top()) / float64(font.lineHeight))
-	cols := int(math.Ceil(float64(rect.Width()) / font.truewidth))
-	rows := int(math.Ceil(float64(rect.Height()) / float64(font.lineHeight)))
-
-	// Draw contents
-	for y := row; y < row+rows; y++ {
-		if y >= w.rows {
-			continue
+	col, row, cols, rows := w.rectToCells(rect)
+
+	// Draw contents only in the damaged regions,
+	// not in the whole bounding rectangle of them.
+	// The rows out of the grid are the rows scrolled out by the smooth scroll.
+	for _, r := range event.Region().Rects() {
+		rcol, rrow, rcols, rrows := w.rectToCells(r)
+		for y := rrow; y < rrow+rrows; y++ {
+			if w.lineAt(y) == nil {
+				continue
+			}
+			w.drawBackground(p, y, rcol, rcols)
+			w.drawForeground(p, y, rcol, rcols)
 		}
-		w.drawBackground(p, y, col, cols)
-		w.drawForeground(p, y, col, cols)
 	}
-
-	// Draw scroll snapshot
-	// TODO: If there are wrapped lines in the viewport, the snapshot will be misaligned.
-	w.drawScrollSnapshot(p)
+	if row < 0 {
+		rows += row
+		row = 0
+	}
 
 	// TODO: We should use msgSepChar to separate message window area
 	// // If Window is Message Area, draw separator
@@ -651,6 +670,12 @@ func (w *Window) paint(event *gui.QPaintEvent) {
 		w.drawIndentguide(p, row, rows)
 	}
 
+	// Draw the text selection made while the mouse is disabled
+	w.drawSelection(p)
+
+	// Draw the border of the focused window
+	w.drawFocus(p)
+
 	// Draw float window border
 	if w.isFloatWin {
 		w.drawFloatWindowBorder(p)
@@ -675,37 +700,14 @@ func (w *Window) paint(event *gui.QPaintEvent) {
 	w.paintMutex.Unlock()
 }
 
-func (w *Window) drawScrollSnapshot(p *gui.QPainter) {
-	if !editor.config.Editor.SmoothScroll {
-		return
-	}
-	if w.s.name == "minimap" {
-		return
-	}
-
-	snapshot := w.snapshots[1]
-	if snapshot == nil {
-		snapshot = w.snapshots[0]
-	}
-	if snapshot == nil || editor.isKeyAutoRepeating {
-		return
+// lineAt returns the cells of row y. The rows out of the grid are the ones
+// scrolled out of it, which are shown while the smooth scroll is in progress.
+func (w *Window) lineAt(y int) []*grid.Cell {
+	if y >= 0 && y < len(w.content.Cells) {
+		return w.content.Cells[y]
 	}
 
-	font := w.getFont()
-	height := w.scrollCols * font.lineHeight
-	snapshotPos := 0
-	if w.scrollPixels2 > 0 {
-		snapshotPos = w.scrollPixels2 - height
-	} else if w.scrollPixels2 < 0 {
-		snapshotPos = height + w.scrollPixels2
-	}
-	if w.scrollPixels2 != 0 {
-		p.DrawPixmap9(
-			0,
-			snapshotPos,
-			snapshot,
-		)
-	}
+	return w.scrollback[y]
 }
 
 func (w *Window) getFont() *Font {
@@ -716,6 +718,12 @@ func (w *Window) getFont() *Font {
 	return w.font
 }
 
+// ligaturesEnabled returns false if the ligatures are turned off by
+// GonvimLigatures or DisableLigatures, or by the font features such as "-calt"
+func (w *Window) ligaturesEnabled() bool {
+	return w.s.ws.ligatures && w.getFont().ligatures
+}
+
 func (w *Window) getTS() int {
 	if w.ts <= 0 {
 		return w.s.ws.ts
@@ -748,7 +756,7 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 
 	headspaceOfRows := make(map[int]int)
 	for y := row; y < rows; y++ {
-		if y+1 >= len(w.content) {
+		if y+1 >= len(w.content.Cells) {
 			break
 		}
 		l, _ := w.countHeadSpaceOfLine(y)
@@ -757,11 +765,11 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 
 	drawIndents := make(map[IntInt]bool)
 	for y := row; y < rows; y++ {
-		if y+1 >= len(w.content) {
+		if y+1 >= len(w.content.Cells) {
 			break
 		}
 		// nextline := w.content[y+1]
-		line := w.content[y]
+		line := w.content.Cells[y]
 		res := 0
 		for x := 0; x < w.maxLenContent; x++ {
 			if x+1 >= len(line) {
@@ -774,10 +782,10 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 			if c == nil {
 				continue
 			}
-			if c.isSignColumn() {
+			if w.isSignColumn(c) {
 				res++
 			}
-			if c.char != " " && !c.isSignColumn() {
+			if c.Text != " " && !w.isSignColumn(c) {
 				break
 			}
 			// yylen, _ := w.countHeadSpaceOfLine(y)
@@ -790,7 +798,7 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 				}
 
 				doPaintIndent := false
-				for mm := y; mm < len(w.content); mm++ {
+				for mm := y; mm < len(w.content.Cells); mm++ {
 					if drawIndents[[2]int{x + 1, mm}] {
 						continue
 					}
@@ -807,7 +815,7 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 					}
 
 					if mmlen == w.cols && !doPaintIndent {
-						for nn := mm + 1; nn < len(w.content); nn++ {
+						for nn := mm + 1; nn < len(w.content.Cells); nn++ {
 							// nnlen, _ := w.countHeadSpaceOfLine(nn)
 							nnlen := headspaceOfRows[nn]
 							if nnlen == ylen {
@@ -829,22 +837,22 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 						// If the line to draw an indent-guide has a wrapped line
 						// in the next line, do not skip drawing
 						// TODO: We do not detect the wraped line when `:set nonu` setting.
-						if mm+1 < len(w.content) {
+						if mm+1 < len(w.content.Cells) {
 							// lllen, _ := w.countHeadSpaceOfLine(mm+1)
 							lllen := headspaceOfRows[mm+1]
 							if mm >= 0 {
 								if lllen > ylen {
 									for xx := 0; xx < w.lenLine[mm]; xx++ {
-										if xx >= len(w.content[mm]) {
+										if xx >= len(w.content.Cells[mm]) {
 											continue
 										}
-										if w.content[mm][xx] == nil {
+										if w.content.Cells[mm][xx] == nil {
 											continue
 										}
-										if w.content[mm][xx].highlight.hlName == "LineNr" {
-											if w.content[mm][xx].char == " " {
+										if w.cellHighlight(w.content.Cells[mm][xx]).hlName == "LineNr" {
+											if w.content.Cells[mm][xx].Text == " " {
 												doBreak = false
-											} else if w.content[mm][xx].char != " " {
+											} else if w.content.Cells[mm][xx].Text != " " {
 												doBreak = true
 												break
 											}
@@ -858,10 +866,10 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 						}
 					}
 
-					if w.content[mm][x+1] == nil {
+					if w.content.Cells[mm][x+1] == nil {
 						break
 					}
-					if w.content[mm][x+1].char != " " {
+					if w.content.Cells[mm][x+1].Text != " " {
 						break
 					}
 					if !doPaintIndent {
@@ -887,7 +895,7 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 					break
 				}
 			}
-			for y := w.s.cursor[0]; y < len(w.content); y++ {
+			for y := w.s.cursor[0]; y < len(w.content.Cells); y++ {
 				if drawIndents[[2]int{x + 1, y}] {
 					currentBlock[[2]int{x + 1, y}] = true
 				}
@@ -901,7 +909,7 @@ func (w *Window) drawIndentguide(p *gui.QPainter, row, rows int) {
 	}
 
 	// draw indent guide
-	for y := row; y < len(w.content); y++ {
+	for y := row; y < len(w.content.Cells); y++ {
 		for x := 0; x < w.maxLenContent; x++ {
 			if !drawIndents[[2]int{x + 1, y}] {
 				continue
@@ -1176,6 +1184,98 @@ func (w *Window) drawWindowSeparator(p *gui.QPainter, gwinrows int) {
 	}
 }
 
+// drawFocus draws the accent border around the current window if there are
+// other windows, see DimInactiveWindows
+func (w *Window) drawFocus(p *gui.QPainter) {
+	if !editor.config.Editor.DimInactiveWindows {
+		return
+	}
+	if !w.isFocusTarget() || w.grid != w.s.ws.cursor.bufferGridid {
+		return
+	}
+	if w.s.numOfNormalWindows() < 2 {
+		return
+	}
+	color := hexToRGBA(editor.config.SideBar.AccentColor).QColor()
+	width := w.Width()
+	height := w.Height()
+	border := 2
+	p.FillRect5(0, 0, width, border, color)
+	p.FillRect5(0, height-border, width, border, color)
+	p.FillRect5(0, 0, border, height, color)
+	p.FillRect5(width-border, 0, border, height, color)
+}
+
+// isFocusTarget reports whether the window is dimmed or bordered by
+// DimInactiveWindows, that is, it is a normal window of the editor.
+func (w *Window) isFocusTarget() bool {
+	return w.grid != 1 && !w.isMsgGrid && !w.isFloatWin && w.s.name != "minimap"
+}
+
+// isDimmed reports whether the window is drawn dimmed, see DimInactiveWindows
+func (w *Window) isDimmed() bool {
+	if !editor.config.Editor.DimInactiveWindows {
+		return false
+	}
+
+	return w.isFocusTarget() && w.grid != w.s.ws.cursor.bufferGridid
+}
+
+// dim returns the color to paint the cells of the window with. The colors of
+// the inactive windows are desaturated by DimInactiveDesaturation and blended
+// toward the default background by DimInactiveOpacity.
+func (w *Window) dim(color *RGBA) *RGBA {
+	if color == nil || !w.isDimmed() {
+		return color
+	}
+	bg := w.s.ws.background
+	if bg == nil {
+		bg = editor.colors.bg
+	}
+	hsv := color.HSV()
+	hsv.S *= 1.0 - editor.config.Editor.DimInactiveDesaturation
+	dimmed := hsv.RGB()
+	if bg != nil {
+		dimmed = dimmed.brend(bg, editor.config.Editor.DimInactiveOpacity)
+	}
+	dimmed.A = color.A
+
+	return dimmed
+}
+
+// numOfNormalWindows returns the number of the shown windows other than the
+// float windows and the message grid
+func (s *Screen) numOfNormalWindows() int {
+	n := 0
+	s.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win == nil || win.grid == 1 || win.isMsgGrid || win.isFloatWin {
+			return true
+		}
+		if win.isShown() {
+			n++
+		}
+
+		return true
+	})
+
+	return n
+}
+
+// updateFocus repaints the windows whose focus changed
+func (s *Screen) updateFocus(oldGrid, newGrid gridId) {
+	if !editor.config.Editor.DimInactiveWindows {
+		return
+	}
+	for _, gridid := range []gridId{oldGrid, newGrid} {
+		win, ok := s.getWindow(gridid)
+		if !ok {
+			continue
+		}
+		win.Update()
+	}
+}
+
 func (s *Screen) bottomWindowPos() int {
 	pos := 0
 	s.windows.Range(func(_, winITF interface{}) bool {
@@ -1209,11 +1309,14 @@ func (w *Window) wheelEvent(event *gui.QWheelEvent) {
 	font := w.getFont()
 
 	// Detect current mode
+	// If the mouse is disabled, the window is scrolled without leaving the current mode
 	mode := w.s.ws.mode
-	if mode == "terminal-input" {
-		w.s.ws.nvim.Input(`<C-\><C-n>`)
-	} else if mode != "normal" {
-		w.s.ws.nvim.Input(w.s.ws.escKeyInInsert)
+	if w.s.ws.mouseEnabled {
+		if mode == "terminal-input" {
+			w.s.ws.nvim.Input(`<C-\><C-n>`)
+		} else if mode != "normal" {
+			w.s.ws.nvim.Input(w.s.ws.escKeyInInsert)
+		}
 	}
 
 	pixels := event.PixelDelta()
@@ -1272,6 +1375,12 @@ func (w *Window) wheelEvent(event *gui.QWheelEvent) {
 		horizKey = "Right"
 	}
 
+	if !w.s.ws.mouseEnabled {
+		w.scrollView(vert)
+		event.Accept()
+		return
+	}
+
 	// If the window at the mouse pointer is not the current window
 	if w.grid != w.s.ws.cursor.gridid {
 		done := make(chan bool, 2)
@@ -1317,6 +1426,29 @@ func (w *Window) wheelEvent(event *gui.QWheelEvent) {
 	event.Accept()
 }
 
+// scrollView scrolls the window without moving the focus to it.
+// This is used while the mouse is disabled in neovim.
+func (w *Window) scrollView(vert int) {
+	if vert == 0 {
+		return
+	}
+	// <C-y> or <C-e>
+	key := "\x19"
+	if vert < 0 {
+		key = "\x05"
+	}
+	cmd := fmt.Sprintf("normal! %d%s", int(math.Abs(float64(vert))), key)
+	go w.s.ws.nvim.Call("win_execute", nil, int(w.id), cmd)
+}
+
+// scrollViewTo scrolls the window so that line is at the middle of it
+// without leaving the current mode, as the minimap click does.
+// This is used while the mouse is disabled in neovim.
+func (w *Window) scrollViewTo(line int) {
+	cmd := fmt.Sprintf("call winrestview({'topline': max([1, %d - winheight(0) / 2])})", line)
+	go w.s.ws.nvim.Call("win_execute", nil, int(w.id), cmd)
+}
+
 func (w *Window) smoothUpdate(v, h int, isStopScroll bool) (int, int) {
 	var vert, horiz int
 	font := w.getFont()
@@ -1373,7 +1505,14 @@ func (w *Window) smoothUpdate(v, h int, isStopScroll bool) (int, int) {
 }
 
 func (s *Screen) mousePressEvent(event *gui.QMouseEvent) {
+	// Dragging a window separator resizes the window
+	if s.startSeparatorDrag(event) {
+		return
+	}
 	s.mouseEvent(event)
+	if !s.ws.mouseEnabled {
+		return
+	}
 	if !editor.config.Editor.ClickEffect {
 		return
 	}
@@ -1467,6 +1606,15 @@ func (s *Screen) mousePressEvent(event *gui.QMouseEvent) {
 }
 
 func (s *Screen) mouseEvent(event *gui.QMouseEvent) {
+	if s.separatorDrag != nil {
+		s.dragSeparator(event)
+		return
+	}
+	// If the mouse is disabled in neovim, the mouse is used to select text to copy
+	if !s.ws.mouseEnabled {
+		s.selectionEvent(event)
+		return
+	}
 	inp := s.convertMouse(event)
 	if inp == "" {
 		return
@@ -1524,51 +1672,36 @@ func (s *Screen) convertMouse(event *gui.QMouseEvent) string {
 	return fmt.Sprintf("<%s%s%s><%d,%d>", editor.modPrefix(mod), buttonName, evType, pos[0], pos[1])
 }
 
-func (s *Screen) gridResize(args []interface{}) {
-	var gridid gridId
-	var rows, cols int
-	for _, arg := range args {
-		gridid = util.ReflectToInt(arg.([]interface{})[0])
-		cols = util.ReflectToInt(arg.([]interface{})[1])
-		rows = util.ReflectToInt(arg.([]interface{})[2])
+// gridResize creates or resizes the windows of the grids resized by the
+// redraw model
+func (s *Screen) gridResize(resizes []gridResize) {
+	for _, rs := range resizes {
+		s.resizeWindow(rs.grid, rs.cols, rs.rows, s.paintedGrid(rs.grid))
+	}
+}
 
-		if isSkipGlobalId(gridid) {
-			continue
-		}
+// paintedGrid returns the grid of the model the windows paint. The redraw
+// model copies the contents to it at flush, and an empty grid is created if
+// the grid has not been flushed yet.
+func (s *Screen) paintedGrid(gridid gridId) *grid.Grid {
+	s.modelMutex.Lock()
+	defer s.modelMutex.Unlock()
 
-		s.resizeWindow(gridid, cols, rows)
+	if content, ok := s.model.Grid(gridid); ok {
+		return content
 	}
+
+	return s.model.Resize(gridid, 0, 0)
 }
 
-func (s *Screen) resizeWindow(gridid gridId, cols int, rows int) {
+func (s *Screen) resizeWindow(gridid gridId, cols int, rows int, content *grid.Grid) {
 	win, _ := s.getWindow(gridid)
 
-	// make new size content
-	content := make([][]*Cell, rows)
-	lenLine := make([]int, rows)
-	lenContent := make([]int, rows)
+	// The length of the contents are computed by the redraw model,
+	// and set at flush
 	lenOldContent := make([]int, rows)
-
-	for i := 0; i < rows; i++ {
-		content[i] = make([]*Cell, cols)
-		lenContent[i] = cols - 1
-	}
-
 	if win != nil && gridid != 1 {
-		for i := 0; i < rows; i++ {
-			if i >= len(win.content) {
-				continue
-			}
-			lenLine[i] = win.lenLine[i]
-			lenContent[i] = win.lenContent[i]
-			lenOldContent[i] = win.lenOldContent[i]
-			for j := 0; j < cols; j++ {
-				if j >= len(win.content[i]) {
-					continue
-				}
-				content[i][j] = win.content[i][j]
-			}
-		}
+		copy(lenOldContent, win.lenOldContent)
 	}
 
 	if win == nil {
@@ -1601,8 +1734,6 @@ func (s *Screen) resizeWindow(gridid gridId, cols int, rows int) {
 	winOldCols := win.cols
 	winOldRows := win.rows
 
-	win.lenLine = lenLine
-	win.lenContent = lenContent
 	win.lenOldContent = lenOldContent
 	win.content = content
 	win.cols = cols
@@ -1786,12 +1917,12 @@ func (s *Screen) resizeIndependentFontGrid(win *Window, oldCols, oldRows int) {
 	})
 }
 
-func (s *Screen) gridCursorGoto(args []interface{}) {
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
+func (s *Screen) gridCursorGoto(gotos []gridCursorGoto) {
+	for _, g := range gotos {
+		gridid := g.grid
 
-		s.cursor[0] = util.ReflectToInt(arg.([]interface{})[1])
-		s.cursor[1] = util.ReflectToInt(arg.([]interface{})[2])
+		s.cursor[0] = g.row
+		s.cursor[1] = g.col
 		if isSkipGlobalId(gridid) {
 			continue
 		}
@@ -1800,189 +1931,98 @@ func (s *Screen) gridCursorGoto(args []interface{}) {
 		if !ok {
 			continue
 		}
+		s.ws.cursor.markGoto()
 
 		if s.ws.cursor.gridid != gridid {
 			if !win.isMsgGrid {
+				if s.ws.cursor.bufferGridid != gridid {
+					s.updateFocus(s.ws.cursor.bufferGridid, gridid)
+				}
 				s.ws.cursor.bufferGridid = gridid
 
 			}
 			s.ws.cursor.gridid = gridid
 			s.ws.cursor.font = win.getFont()
 			win.raise()
-
-			// reset smooth scroll scrolling offset
-			win.scrollPixels2 = 0
-
 		}
 	}
 }
 
-func (s *Screen) setHlAttrDef(args []interface{}) {
-	var h map[int]*Highlight
-	if s.hlAttrDef == nil {
-		h = make(map[int]*Highlight)
-	} else {
-		h = s.hlAttrDef
-	}
-
-	isUpdateBg := true
-	curwin, ok := s.getWindow(s.ws.cursor.gridid)
-	if ok {
-		isUpdateBg = !curwin.background.equals(editor.colors.bg)
-	}
-
-	h[0] = &Highlight{
-		foreground: editor.colors.fg,
-		background: editor.colors.bg,
-	}
-
-	for _, arg := range args {
-		id := util.ReflectToInt(arg.([]interface{})[0])
-		h[id] = s.getHighlight(arg)
-	}
-
-	s.hlAttrDef = h
-
-	// Update all cell's highlight
-	if isUpdateBg {
-		s.windows.Range(func(_, winITF interface{}) bool {
-			win := winITF.(*Window)
-			if win == nil {
-				return true
-			}
-			if !win.isShown() {
-				return true
-			}
-			if win.content == nil {
-				return true
-			}
-			for _, line := range win.content {
-				for _, cell := range line {
-					if cell != nil {
-						cell.highlight = s.hlAttrDef[cell.highlight.id]
-					}
-				}
-			}
-
-			return true
-		})
-	}
-}
-
-func (s *Screen) setHighlightGroup(args []interface{}) {
-	for _, arg := range args {
-		a := arg.([]interface{})
-		hlName := a[0].(string)
-		hlIndex := util.ReflectToInt(a[1])
-		s.highlightGroup[hlName] = hlIndex
+func (s *Screen) setHighlightGroup(groups []hlGroupSet) {
+	for _, group := range groups {
+		s.highlightGroup[group.name] = group.id
 	}
 }
 
-func (s *Screen) getHighlight(args interface{}) *Highlight {
-	arg := args.([]interface{})
-	highlight := Highlight{}
-
-	hl := arg[1].(map[string]interface{})
-	info := make(map[string]interface{})
-	for _, arg := range arg[3].([]interface{}) {
-		info = arg.(map[string]interface{})
-		break
-	}
-
-	kind, ok := info["kind"]
-	if ok {
-		highlight.kind = kind.(string)
-	}
-
-	id, ok := info["id"]
-	if ok {
-		highlight.id = util.ReflectToInt(id)
-	}
-
-	uiName, ok := info["ui_name"]
-	if ok {
-		highlight.uiName = uiName.(string)
-	}
-
-	hlName, ok := info["hi_name"]
-	if ok {
-		highlight.hlName = hlName.(string)
-	}
-
-	italic := hl["italic"]
-	if italic != nil {
-		highlight.italic = true
-	} else {
-		highlight.italic = false
-	}
-
-	bold := hl["bold"]
-	if bold != nil {
-		highlight.bold = true
-	} else {
-		highlight.bold = false
-	}
-
-	underline := hl["underline"]
-	if underline != nil {
-		highlight.underline = true
-	} else {
-		highlight.underline = false
-	}
-
-	undercurl := hl["undercurl"]
-	if undercurl != nil {
-		highlight.undercurl = true
-	} else {
-		highlight.undercurl = false
-	}
-
-	strikethrough := hl["strikethrough"]
-	if strikethrough != nil {
-		highlight.strikethrough = true
-	} else {
-		highlight.strikethrough = false
-	}
-
-	reverse := hl["reverse"]
-	if reverse != nil {
-		highlight.reverse = true
-	} else {
-		highlight.reverse = false
+// getHighlight converts the highlight of the grid model to the one to render
+func (s *Screen) getHighlight(hl *grid.Highlight) *Highlight {
+	highlight := Highlight{
+		id:            hl.ID,
+		kind:          hl.Kind,
+		uiName:        hl.UIName,
+		hlName:        hl.HiName,
+		italic:        hl.Italic,
+		bold:          hl.Bold,
+		underline:     hl.Underline,
+		undercurl:     hl.Undercurl,
+		underdouble:   hl.Underdouble,
+		underdotted:   hl.Underdotted,
+		underdashed:   hl.Underdashed,
+		strikethrough: hl.Strikethrough,
+		altfont:       hl.Altfont,
+		nocombine:     hl.Nocombine,
+		reverse:       hl.Reverse,
+		blend:         hl.Blend,
 	}
 
-	fg, ok := hl["foreground"]
-	if ok {
-		rgba := calcColor(util.ReflectToInt(fg))
-		highlight.foreground = rgba
+	if hl.Foreground != -1 {
+		highlight.foreground = calcColor(hl.Foreground)
 	}
 	if highlight.foreground == nil {
 		highlight.foreground = s.ws.foreground
 	}
 
-	bg, ok := hl["background"]
-	if ok {
-		rgba := calcColor(util.ReflectToInt(bg))
-		highlight.background = rgba
+	if hl.Background != -1 {
+		highlight.background = calcColor(hl.Background)
 	}
 	if highlight.background == nil {
 		highlight.background = s.ws.background
 	}
 
-	sp, ok := hl["special"]
-	if ok {
-		rgba := calcColor(util.ReflectToInt(sp))
-		highlight.special = rgba
+	if hl.Special != -1 {
+		highlight.special = calcColor(hl.Special)
 	}
 
-	bl, ok := hl["blend"]
-	if ok {
-		highlight.blend = util.ReflectToInt(bl)
-	}
+	return &highlight
+}
 
-	// TODO: brend, ok := hl["blend"]
+// hasDecoration reports whether the highlight draws lines over or under the text.
+// altfont and nocombine have no effect on drawing, nocombine is already
+// resolved by neovim when the attribute is defined.
+func (hl *Highlight) hasDecoration() bool {
+	return hl.underline || hl.undercurl || hl.underdouble || hl.underdotted || hl.underdashed || hl.strikethrough
+}
 
-	return &highlight
+// decoration returns the key of the decoration cache
+func (hl *Highlight) decoration() HlDecoration {
+	return HlDecoration{
+		fg:            hl.fg(),
+		sp:            hl.special,
+		underline:     hl.underline,
+		undercurl:     hl.undercurl,
+		underdouble:   hl.underdouble,
+		underdotted:   hl.underdotted,
+		underdashed:   hl.underdashed,
+		strikethrough: hl.strikethrough,
+	}
+}
+
+// decorationColor returns the special color, or the foreground color if special is not set
+func (hl *Highlight) decorationColor() *RGBA {
+	if hl.special != nil {
+		return hl.special
+	}
+	return hl.foreground
 }
 
 func (hl *Highlight) fg() *RGBA {
@@ -2023,438 +2063,214 @@ func (hl *Highlight) bg() *RGBA {
 	return color
 }
 
-func (s *Screen) gridClear(args []interface{}) {
-	var gridid gridId
-	for _, arg := range args {
-		gridid = util.ReflectToInt(arg.([]interface{})[0])
-		if isSkipGlobalId(gridid) {
+func (w *Window) countHeadSpaceOfLine(y int) (int, error) {
+	if w == nil {
+		return 0, errors.New("window is nil")
+	}
+	if w.content == nil || y >= len(w.content.Cells) {
+		return 0, errors.New("content is nil")
+	}
+	line := w.content.Cells[y]
+	count := 0
+	for _, c := range line {
+		if c == nil {
 			continue
 		}
 
-		win, ok := s.getWindow(gridid)
-		if !ok {
-			continue
+		if c.Text != " " && !w.isSignColumn(c) {
+			break
+		} else {
+			count++
 		}
-		win.content = make([][]*Cell, win.rows)
-		win.lenLine = make([]int, win.rows)
-		win.lenContent = make([]int, win.rows)
+	}
+	return count, nil
+}
 
-		for i := 0; i < win.rows; i++ {
-			win.content[i] = make([]*Cell, win.cols)
-			win.lenContent[i] = win.cols - 1
-		}
-		win.queueRedrawAll()
+// cellHighlight returns the highlight of the cell. The hl id which nvim has
+// not defined yet falls back to the default highlight.
+func (w *Window) cellHighlight(c *grid.Cell) *Highlight {
+	if hl := w.s.hlAttrDef[c.HlID]; hl != nil {
+		return hl
+	}
+	if hl := w.s.hlAttrDef[0]; hl != nil {
+		return hl
 	}
+
+	return &Highlight{}
 }
 
-func (s *Screen) gridLine(args []interface{}) {
-	var win *Window
-	var ok bool
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
-		row := util.ReflectToInt(arg.([]interface{})[1])
-		colStart := util.ReflectToInt(arg.([]interface{})[2])
+func (w *Window) isSignColumn(c *grid.Cell) bool {
+	switch w.cellHighlight(c).hlName {
+	case "SignColumn",
+		"FoldColumn",
+		"LineNr",
+		"CursorLineNr",
+		"ALEErrorSign",
+		"ALEStyleErrorSign",
+		"ALEWarningSign",
+		"ALEStyleWarningSign",
+		"ALEInfoSign",
+		"ALESignColumnWithErrors",
+		"LspErrorHighlight",
+		"LspWarningHighlight",
+		"LspInformationHighlight",
+		"LspHintHighlight":
+		return true
+	default:
+		return false
 
-		if isSkipGlobalId(gridid) {
+	}
+}
+
+// gridScroll keeps the rows scrolled out of the grids by the redraw model
+// for the smooth scroll
+func (s *Screen) gridScroll(scrolls []gridScroll) {
+	for _, sc := range scrolls {
+		win, ok := s.getWindow(sc.grid)
+		if !ok {
 			continue
 		}
+		if sc.scrollback != nil && !win.isMsgGrid {
+			win.keepScrollback(sc.scrollback, sc.rows)
+		}
 
-		if win == nil || win.grid != gridid {
-			win, ok = s.getWindow(gridid)
-			if !ok {
-				continue
-			}
+		// Suppresses flickering during smooth scrolling
+		if win.scrollPixels[1] != 0 {
+			win.scrollPixels[1] = 0
 		}
+	}
+}
 
-		win.updateGridContent(row, colStart, arg.([]interface{})[3].([]interface{}))
+// keepScrollback keeps the rows which are scrolled out of the region, so that
+// the smooth scroll can draw them while the contents slide. The rows are keyed
+// by their position relative to the contents after the scroll.
+func (w *Window) keepScrollback(lines map[int][]*grid.Cell, count int) {
+	scrollback := make(map[int][]*grid.Cell)
+	for y, line := range w.scrollback {
+		y -= count
+		if y >= 0 && y < w.rows {
+			continue
+		}
+		scrollback[y] = line
+	}
+	for y, line := range lines {
+		scrollback[y] = line
 	}
+	w.scrollback = scrollback
+	w.scrollRows += count
 }
 
-func (win *Window) updateGridContent(row, colStart int, cells []interface{}) {
-	if colStart < 0 {
-		return
+// stopSmoothScroll stops the smooth scroll in progress and drops the rows
+// scrolled out of the grid
+func (w *Window) stopSmoothScroll() {
+	if w.scrollAnimation != nil {
+		a := w.scrollAnimation
+		w.scrollAnimation = nil
+		a.Stop()
+	}
+	if w.scrollPixels2 != 0 {
+		w.scrollPixels2 = 0
+		w.Update()
 	}
+	w.scrollback = nil
+}
 
-	if row >= win.rows {
+func (w *Window) update() {
+	if w == nil {
 		return
 	}
+	w.redrawMutex.Lock()
+	font := w.getFont()
 
-	// Suppresses flickering during smooth scrolling
-	if win.scrollPixels[1] != 0 {
-		win.scrollPixels[1] = 0
+	damage := w.damage
+	w.damage = nil
+
+	// Repaint the whole window during smooth scrolling
+	if w.scrollPixels[1] != 0 {
+		damage = damage[:0]
+		for i := 0; i < w.rows; i++ {
+			damage = append(damage, grid.Span{Row: i, Start: 0, End: w.cols})
+		}
 	}
 
-	// We should control to draw statusline, vsplitter
-	if editor.config.Editor.DrawWindowSeparator && win.grid == 1 {
+	for _, span := range damage {
+		i := span.Row
+		if len(w.lenContent) <= i || len(w.lenOldContent) <= i {
+			continue
+		}
 
-		isSkipDraw := true
-		if win.s.name != "minimap" {
+		width := w.lenContent[i]
 
-			// Draw  bottom statusline
-			if row == win.rows-2 {
-				isSkipDraw = false
-			}
-			// Draw tabline
-			if row == 0 {
-				isSkipDraw = false
-			}
-
-			// // Do not Draw statusline of splitted window
-			// win.s.windows.Range(func(_, winITF interface{}) bool {
-			// 	w := winITF.(*Window)
-			// 	if w == nil {
-			// 		return true
-			// 	}
-			// 	if !w.isShown() {
-			// 		return true
-			// 	}
-			// 	if row == w.pos[1]-1 {
-			// 		isDraw = true
-			// 		return false
-			// 	}
-			// 	return true
-			// })
-		} else {
-			isSkipDraw = false
-		}
-
-		if isSkipDraw {
-			return
-		}
-	}
-
-	win.updateLine(colStart, row, cells)
-	win.countContent(row)
-	if !win.isShown() {
-		win.show()
-	}
-
-	if win.isMsgGrid {
-		return
-	}
-	if win.grid == 1 {
-		return
-	}
-	if win.maxLenContent < win.lenContent[row] {
-		win.maxLenContent = win.lenContent[row]
-	}
-}
-
-func (w *Window) updateLine(col, row int, cells []interface{}) {
-	w.updateMutex.Lock()
-	line := w.content[row]
-	colStart := col
-	for _, arg := range cells {
-		if col >= len(line) {
-			continue
-		}
-		cell := arg.([]interface{})
-
-		var hl, repeat int
-		hl = -1
-		text := cell[0]
-		if len(cell) >= 2 {
-			hl = util.ReflectToInt(cell[1])
-		}
-
-		if len(cell) == 3 {
-			repeat = util.ReflectToInt(cell[2])
-		}
-
-		// If `repeat` is present, the cell should be
-		// repeated `repeat` times (including the first time), otherwise just
-		// once.
-		r := 1
-		if repeat == 0 {
-			repeat = 1
-		}
-		for r <= repeat {
-			if col >= len(line) {
-				break
-			}
-
-			if line[col] == nil {
-				line[col] = &Cell{}
-			}
-
-			line[col].char = text.(string)
-			line[col].normalWidth = w.isNormalWidth(line[col].char)
-
-			// If `hl_id` is not present the most recently seen `hl_id` in
-			//	the same call should be used (it is always sent for the first
-			//	cell in the event).
-			switch col {
-			case 0:
-				line[col].highlight = w.s.hlAttrDef[hl]
-			default:
-				if hl == -1 {
-					line[col].highlight = line[col-1].highlight
-				} else {
-					line[col].highlight = w.s.hlAttrDef[hl]
-				}
-			}
-
-			// Detect popupmenu
-			if line[col].highlight.uiName == "Pmenu" ||
-				line[col].highlight.uiName == "PmenuSel" ||
-				line[col].highlight.uiName == "PmenuSbar" {
-				w.isPopupmenu = true
-			}
-
-			// Detect winblend
-			if line[col].highlight.blend > 0 {
-				w.wb = line[col].highlight.blend
-			}
-
-			col++
-			r++
-		}
-	}
-	w.updateMutex.Unlock()
-
-	w.queueRedraw(colStart, row, col-colStart+1, 1)
-}
-
-func (w *Window) countContent(row int) {
-	line := w.content[row]
-	lenLine := w.cols - 1
-	width := w.cols - 1
-	var breakFlag [2]bool
-	for j := w.cols - 1; j >= 0; j-- {
-		cell := line[j]
-
-		if !breakFlag[0] {
-			if cell == nil {
-				lenLine--
-			} else if cell.char == " " {
-				lenLine--
-			} else {
-				breakFlag[0] = true
-			}
-		}
-
-		if !breakFlag[1] {
-			if cell == nil {
-				width--
-			} else if cell.char == " " && cell.highlight.bg().equals(w.background) {
-				width--
-			} else {
-				breakFlag[1] = true
-			}
-		}
-
-		if breakFlag[0] && breakFlag[1] {
-			break
-		}
-	}
-	lenLine++
-	width++
-
-	w.lenLine[row] = lenLine
-	w.lenContent[row] = width
-}
-
-func (w *Window) countHeadSpaceOfLine(y int) (int, error) {
-	if w == nil {
-		return 0, errors.New("window is nil")
-	}
-	if y >= len(w.content) || w.content == nil {
-		return 0, errors.New("content is nil")
-	}
-	line := w.content[y]
-	count := 0
-	for _, c := range line {
-		if c == nil {
-			continue
-		}
-
-		if c.char != " " && !c.isSignColumn() {
-			break
-		} else {
-			count++
-		}
-	}
-	return count, nil
-}
-
-func (c *Cell) isSignColumn() bool {
-	switch c.highlight.hlName {
-	case "SignColumn",
-		"FoldColumn",
-		"LineNr",
-		"CursorLineNr",
-		"ALEErrorSign",
-		"ALEStyleErrorSign",
-		"ALEWarningSign",
-		"ALEStyleWarningSign",
-		"ALEInfoSign",
-		"ALESignColumnWithErrors",
-		"LspErrorHighlight",
-		"LspWarningHighlight",
-		"LspInformationHighlight",
-		"LspHintHighlight":
-		return true
-	default:
-		return false
-
-	}
-}
-
-func (s *Screen) gridScroll(args []interface{}) {
-	var gridid gridId
-	var rows int
-	for _, arg := range args {
-		gridid = util.ReflectToInt(arg.([]interface{})[0])
-		if isSkipGlobalId(gridid) {
-			continue
-		}
-
-		win, ok := s.getWindow(gridid)
-		if !ok {
-			continue
-		}
-		win.scrollRegion[0] = util.ReflectToInt(arg.([]interface{})[1])     // top
-		win.scrollRegion[1] = util.ReflectToInt(arg.([]interface{})[2]) - 1 // bot
-		win.scrollRegion[2] = util.ReflectToInt(arg.([]interface{})[3])     // left
-		win.scrollRegion[3] = util.ReflectToInt(arg.([]interface{})[4]) - 1 // right
-		rows = util.ReflectToInt(arg.([]interface{})[5])
-		win.scroll(rows)
-	}
-}
-
-func (w *Window) scroll(count int) {
-	top := w.scrollRegion[0]
-	bot := w.scrollRegion[1]
-	left := w.scrollRegion[2]
-	right := w.scrollRegion[3]
-	content := w.content
-	lenLine := w.lenLine
-	lenContent := w.lenContent
-
-	if top == 0 && bot == 0 && left == 0 && right == 0 {
-		top = 0
-		bot = w.rows - 1
-		left = 0
-		right = w.cols - 1
-	}
-
-	if count > 0 {
-		for row := top; row <= bot-count; row++ {
-			if len(content) <= row+count {
-				continue
-			}
-
-			// copy(content[row], content[row+count])
-			for col := left; col <= right; col++ {
-				content[row][col] = content[row+count][col]
-			}
-			lenLine[row] = lenLine[row+count]
-			lenContent[row] = lenContent[row+count]
-		}
-		for row := bot - count + 1; row <= bot; row++ {
-			for col := left; col <= right; col++ {
-				content[row][col] = nil
-			}
-		}
-	} else {
-		for row := bot; row >= top-count; row-- {
-			if len(content) <= row {
-				continue
-			}
-
-			// copy(content[row], content[row+count])
-			for col := left; col <= right; col++ {
-				content[row][col] = content[row+count][col]
-			}
-			lenLine[row] = lenLine[row+count]
-			lenContent[row] = lenContent[row+count]
-		}
-		for row := top; row < top-count; row++ {
-			for col := left; col <= right; col++ {
-				content[row][col] = nil
-			}
-		}
-	}
-
-	// Suppresses flickering during smooth scrolling
-	if w.scrollPixels[1] != 0 {
-		w.scrollPixels[1] = 0
-	}
-
-	w.queueRedraw(left, top, (right - left + 1), (bot - top + 1))
-}
-
-func (w *Window) update() {
-	w.redrawMutex.Lock()
-
-	if w == nil {
-		w.redrawMutex.Unlock()
-		return
-	}
-	font := w.getFont()
-
-	start := w.queueRedrawArea[1]
-	end := w.queueRedrawArea[3]
-	if w.scrollPixels[1] != 0 {
-		start = 0
-		end = w.rows
-	}
-
-	for i := start; i < end; i++ {
-
-		// for i := 0; i <= numOfLines; i++ {
-		if len(w.content) <= i {
-			continue
-		}
-
-		width := w.lenContent[i]
-
-		if width < w.lenOldContent[i] {
-			width = w.lenOldContent[i]
-		}
+		if width < w.lenOldContent[i] {
+			width = w.lenOldContent[i]
+		}
 
 		w.lenOldContent[i] = w.lenContent[i]
 
+		// Whether to repaint the row from the first column,
+		// since the drawing depends on the other part of the row
+		fromHead := false
+
 		// If DrawIndentGuide is enabled
 		if editor.config.Editor.IndentGuide && i < w.rows-1 {
 			if width < w.lenContent[i+1] {
 				width = w.lenContent[i+1]
 			}
-			// width = w.maxLenContent
+			fromHead = true
 		}
 
 		// If screen is minimap
 		if w.s.name == "minimap" {
 			width = w.cols
+			fromHead = true
 		}
 
 		// If scroll is smooth
 		if w.scrollPixels[1] != 0 {
 			width = w.maxLenContent
+			fromHead = true
 		}
 		// If scroll is smooth
 		if editor.config.Editor.SmoothScroll {
 			if w.scrollPixels2 != 0 {
 				width = w.maxLenContent
+				fromHead = true
 			}
 		}
 
 		width++
 
+		// The whole ligature runs the span touches are repainted,
+		// since their shaping depends on all of their cells
+		start, end := span.Start, span.End
+		if w.ligaturesEnabled() {
+			start, end = ligatureSpan(w.lineAt(i), start, end)
+		}
+
+		// Extend the span by a cell on both sides,
+		// because italic and wide glyphs can overflow into the adjacent cells.
+		// The part after the last non blank cell need not be repainted.
+		left := start - 1
+		right := end + 1
+		if fromHead || left < 0 {
+			left = 0
+		}
+		if right > width {
+			right = width
+		}
+		if right <= left {
+			continue
+		}
+
+		x := int(float64(left) * font.truewidth)
 		w.Update2(
-			0,
+			x,
 			i*font.lineHeight,
-			int(float64(width)*font.truewidth),
+			int(math.Ceil(float64(right)*font.truewidth))-x,
 			font.lineHeight,
 		)
 	}
 
-	// reset redraw area
-	w.queueRedrawArea[0] = w.cols
-	w.queueRedrawArea[1] = w.rows
-	w.queueRedrawArea[2] = 0
-	w.queueRedrawArea[3] = 0
-
 	w.redrawMutex.Unlock()
 }
 
@@ -2495,32 +2311,76 @@ func (s *Screen) update() {
 }
 
 func (w *Window) queueRedrawAll() {
-	w.queueRedrawArea = [4]int{0, 0, w.cols, w.rows}
+	for i := 0; i < w.rows; i++ {
+		w.damage = append(w.damage, grid.Span{Row: i, Start: 0, End: w.cols})
+	}
 }
 
-func (w *Window) queueRedraw(x, y, width, height int) {
-	w.redrawMutex.Lock()
-	if x < w.queueRedrawArea[0] {
-		w.queueRedrawArea[0] = x
-	}
-	if y < w.queueRedrawArea[1] {
-		w.queueRedrawArea[1] = y
-	}
-	if (x + width) > w.queueRedrawArea[2] {
-		w.queueRedrawArea[2] = x + width
-	}
-	if (y + height) > w.queueRedrawArea[3] {
-		w.queueRedrawArea[3] = y + height
+// applyDamage applies the layout of the grids computed by the redraw model,
+// and queues the damage of the grids to be repainted by update
+func (s *Screen) applyDamage(damage map[gridId]*gridDamage) {
+	for gridid, d := range damage {
+		win, ok := s.getWindow(gridid)
+		if !ok {
+			continue
+		}
+		win.lenLine = d.lenLine
+		win.lenContent = d.lenContent
+		if d.isPopupmenu {
+			win.isPopupmenu = true
+		}
+		if d.wb > 0 {
+			win.wb = d.wb
+		}
+		win.damage = append(win.damage, d.spans...)
+
+		if !d.drawn {
+			continue
+		}
+
+		// Suppresses flickering during smooth scrolling
+		if win.scrollPixels[1] != 0 {
+			win.scrollPixels[1] = 0
+		}
+		if !win.isShown() {
+			win.show()
+		}
+
+		if win.isMsgGrid {
+			continue
+		}
+		if win.grid == 1 {
+			continue
+		}
+		for _, span := range d.spans {
+			if win.maxLenContent < win.lenContent[span.Row] {
+				win.maxLenContent = win.lenContent[span.Row]
+			}
+		}
 	}
-	w.redrawMutex.Unlock()
+}
+
+// rectToCells returns the cells which contain the rect in the window
+func (w *Window) rectToCells(rect *core.QRect) (col, row, cols, rows int) {
+	font := w.getFont()
+	col = int(float64(rect.Left()) / font.truewidth)
+	cols = int(math.Ceil(float64(rect.Width()) / font.truewidth))
+
+	// The rows are drawn offset by the smooth scroll in progress
+	top := float64(rect.Top() - w.scrollPixels2)
+	bottom := top + float64(rect.Height())
+	row = int(math.Floor(top / float64(font.lineHeight)))
+	rows = int(math.Ceil(bottom/float64(font.lineHeight))) - row
+
+	return
 }
 
 func (w *Window) drawBackground(p *gui.QPainter, y int, col int, cols int) {
-	if y >= len(w.content) {
+	font := w.getFont()
+	line := w.lineAt(y)
+	if line == nil {
 		return
 	}
-	font := w.getFont()
-	line := w.content[y]
 	var bg *RGBA
 
 	// draw default background color if window is float window or msg grid
@@ -2627,7 +2487,7 @@ func (w *Window) drawBackground(p *gui.QPainter, y int, col int, cols int) {
 			if line[x] == nil {
 				highlight = w.s.hlAttrDef[0]
 			} else {
-				highlight = line[x].highlight
+				highlight = w.cellHighlight(line[x])
 			}
 		} else {
 			highlight = w.s.hlAttrDef[0]
@@ -2667,15 +2527,23 @@ func (w *Window) drawBackground(p *gui.QPainter, y int, col int, cols int) {
 }
 
 func (w *Window) drawTextWithCache(p *gui.QPainter, y int, col int, cols int) {
-	if y >= len(w.content) {
+	wsfont := w.getFont()
+	line := w.lineAt(y)
+	if line == nil {
 		return
 	}
-	wsfont := w.getFont()
-	// font := p.Font()
-	line := w.content[y]
+	top := float64(y*wsfont.lineHeight + w.scrollPixels[1] + w.scrollPixels2)
 	chars := map[*Highlight][]int{}
 	specialChars := []int{}
 
+	// Start from the head of the ligature run the column is in,
+	// so that a repaint from the middle of the run shapes the whole run
+	if w.ligaturesEnabled() {
+		start := ligatureStart(line, col)
+		cols += col - start
+		col = start
+	}
+
 	for x := col; x <= col+cols; x++ {
 		if x >= len(line) {
 			continue
@@ -2683,140 +2551,56 @@ func (w *Window) drawTextWithCache(p *gui.QPainter, y int, col int, cols int) {
 		if line[x] == nil {
 			continue
 		}
-		if line[x].char == "" {
+		if line[x].Text == "" {
 			continue
 		}
-		if line[x].char == " " {
+		if line[x].Text == " " {
 			continue
 		}
-		if !line[x].normalWidth {
-			specialChars = append(specialChars, x)
+		if isWideGlyph(line[x]) {
+			w.drawWideGlyphCached(p, top, line, x)
 			continue
 		}
-
-		if editor.config.Editor.DisableLigatures {
-			w.drawTextInPosWithCache(
-				p,
-				core.NewQPointF3(
-					float64(x)*wsfont.truewidth,
-					float64(y*wsfont.lineHeight+w.scrollPixels[1]+w.scrollPixels2),
-				),
-				line[x].char,
-				line[x].highlight,
-				false,
-			)
-		} else {
-			// Prepare to draw a group of identical highlight units.
-			highlight := line[x].highlight
-			colorSlice, ok := chars[highlight]
-			if !ok {
-				colorSlice = []int{}
-			}
-			colorSlice = append(colorSlice, x)
-			chars[highlight] = colorSlice
+		if !line[x].NormalWidth {
+			specialChars = append(specialChars, x)
+			continue
 		}
-	}
 
-	// If config.DisableLigatures is false
-	if !editor.config.Editor.DisableLigatures {
-		pointF := core.NewQPointF3(
-			float64(col)*wsfont.truewidth,
-			float64(y*wsfont.lineHeight+w.scrollPixels[1]+w.scrollPixels2),
-		)
-
-		for highlight, colorSlice := range chars {
-			var buffer bytes.Buffer
-			slice := colorSlice[:]
-			for x := col; x <= col+cols; x++ {
-				if len(slice) == 0 {
-					break
-				}
-				index := slice[0]
-				if x < index {
-					buffer.WriteString(" ")
-					continue
-				}
-				if x == index {
-					buffer.WriteString(line[x].char)
-					slice = slice[1:]
-				}
+		// If ligatures are enabled,
+		// the characters which can form a ligature are drawn as a glyph
+		if w.ligaturesEnabled() {
+			if n := w.ligatureLen(line, x); n >= 2 {
+				w.drawLigature(p, top, line, x, n)
+				x += n - 1
+				continue
 			}
-
-			text := buffer.String()
-			w.drawTextInPosWithCache(
-				p,
-				pointF,
-				text,
-				highlight,
-				true,
-			)
 		}
-	}
 
-	for _, x := range specialChars {
-		if line[x] == nil || line[x].char == " " {
-			continue
-		}
-		w.drawTextInPosWithCache(
-			p,
-			core.NewQPointF3(
-				float64(x)*wsfont.truewidth,
-				float64(y*wsfont.lineHeight+w.scrollPixels[1]+w.scrollPixels2),
-			),
-			line[x].char,
-			line[x].highlight,
-			false,
-		)
+		// Prepare to draw a group of identical highlight units.
+		highlight := w.cellHighlight(line[x])
+		chars[highlight] = append(chars[highlight], x)
 	}
-}
 
-func (w *Window) drawTextInPosWithCache(p *gui.QPainter, point *core.QPointF, text string, highlight *Highlight, isNormalWidth bool) {
-	if text == "" {
-		return
+	for highlight, colorSlice := range chars {
+		w.drawGlyphRun(p, top, line, colorSlice, highlight, true)
 	}
 
-	fgCache := w.getCache()
-	var image *gui.QImage
-	imagev, err := fgCache.get(HlChars{
-		text:   text,
-		fg:     highlight.fg(),
-		italic: highlight.italic,
-		bold:   highlight.bold,
-	})
-
-	if err != nil {
-		image = w.newTextCache(text, highlight, isNormalWidth)
-		w.setTextCache(text, highlight, image)
-	} else {
-		image = imagev.(*gui.QImage)
+	for _, x := range specialChars {
+		w.drawGlyphRun(p, top, line, []int{x}, w.cellHighlight(line[x]), false)
 	}
-	p.DrawImage7(
-		point,
-		image,
-	)
 }
 
 func (w *Window) setDecorationCache(highlight *Highlight, image *gui.QImage) {
 	if w.font != nil {
 		// If window has own font setting
 		w.fgCache.set(
-			HlDecoration{
-				fg:            highlight.fg(),
-				underline:     highlight.underline,
-				undercurl:     highlight.undercurl,
-				strikethrough: highlight.strikethrough,
-			},
+			highlight.decoration(),
 			image,
 		)
 	} else {
 		// screen text cache
 		w.s.fgCache.set(
-			HlDecoration{
-				fg:            highlight.fg(),
-				underline:     highlight.underline,
-				undercurl:     highlight.undercurl,
-				strikethrough: highlight.strikethrough,
-			},
+			highlight.decoration(),
 			image,
 		)
 	}
@@ -2826,7 +2610,6 @@ func (w *Window) newDecorationCache(char string, highlight *Highlight, isNormalW
 	font := w.getFont()
 
 	width := font.truewidth
-	fg := highlight.fg()
 	if !isNormalWidth {
 		width = math.Ceil(w.s.runeTextWidth(font, char))
 	}
@@ -2846,168 +2629,22 @@ func (w *Window) newDecorationCache(char string, highlight *Highlight, isNormalW
 	image.Fill3(core.Qt__transparent)
 
 	pi := gui.NewQPainter2(image)
-	pi.SetPen2(fg.QColor())
-
-	pen := gui.NewQPen()
-	var color *gui.QColor
-	sp := highlight.special
-	if sp != nil {
-		color = sp.QColor()
-		pen.SetColor(color)
-	} else {
-		fg := highlight.foreground
-		color = fg.QColor()
-		pen.SetColor(color)
-	}
-	pi.SetPen(pen)
-	start := float64(0) * font.truewidth
-	end := float64(width) * font.truewidth
-
-	space := float64(font.lineSpace) / 3.0
-	if space > font.ascent/3.0 {
-		space = font.ascent / 3.0
-	}
-	descent := float64(font.height) - font.ascent
-	weight := int(math.Ceil(float64(font.height) / 16.0))
-	if weight < 1 {
-		weight = 1
-	}
-	if highlight.strikethrough {
-		Y := float64(0*font.lineHeight+w.scrollPixels[1]) + float64(font.ascent)*0.65 + float64(font.lineSpace/2)
-		pi.FillRect5(
-			int(start),
-			int(Y),
-			int(math.Ceil(font.truewidth)),
-			weight,
-			color,
-		)
-	}
-	if highlight.underline {
-		pi.FillRect5(
-			int(start),
-			int(float64((0+1)*font.lineHeight+w.scrollPixels[1]+w.scrollPixels2))-weight,
-			int(math.Ceil(font.truewidth)),
-			weight,
-			color,
-		)
-	}
-	if highlight.undercurl {
-		amplitude := descent*0.65 + float64(font.lineSpace)
-		maxAmplitude := font.ascent / 8.0
-		if amplitude >= maxAmplitude {
-			amplitude = maxAmplitude
-		}
-		freq := 1.0
-		phase := 0.0
-		Y := float64(0*font.lineHeight+w.scrollPixels[1]+w.scrollPixels2) + float64(font.ascent+descent*0.3) + float64(font.lineSpace/2) + space
-		Y2 := Y + amplitude*math.Sin(0)
-		point := core.NewQPointF3(start, Y2)
-		path := gui.NewQPainterPath2(point)
-		for i := int(point.X()); i <= int(end); i++ {
-			Y2 = Y + amplitude*math.Sin(2*math.Pi*freq*float64(i)/font.truewidth+phase)
-			path.LineTo(core.NewQPointF3(float64(i), Y2))
-		}
-		pi.DrawPath(path)
-	}
+	w.drawDecorationLines(pi, highlight, 0, width, 0)
 
 	pi.DestroyQPainter()
 
 	return image
 }
 
-func (w *Window) setTextCache(text string, highlight *Highlight, image *gui.QImage) {
-	if w.font != nil {
-		// If window has own font setting
-		w.fgCache.set(
-			HlChars{
-				text:   text,
-				fg:     highlight.fg(),
-				italic: highlight.italic,
-				bold:   highlight.bold,
-			},
-			image,
-		)
-	} else {
-		// screen text cache
-		w.s.fgCache.set(
-			HlChars{
-				text:   text,
-				fg:     highlight.fg(),
-				italic: highlight.italic,
-				bold:   highlight.bold,
-			},
-			image,
-		)
-	}
-}
-
-func (w *Window) newTextCache(text string, highlight *Highlight, isNormalWidth bool) *gui.QImage {
-	// * Ref: https://stackoverflow.com/questions/40458515/a-best-way-to-draw-a-lot-of-independent-characters-in-qt5/40476430#40476430
-	editor.putLog("start creating word cache:", text)
-
-	font := w.getFont()
-
-	width := float64(len(text)) * font.italicWidth
-	fg := highlight.fg()
-	if !isNormalWidth {
-		width = math.Ceil(w.s.runeTextWidth(font, text))
-	}
-
-	// QImage default device pixel ratio is 1.0,
-	// So we set the correct device pixel ratio
-	image := gui.NewQImage2(
-		core.NewQRectF4(
-			0,
-			0,
-			w.devicePixelRatio*width,
-			w.devicePixelRatio*float64(font.lineHeight),
-		).Size().ToSize(),
-		gui.QImage__Format_ARGB32_Premultiplied,
-	)
-	image.SetDevicePixelRatio(w.devicePixelRatio)
-	image.Fill3(core.Qt__transparent)
-
-	pi := gui.NewQPainter2(image)
-	pi.SetPen2(fg.QColor())
-
-	if !isNormalWidth && w.font == nil && w.s.ws.fontwide != nil {
-		pi.SetFont(w.s.ws.fontwide.fontNew)
-	} else {
-		pi.SetFont(font.fontNew)
-	}
-
-	if highlight.bold {
-		// pi.Font().SetBold(true)
-		pi.Font().SetWeight(font.fontNew.Weight() + 25)
-	}
-	if highlight.italic {
-		pi.Font().SetItalic(true)
-	}
-
-	pi.DrawText6(
-		core.NewQRectF4(
-			0,
-			0,
-			width,
-			float64(font.lineHeight),
-		), text, gui.NewQTextOption2(core.Qt__AlignVCenter),
-	)
-	pi.DestroyQPainter()
-
-	editor.putLog("finished creating word cache:", text)
-
-	return image
-}
-
 func (w *Window) drawText(p *gui.QPainter, y int, col int, cols int) {
-	if y >= len(w.content) {
-		return
-	}
 	wsfont := w.getFont()
 
 	p.SetFont(wsfont.fontNew)
 
-	line := w.content[y]
+	line := w.lineAt(y)
+	if line == nil {
+		return
+	}
 	chars := map[*Highlight][]int{}
 	specialChars := []int{}
 
@@ -3018,30 +2655,40 @@ func (w *Window) drawText(p *gui.QPainter, y int, col int, cols int) {
 		if line[x] == nil {
 			continue
 		}
-		if line[x].char == " " {
+		if line[x].Text == " " {
 			continue
 		}
-		if line[x].char == "" {
+		if line[x].Text == "" {
 			continue
 		}
-		if !line[x].normalWidth {
+		if isWideGlyph(line[x]) {
+			w.drawWideGlyph(
+				p,
+				float64(y*wsfont.lineHeight+w.scrollPixels[1]+w.scrollPixels2),
+				line,
+				x,
+			)
+			p.SetFont(wsfont.fontNew)
+			continue
+		}
+		if !line[x].NormalWidth {
 			specialChars = append(specialChars, x)
 			continue
 		}
 
-		if editor.config.Editor.DisableLigatures {
+		if !w.ligaturesEnabled() {
 			w.drawTextInPos(
 				p,
 				core.NewQPointF3(
 					float64(x)*wsfont.truewidth,
 					float64(y*wsfont.lineHeight+wsfont.shift+w.scrollPixels[1]+w.scrollPixels2),
 				),
-				line[x].char,
-				line[x].highlight,
+				line[x].Text,
+				w.cellHighlight(line[x]),
 				true)
 		} else {
 			// Prepare to draw a group of identical highlight units.
-			highlight := line[x].highlight
+			highlight := w.cellHighlight(line[x])
 			colorSlice, ok := chars[highlight]
 			if !ok {
 				colorSlice = []int{}
@@ -3056,8 +2703,8 @@ func (w *Window) drawText(p *gui.QPainter, y int, col int, cols int) {
 		float64((y)*wsfont.lineHeight+wsfont.shift+w.scrollPixels[1]+w.scrollPixels2),
 	)
 
-	// If config.DisableLigatures is false
-	if !editor.config.Editor.DisableLigatures {
+	// If ligatures are enabled
+	if w.ligaturesEnabled() {
 
 		for highlight, colorSlice := range chars {
 			var buffer bytes.Buffer
@@ -3072,7 +2719,7 @@ func (w *Window) drawText(p *gui.QPainter, y int, col int, cols int) {
 					continue
 				}
 				if x == index {
-					buffer.WriteString(line[x].char)
+					buffer.WriteString(line[x].Text)
 					slice = slice[1:]
 				}
 			}
@@ -3107,7 +2754,7 @@ func (w *Window) drawText(p *gui.QPainter, y int, col int, cols int) {
 			// font = p.Font()
 		}
 		for _, x := range specialChars {
-			if line[x] == nil || line[x].char == " " {
+			if line[x] == nil || line[x].Text == " " {
 				continue
 			}
 			pointF.SetX(float64(x) * wsfont.truewidth)
@@ -3128,7 +2775,14 @@ func (w *Window) drawText(p *gui.QPainter, y int, col int, cols int) {
 			// 	font.SetItalic(false)
 			// }
 			// p.DrawText(pointF, line[x].char)
-			w.drawTextInPos(p, pointF, line[x].char, line[x].highlight, false)
+			if fallback, ok := wsfont.fallbackFor(line[x].Text); ok {
+				font := p.Font()
+				p.SetFont(fallback.font)
+				w.drawTextInPos(p, pointF, line[x].Text, w.cellHighlight(line[x]), false)
+				p.SetFont(font)
+				continue
+			}
+			w.drawTextInPos(p, pointF, line[x].Text, w.cellHighlight(line[x]), false)
 		}
 		if w.s.ws.fontwide != nil && w.font == nil {
 			p.SetFont(w.getFont().fontNew)
@@ -3142,10 +2796,20 @@ func (w *Window) drawTextInPos(p *gui.QPainter, point *core.QPointF, text string
 	}
 
 	font := p.Font()
-	fg := highlight.fg()
+	fg := w.dim(highlight.fg())
 	p.SetPen2(fg.QColor())
 	wsfont := w.getFont()
 
+	// The style which has its own family is drawn with the face of it
+	if isNormalWidth {
+		if styleFont := wsfont.styleFont(highlight.bold, highlight.italic); styleFont != nil {
+			p.SetFont(styleFont)
+			wsfont.drawText(p, point, text)
+			p.SetFont(font)
+			return
+		}
+	}
+
 	if highlight.bold {
 		// font.SetBold(true)
 		font.SetWeight(wsfont.fontNew.Weight() + 25)
@@ -3158,7 +2822,7 @@ func (w *Window) drawTextInPos(p *gui.QPainter, point *core.QPointF, text string
 	} else {
 		font.SetItalic(false)
 	}
-	p.DrawText(point, text)
+	wsfont.drawText(p, point, text)
 }
 
 func (w *Window) drawForeground(p *gui.QPainter, y int, col int, cols int) {
@@ -3174,10 +2838,10 @@ func (w *Window) drawForeground(p *gui.QPainter, y int, col int, cols int) {
 }
 
 func (w *Window) drawTextDecoration(p *gui.QPainter, y int, col int, cols int) {
-	if y >= len(w.content) {
+	line := w.lineAt(y)
+	if line == nil {
 		return
 	}
-	line := w.content[y]
 	font := w.getFont()
 	for x := col; x <= col+cols; x++ {
 		if x >= len(line) {
@@ -3186,82 +2850,114 @@ func (w *Window) drawTextDecoration(p *gui.QPainter, y int, col int, cols int) {
 		if line[x] == nil {
 			continue
 		}
-		if !line[x].highlight.underline && !line[x].highlight.undercurl && !line[x].highlight.strikethrough {
+		highlight := w.cellHighlight(line[x])
+		if !highlight.hasDecoration() {
 			continue
 		}
-		pen := gui.NewQPen()
-		var color *gui.QColor
-		sp := line[x].highlight.special
-		if sp != nil {
-			color = sp.QColor()
-			pen.SetColor(color)
+		w.drawDecorationLines(
+			p,
+			highlight,
+			float64(x)*font.truewidth,
+			font.truewidth,
+			float64(y*font.lineHeight+w.scrollPixels[1]+w.scrollPixels2),
+		)
+	}
+}
+
+// drawDecorationLines draws the underline, undercurl, underdouble, underdotted,
+// underdashed and strikethrough of the highlight in the cell whose left top
+// is (start, top) with the special color.
+func (w *Window) drawDecorationLines(p *gui.QPainter, highlight *Highlight, start, width, top float64) {
+	font := w.getFont()
+	color := w.dim(highlight.decorationColor()).QColor()
+	end := start + width
+
+	space := float64(font.lineSpace) / 3.0
+	if space > font.ascent/3.0 {
+		space = font.ascent / 3.0
+	}
+	descent := float64(font.height) - font.ascent
+	weight := int(math.Ceil(float64(font.height) / 16.0))
+	if weight < 1 {
+		weight = 1
+	}
+	bottom := int(top) + font.lineHeight
+
+	if highlight.strikethrough {
+		Y := top + float64(font.ascent)*0.65 + float64(font.lineSpace/2)
+		p.FillRect5(
+			int(start),
+			int(Y),
+			int(math.Ceil(width)),
+			weight,
+			color,
+		)
+	}
+	if highlight.underline {
+		p.FillRect5(
+			int(start),
+			bottom-weight,
+			int(math.Ceil(width)),
+			weight,
+			color,
+		)
+	}
+	if highlight.underdouble {
+		p.FillRect5(
+			int(start),
+			bottom-weight,
+			int(math.Ceil(width)),
+			weight,
+			color,
+		)
+		p.FillRect5(
+			int(start),
+			bottom-weight*3,
+			int(math.Ceil(width)),
+			weight,
+			color,
+		)
+	}
+	if highlight.underdotted || highlight.underdashed {
+		pen := gui.NewQPen3(color)
+		pen.SetWidth(weight)
+		if highlight.underdotted {
+			pen.SetStyle(core.Qt__DotLine)
 		} else {
-			fg := line[x].highlight.foreground
-			color = fg.QColor()
-			pen.SetColor(color)
+			pen.SetStyle(core.Qt__DashLine)
 		}
+		// Keep the pattern continuous across the cells
+		pen.SetDashOffset(start / float64(weight))
 		p.SetPen(pen)
-		start := float64(x) * font.truewidth
-		end := float64(x+1) * font.truewidth
-
-		space := float64(font.lineSpace) / 3.0
-		if space > font.ascent/3.0 {
-			space = font.ascent / 3.0
-		}
-		descent := float64(font.height) - font.ascent
-		weight := int(math.Ceil(float64(font.height) / 16.0))
-		if weight < 1 {
-			weight = 1
-		}
-		if line[x].highlight.strikethrough {
-			// strikeLinef := core.NewQLineF3(start, halfY, end, halfY)
-			// p.DrawLine(strikeLinef)
-			Y := float64(y*font.lineHeight+w.scrollPixels[1]) + float64(font.ascent)*0.65 + float64(font.lineSpace/2)
-			p.FillRect5(
-				int(start),
-				int(Y),
-				int(math.Ceil(font.truewidth)),
-				weight,
-				color,
-			)
-		}
-		if line[x].highlight.underline {
-			// linef := core.NewQLineF3(start, Y, end, Y)
-			// p.DrawLine(linef)
-			p.FillRect5(
-				int(start),
-				int(float64((y+1)*font.lineHeight+w.scrollPixels[1]+w.scrollPixels2))-weight,
-				int(math.Ceil(font.truewidth)),
-				weight,
-				color,
-			)
+		Y := float64(bottom) - float64(weight)/2.0
+		p.DrawLine(core.NewQLineF3(start, Y, end, Y))
+	}
+	if highlight.undercurl {
+		p.SetPen(gui.NewQPen3(color))
+		amplitude := descent*0.65 + float64(font.lineSpace)
+		maxAmplitude := font.ascent / 8.0
+		if amplitude >= maxAmplitude {
+			amplitude = maxAmplitude
 		}
-		if line[x].highlight.undercurl {
-			amplitude := descent*0.65 + float64(font.lineSpace)
-			maxAmplitude := font.ascent / 8.0
-			if amplitude >= maxAmplitude {
-				amplitude = maxAmplitude
-			}
-			freq := 1.0
-			phase := 0.0
-			Y := float64(y*font.lineHeight+w.scrollPixels[1]+w.scrollPixels2) + float64(font.ascent+descent*0.3) + float64(font.lineSpace/2) + space
-			Y2 := Y + amplitude*math.Sin(0)
-			point := core.NewQPointF3(start, Y2)
-			path := gui.NewQPainterPath2(point)
-			for i := int(point.X()); i <= int(end); i++ {
-				Y2 = Y + amplitude*math.Sin(2*math.Pi*freq*float64(i)/font.truewidth+phase)
-				path.LineTo(core.NewQPointF3(float64(i), Y2))
-			}
-			p.DrawPath(path)
+		freq := 1.0
+		phase := 0.0
+		Y := top + float64(font.ascent+descent*0.3) + float64(font.lineSpace/2) + space
+		Y2 := Y + amplitude*math.Sin(2*math.Pi*freq*start/font.truewidth+phase)
+		point := core.NewQPointF3(start, Y2)
+		path := gui.NewQPainterPath2(point)
+		for i := int(point.X()); i <= int(end); i++ {
+			Y2 = Y + amplitude*math.Sin(2*math.Pi*freq*float64(i)/font.truewidth+phase)
+			path.LineTo(core.NewQPointF3(float64(i), Y2))
 		}
+		p.DrawPath(path)
 	}
 }
 
 func (w *Window) drawTextDecorationWithCache(p *gui.QPainter, y int, col int, cols int) {
-	if y >= len(w.content) {
+	line := w.lineAt(y)
+	if line == nil {
 		return
 	}
-	line := w.content[y]
 	font := w.getFont()
 	for x := col; x <= col+cols; x++ {
 		if x >= len(line) {
@@ -3270,22 +2966,18 @@ func (w *Window) drawTextDecorationWithCache(p *gui.QPainter, y int, col int, co
 		if line[x] == nil {
 			continue
 		}
-		if !line[x].highlight.underline && !line[x].highlight.undercurl && !line[x].highlight.strikethrough {
+		highlight := w.cellHighlight(line[x])
+		if !highlight.hasDecoration() {
 			continue
 		}
 
 		fgCache := w.getCache()
 		var image *gui.QImage
-		imagev, err := fgCache.get(HlDecoration{
-			fg:            line[x].highlight.fg(),
-			underline:     line[x].highlight.underline,
-			undercurl:     line[x].highlight.undercurl,
-			strikethrough: line[x].highlight.strikethrough,
-		})
+		imagev, err := fgCache.get(highlight.decoration())
 
 		if err != nil {
-			image = w.newDecorationCache(line[x].char, line[x].highlight, line[x].normalWidth)
-			w.setDecorationCache(line[x].highlight, image)
+			image = w.newDecorationCache(line[x].Text, highlight, line[x].NormalWidth)
+			w.setDecorationCache(highlight, image)
 		} else {
 			image = imagev.(*gui.QImage)
 		}
@@ -3302,7 +2994,7 @@ func (w *Window) drawTextDecorationWithCache(p *gui.QPainter, y int, col int, co
 }
 
 func (w *Window) getFillpatternAndTransparent(hl *Highlight) (core.Qt__BrushStyle, *RGBA, int) {
-	color := hl.bg()
+	color := w.dim(hl.bg())
 	pattern := core.Qt__BrushStyle(1)
 	t := 255
 	// if pumblend > 0
@@ -3343,24 +3035,25 @@ func (w *Window) getFillpatternAndTransparent(hl *Highlight) (core.Qt__BrushStyl
 	return pattern, color, t
 }
 
-func (s *Screen) runeTextWidth(font *Font, text string) float64 {
-	cjk := 0
-	ascii := 0
-	var buffer bytes.Buffer
-	for _, c := range []rune(text) {
-		if isCJK(c) {
-			cjk++
-		} else if c <= 127 {
-			ascii++
-		} else {
-			buffer.WriteString(string(c))
-		}
+// widthOptions returns the options of the workspace which change the width
+// of the characters
+func (s *Screen) widthOptions() grid.WidthOptions {
+	if s.ws == nil {
+		return grid.DefaultWidthOptions
 	}
 
-	r := buffer.String()
-	width := (font.truewidth)*float64(ascii) + (font.truewidth)*float64(cjk)*2
-	if r == "" {
-		width += font.fontMetrics.HorizontalAdvance(r, -1)
+	return s.ws.widthOptions
+}
+
+func (s *Screen) runeTextWidth(font *Font, text string) float64 {
+	width := 0.0
+	for _, cluster := range grid.Graphemes(text) {
+		cells := grid.ClusterWidth(cluster, s.widthOptions())
+		if cluster[0] <= 127 || cells == 2 {
+			width += font.truewidth * float64(cells)
+			continue
+		}
+		width += font.horizontalAdvance(cluster)
 	}
 	if width == 0 {
 		width = font.truewidth * 2
@@ -3369,52 +3062,11 @@ func (s *Screen) runeTextWidth(font *Font, text string) float64 {
 	return width
 }
 
-func isCJK(char rune) bool {
-	if unicode.Is(unicode.Han, char) {
-		return true
-	}
-	if unicode.Is(unicode.Hiragana, char) {
-		return true
-	}
-	if unicode.Is(unicode.Katakana, char) {
-		return true
-	}
-	if unicode.Is(unicode.Hangul, char) {
-		return true
-	}
-
-	return false
-}
-
-// isNormalWidth is:
-// On Windows, HorizontalAdvance() may take a long time to get the width of CJK characters.
-// For this reason, for CJK characters, the character width should be the double width of ASCII characters.
-// This issue may also be related to the following.
-// https://github.com/equalsraf/neovim-qt/issues/614
-func (w *Window) isNormalWidth(char string) bool {
-	if len(char) == 0 {
-		return true
-	}
-
-	// if ASCII
-	if char[0] <= 127 {
-		return true
-	}
-
-	// if CJK
-	if isCJK([]rune(char)[0]) {
-		return false
-	}
-
-	return w.getFont().fontMetrics.HorizontalAdvance(char, -1) == w.getFont().truewidth
-}
-
-func (s *Screen) windowPosition(args []interface{}) {
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
-		id := arg.([]interface{})[1].(nvim.Window)
-		row := util.ReflectToInt(arg.([]interface{})[2])
-		col := util.ReflectToInt(arg.([]interface{})[3])
+func (s *Screen) windowPosition(positions []winPos) {
+	for _, pos := range positions {
+		gridid := pos.grid
+		row := pos.row
+		col := pos.col
 
 		if isSkipGlobalId(gridid) {
 			continue
@@ -3425,11 +3077,9 @@ func (s *Screen) windowPosition(args []interface{}) {
 			continue
 		}
 
-		win.updateMutex.Lock()
-		win.id = id
+		win.setID(pos.win)
 		win.pos[0] = col
 		win.pos[1] = row
-		win.updateMutex.Unlock()
 		win.move(col, row)
 		win.show()
 
@@ -3439,9 +3089,8 @@ func (s *Screen) windowPosition(args []interface{}) {
 	}
 }
 
-func (s *Screen) gridDestroy(args []interface{}) {
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
+func (s *Screen) gridDestroy(grids []gridId) {
+	for _, gridid := range grids {
 		if isSkipGlobalId(gridid) {
 			continue
 		}
@@ -3477,6 +3126,22 @@ func (s *Screen) gridDestroy(args []interface{}) {
 	})
 }
 
+// setID sets the id of the window, which the goroutines requesting the
+// buffer of the window read
+func (w *Window) setID(id nvim.Window) {
+	w.updateMutex.Lock()
+	defer w.updateMutex.Unlock()
+
+	w.id = id
+}
+
+func (w *Window) getID() nvim.Window {
+	w.updateMutex.RLock()
+	defer w.updateMutex.RUnlock()
+
+	return w.id
+}
+
 func (w *Window) deleteExternalWin() {
 	if w.extwin != nil {
 		w.extwin.Hide()
@@ -3484,7 +3149,7 @@ func (w *Window) deleteExternalWin() {
 	}
 }
 
-func (s *Screen) windowFloatPosition(args []interface{}) {
+func (s *Screen) windowFloatPosition(positions []winFloatPos) {
 	// A workaround for the problem that the position of the float window,
 	// which is created as a tooltip suggested by LSP, is not the correct
 	// position in multigrid ui api.
@@ -3509,8 +3174,8 @@ func (s *Screen) windowFloatPosition(args []interface{}) {
 		})
 	}
 
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
+	for _, pos := range positions {
+		gridid := pos.grid
 		if isSkipGlobalId(gridid) {
 			continue
 		}
@@ -3520,14 +3185,11 @@ func (s *Screen) windowFloatPosition(args []interface{}) {
 			continue
 		}
 
-		win.updateMutex.Lock()
-		win.id = arg.([]interface{})[1].(nvim.Window)
-		win.updateMutex.Unlock()
-		win.anchor = arg.([]interface{})[2].(string)
-		anchorGrid := util.ReflectToInt(arg.([]interface{})[3])
-		anchorRow := int(util.ReflectToFloat(arg.([]interface{})[4]))
-		anchorCol := int(util.ReflectToFloat(arg.([]interface{})[5]))
-		// focusable := arg.([]interface{})[6]
+		win.setID(pos.win)
+		win.anchor = pos.anchor
+		anchorGrid := pos.anchorGrid
+		anchorRow := int(pos.anchorRow)
+		anchorCol := int(pos.anchorCol)
 
 		if isExistPopupmenu && win.id != -1 {
 			anchorGrid = s.ws.cursor.gridid
@@ -3632,10 +3294,8 @@ func (s *Screen) windowFloatPosition(args []interface{}) {
 	}
 }
 
-func (s *Screen) windowExternalPosition(args []interface{}) {
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
-		// winid := arg.([]interface{})[1].(nvim.Window)
+func (s *Screen) windowExternalPosition(grids []gridId) {
+	for _, gridid := range grids {
 
 		s.windows.Range(func(_, winITF interface{}) bool {
 			win := winITF.(*Window)
@@ -3669,6 +3329,7 @@ func (s *Screen) windowExternalPosition(args []interface{}) {
 				height := win.rows * font.lineHeight
 				win.setGridGeometry(width, height)
 				win.setResizableForExtWin()
+				win.connectExternalSeparator()
 				win.move(win.pos[0], win.pos[1])
 			}
 
@@ -3693,9 +3354,8 @@ func (w *Window) setResizableForExtWin() {
 	}
 }
 
-func (s *Screen) windowHide(args []interface{}) {
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
+func (s *Screen) windowHide(grids []gridId) {
+	for _, gridid := range grids {
 		if isSkipGlobalId(gridid) {
 			continue
 		}
@@ -3707,23 +3367,18 @@ func (s *Screen) windowHide(args []interface{}) {
 	}
 }
 
-func (s *Screen) msgSetPos(args []interface{}) {
-	for _, arg := range args {
-		gridid := util.ReflectToInt(arg.([]interface{})[0])
-		row := util.ReflectToInt(arg.([]interface{})[1])
-		scrolled := arg.([]interface{})[2].(bool)
+func (s *Screen) msgSetPos(positions []msgSetPos) {
+	for _, pos := range positions {
 		// TODO We should imprement to drawing msgSepChar
-		// sepChar := arg.([]interface{})[3].(string)
-
-		win, ok := s.getWindow(gridid)
+		win, ok := s.getWindow(pos.grid)
 		if !ok {
 			continue
 		}
 		win.isMsgGrid = true
-		win.pos[1] = row
+		win.pos[1] = pos.row
 		win.move(win.pos[0], win.pos[1])
 		win.show()
-		if scrolled {
+		if pos.scrolled {
 			win.Raise() // Fix #111
 		}
 	}
@@ -3756,7 +3411,6 @@ func newWindow() *Window {
 	win.SetContentsMargins(0, 0, 0, 0)
 	win.SetAttribute(core.Qt__WA_OpaquePaintEvent, true)
 	win.SetStyleSheet(" * { background-color: rgba(0, 0, 0, 0);}")
-	win.scrollRegion = []int{0, 0, 0, 0}
 	win.background = editor.colors.bg
 
 	win.ConnectPaintEvent(win.paint)
@@ -3783,7 +3437,9 @@ func (w *Window) raise() {
 	w.s.ws.cursor.isInPalette = false
 	w.s.ws.cursor.widget.SetParent(w)
 	w.s.ws.cursor.widget.Hide()
-	w.s.ws.cursor.widget.Show()
+	if !w.s.ws.cursor.isBusy {
+		w.s.ws.cursor.widget.Show()
+	}
 	if !w.isExternal {
 		editor.window.Raise()
 	} else if w.isExternal {
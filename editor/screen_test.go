@@ -3,6 +3,8 @@ package editor
 import (
 	"reflect"
 	"testing"
+
+	"github.com/akiyosi/goneovim/grid"
 )
 
 func TestHighlight_fg(t *testing.T) {
@@ -96,244 +98,82 @@ func TestHighlight_fg(t *testing.T) {
 	}
 }
 
-func TestWindow_updateLine(t *testing.T) {
-	type fields struct {
-		//	rwMutex          sync.RWMutex
-		//	paintMutex       sync.Mutex
-		//	redrawMutex      sync.Mutex
-		s       *Screen
-		content [][]*Cell
-		//	lenLine          []int
-		//	lenContent       []int
-		//	lenOldContent    []int
-		grid gridId
-		//	isGridDirty      bool
-		//	id               nvim.Window
-		//	bufName          string
-		//	pos              [2]int
-		//	anchor           string
-		cols int
-		rows int
-		//	isMsgGrid        bool
-		//	isFloatWin       bool
-		//	widget           *widgets.QWidget
-		//	shown            bool
-		//	queueRedrawArea  [4]int
-		//	scrollRegion     []int
-		//	devicePixelRatio float64
-		//	textCache        gcache.Cache
-		//	font             *Font
-		//	fobackground       *RGBA
-		//	width            float64
-		//	height           int
-		//	localWindows     *[4]localWindow
+func TestWindow_cellHighlightUndefined(t *testing.T) {
+	hldef := map[int]*Highlight{
+		0: {id: 0},
+		6: {id: 6},
 	}
-	type args struct {
-		col   int
-		row   int
-		cells []interface{}
-	}
-
-	// Def grid for test
-	gridid := 6
-	row := 1
-	rows := 2
-	cols := 5
-
-	// Def hlAttrDef for test
-	hldef := make(map[int]*Highlight)
-	hldef[0] = &Highlight{
-		id: 0,
-		foreground: &RGBA{
-			0,
-			0,
-			0,
-			1.0,
-		},
-		background: &RGBA{
-			0,
-			0,
-			0,
-			1.0,
-		},
+	w := &Window{
+		s: &Screen{hlAttrDef: hldef},
 	}
-	hldef[6] = &Highlight{
-		id: 6,
-		foreground: &RGBA{
-			6,
-			6,
-			0,
-			1.0,
-		},
-		background: &RGBA{
-			0,
-			6,
-			6,
-			1.0,
-		},
+	if got := w.cellHighlight(&grid.Cell{HlID: 6}); got != hldef[6] {
+		t.Errorf("cellHighlight(6) = %v, want %v", got, hldef[6])
 	}
-	hldef[7] = &Highlight{
-		id: 7,
-		foreground: &RGBA{
-			7,
-			7,
-			0,
-			1.0,
-		},
-		background: &RGBA{
-			0,
-			7,
-			7,
-			1.0,
-		},
+	if got := w.cellHighlight(&grid.Cell{HlID: 42}); got != hldef[0] {
+		t.Errorf("cellHighlight(42) = %v, want the default highlight", got)
 	}
 
-	// Init grid content
-	content := make([][]*Cell, rows)
-	for i := 0; i < rows; i++ {
-		content[i] = make([]*Cell, cols)
+	w.s.hlAttrDef = nil
+	if got := w.cellHighlight(&grid.Cell{HlID: 42}); got == nil {
+		t.Errorf("cellHighlight(42) = nil without the highlights")
 	}
+}
 
-	// Def tests
+func TestLigatureSpan(t *testing.T) {
+	line := func(text string, hl int) []*grid.Cell {
+		cells := make([]*grid.Cell, len(text))
+		for i, c := range text {
+			cells[i] = &grid.Cell{Text: string(c), HlID: hl, NormalWidth: true}
+		}
+		return cells
+	}
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   []Cell
+		name      string
+		line      []*grid.Cell
+		start     int
+		end       int
+		wantStart int
+		wantEnd   int
 	}{
-		// TODO: Add test cases.
-		{
-			"test_updateline() 1",
-			fields{
-				s:       &Screen{hlAttrDef: hldef},
-				content: content,
-				grid:    gridid,
-				cols:    cols,
-				rows:    rows,
-			},
-			args{
-				col: 0,
-				row: row,
-				cells: []interface{}{
-					[]interface{}{"~", 7},
-					[]interface{}{" ", 7, 4},
-				},
-			},
-			[]Cell{
-				Cell{true, "~", hldef[7]},
-				Cell{true, " ", hldef[7]},
-				Cell{true, " ", hldef[7]},
-				Cell{true, " ", hldef[7]},
-				Cell{true, " ", hldef[7]},
-			},
-		},
-		{
-			"test_updateline() 2",
-			fields{
-				s:       &Screen{hlAttrDef: hldef},
-				content: content,
-				grid:    6,
-				cols:    cols,
-				rows:    rows,
-			},
-			args{
-				col: 3,
-				row: row,
-				cells: []interface{}{
-					[]interface{}{"*", 6, 2},
-				},
-			},
-			[]Cell{
-				Cell{true, "~", hldef[7]},
-				Cell{true, " ", hldef[7]},
-				Cell{true, " ", hldef[7]},
-				Cell{true, "*", hldef[6]},
-				Cell{true, "*", hldef[6]},
-			},
-		},
-		{
-			"test_updateline() 3",
-			fields{
-				s:       &Screen{hlAttrDef: hldef},
-				content: content,
-				grid:    6,
-				cols:    cols,
-				rows:    rows,
-			},
-			args{
-				col: 1,
-				row: row,
-				cells: []interface{}{
-					[]interface{}{"@", 6},
-					[]interface{}{"v"},
-					[]interface{}{"i"},
-					[]interface{}{"m"},
-				},
-			},
-			[]Cell{
-				Cell{true, "~", hldef[7]},
-				Cell{true, "@", hldef[6]},
-				Cell{true, "v", hldef[6]},
-				Cell{true, "i", hldef[6]},
-				Cell{true, "m", hldef[6]},
-			},
-		},
-		{
-			"test_updateline() 4",
-			fields{
-				s:       &Screen{hlAttrDef: hldef},
-				content: content,
-				grid:    6,
-				cols:    cols,
-				rows:    rows,
-			},
-			args{
-				col: 0,
-				row: row,
-				cells: []interface{}{
-					[]interface{}{" ", 7, 2},
-					[]interface{}{"J"},
-				},
-			},
-			[]Cell{
-				Cell{true, " ", hldef[7]},
-				Cell{true, " ", hldef[7]},
-				Cell{true, "J", hldef[7]},
-				Cell{true, "i", hldef[6]},
-				Cell{true, "m", hldef[6]},
-			},
-		},
+		{"no ligature", line("abc def", 1), 2, 4, 2, 4},
+		{"in the middle of a run", line("a ===> b", 1), 3, 4, 2, 6},
+		{"leaving a run", line("a ==x b", 1), 4, 5, 2, 5},
+		{"joining a run", line("a ==== b", 1), 5, 6, 2, 6},
+		{"end of line", line("a --", 1), 3, 4, 2, 4},
 	}
-
-	// Do tests
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			w := &Window{
-				s:       tt.fields.s,
-				content: tt.fields.content,
-				grid:    tt.fields.grid,
-				cols:    tt.fields.cols,
-				rows:    tt.fields.rows,
-			}
-			w.updateLine(tt.args.col, tt.args.row, tt.args.cells)
-
-			got := w.content[row]
-			for i, cell := range got {
-				if cell == nil {
-					continue
-				}
-
-				if cell.char != tt.want[i].char {
-					t.Errorf("col: %v, actual: %v, want: %v", i, cell.char, tt.want[i].char)
-				}
-				if cell.highlight.id != tt.want[i].highlight.id {
-					t.Errorf("col: %v, actual: %v, want: %v", i, cell.highlight.id, tt.want[i].highlight.id)
-				}
-				if cell.normalWidth != tt.want[i].normalWidth {
-					t.Errorf("col: %v, actual: %v, want: %v", i, cell.normalWidth, tt.want[i].normalWidth)
-				}
+			start, end := ligatureSpan(tt.line, tt.start, tt.end)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("ligatureSpan() = %d, %d, want %d, %d", start, end, tt.wantStart, tt.wantEnd)
 			}
 		})
 	}
 }
+
+func TestLigatureStart(t *testing.T) {
+	cells := []*grid.Cell{}
+	for i, c := range "a =>>= b" {
+		hl := 1
+		if i >= 4 {
+			hl = 2
+		}
+		cells = append(cells, &grid.Cell{Text: string(c), HlID: hl, NormalWidth: true})
+	}
+	tests := []struct {
+		x    int
+		want int
+	}{
+		{0, 0},
+		{3, 2},
+		{4, 4},
+		{5, 4},
+		{8, 8},
+	}
+	for _, tt := range tests {
+		if got := ligatureStart(cells, tt.x); got != tt.want {
+			t.Errorf("ligatureStart(%d) = %d, want %d", tt.x, got, tt.want)
+		}
+	}
+}
@@ -108,11 +108,14 @@ func (s *ScrollBar) scroll(v, h int) {
 	}
 
 	// Detect current mode
+	// If the mouse is disabled, the window is scrolled without leaving the current mode
 	mode := win.s.ws.mode
-	if mode == "terminal-input" {
-		win.s.ws.nvim.Input(`<C-\><C-n>`)
-	} else if mode != "normal" {
-		win.s.ws.nvim.Input(win.s.ws.escKeyInInsert)
+	if win.s.ws.mouseEnabled {
+		if mode == "terminal-input" {
+			win.s.ws.nvim.Input(`<C-\><C-n>`)
+		} else if mode != "normal" {
+			win.s.ws.nvim.Input(win.s.ws.escKeyInInsert)
+		}
 	}
 
 	font := win.getFont()
@@ -134,6 +137,11 @@ func (s *ScrollBar) scroll(v, h int) {
 		vertKey = "Down"
 	}
 
+	if !win.s.ws.mouseEnabled {
+		win.scrollView(vert)
+		return
+	}
+
 	if win.s.ws.isMappingScrollKey {
 		if vert != 0 {
 			win.s.ws.nvim.Input(fmt.Sprintf("<ScrollWheel%s>", vertKey))
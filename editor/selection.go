@@ -0,0 +1,146 @@
+package editor
+
+import (
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+)
+
+// Selection is a text selection made by the mouse while the mouse support of
+// neovim is disabled. It is handled only by the GUI, the selected text is
+// copied to the clipboard.
+type Selection struct {
+	win        *Window
+	start      [2]int // row, col
+	end        [2]int // row, col
+	isSelected bool
+}
+
+// windowAt returns the window under the position of the screen widget.
+// Floating windows take precedence over the other windows.
+func (s *Screen) windowAt(pos *core.QPoint) (*Window, bool) {
+	var found *Window
+	s.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win == nil {
+			return true
+		}
+		if win.isExternal || win.isMsgGrid || !win.IsVisible() {
+			return true
+		}
+		if win.grid == 1 && s.lenWindows() > 1 {
+			return true
+		}
+		if !win.Geometry().Contains(pos, false) {
+			return true
+		}
+		if found == nil || win.isFloatWin {
+			found = win
+		}
+
+		return true
+	})
+
+	return found, found != nil
+}
+
+// cellAt returns the row and column of the window at the position of the screen widget
+func (w *Window) cellAt(pos *core.QPoint) (int, int) {
+	font := w.getFont()
+	col := int(float64(pos.X()-w.X()) / font.truewidth)
+	row := int(float64(pos.Y()-w.Y()) / float64(font.lineHeight))
+	if col >= w.cols {
+		col = w.cols - 1
+	}
+	if row >= w.rows {
+		row = w.rows - 1
+	}
+	if col < 0 {
+		col = 0
+	}
+	if row < 0 {
+		row = 0
+	}
+
+	return row, col
+}
+
+func (s *Screen) selectionEvent(event *gui.QMouseEvent) {
+	sel := &s.selection
+	switch event.Type() {
+	case core.QEvent__MouseButtonPress, core.QEvent__MouseButtonDblClick:
+		if event.Button() != core.Qt__LeftButton {
+			return
+		}
+		s.clearSelection()
+		win, ok := s.windowAt(event.Pos())
+		if !ok {
+			return
+		}
+		row, col := win.cellAt(event.Pos())
+		sel.win = win
+		sel.start = [2]int{row, col}
+		sel.end = sel.start
+	case core.QEvent__MouseMove:
+		if sel.win == nil || event.Buttons()&core.Qt__LeftButton == 0 {
+			return
+		}
+		row, col := sel.win.cellAt(event.Pos())
+		sel.end = [2]int{row, col}
+		sel.isSelected = true
+		sel.win.Update()
+	case core.QEvent__MouseButtonRelease:
+		if sel.win == nil || !sel.isSelected {
+			return
+		}
+		sel.win.s.modelMutex.RLock()
+		text := sel.win.content.TextRange(sel.start[0], sel.start[1], sel.end[0], sel.end[1])
+		sel.win.s.modelMutex.RUnlock()
+		if text != "" {
+			editor.app.Clipboard().SetText(text, gui.QClipboard__Clipboard)
+		}
+	}
+}
+
+func (s *Screen) clearSelection() {
+	sel := &s.selection
+	if sel.win != nil && sel.isSelected {
+		sel.win.Update()
+	}
+	sel.win = nil
+	sel.isSelected = false
+}
+
+func (w *Window) drawSelection(p *gui.QPainter) {
+	sel := &w.s.selection
+	if sel.win != w || !sel.isSelected {
+		return
+	}
+	font := w.getFont()
+
+	start, end := sel.start, sel.end
+	if start[0] > end[0] || (start[0] == end[0] && start[1] > end[1]) {
+		start, end = end, start
+	}
+
+	color := hexToRGBA(editor.config.SideBar.AccentColor)
+	color = newRGBA(color.R, color.G, color.B, 0.3)
+	for row := start[0]; row <= end[0]; row++ {
+		first := 0
+		if row == start[0] {
+			first = start[1]
+		}
+		last := w.cols - 1
+		if row == end[0] {
+			last = end[1]
+		}
+		p.FillRect4(
+			core.NewQRectF4(
+				float64(first)*font.truewidth,
+				float64(row*font.lineHeight),
+				float64(last-first+1)*font.truewidth,
+				float64(font.lineHeight),
+			),
+			color.QColor(),
+		)
+	}
+}
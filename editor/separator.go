@@ -0,0 +1,239 @@
+package editor
+
+import (
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// SeparatorDrag is the state of dragging a window separator to resize the
+// window on the left of or above it. The separator of an external window is
+// the right or bottom border of its own window.
+type SeparatorDrag struct {
+	win      *Window
+	vertical bool
+	size     int
+	preview  *widgets.QWidget
+	press    string
+
+	// widget receives the mouse events of the drag, origin is the position
+	// of the window in it, and font is the font of its cells
+	widget *widgets.QWidget
+	origin [2]float64
+	font   *Font
+}
+
+// separatorAt returns the window whose right separator (vertical) or status
+// line (horizontal) is at the cell of the global grid
+func (s *Screen) separatorAt(col, row int) (*Window, bool, bool) {
+	var found *Window
+	vertical := false
+	s.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win == nil {
+			return true
+		}
+		if win.grid == 1 || win.isMsgGrid || win.isFloatWin || win.isExternal {
+			return true
+		}
+		if !win.isShown() {
+			return true
+		}
+		if col == win.pos[0]+win.cols && row >= win.pos[1] && row < win.pos[1]+win.rows {
+			found = win
+			vertical = true
+			return false
+		}
+		if row == win.pos[1]+win.rows && col >= win.pos[0] && col < win.pos[0]+win.cols {
+			found = win
+			vertical = false
+			return false
+		}
+
+		return true
+	})
+
+	return found, vertical, found != nil
+}
+
+// startSeparatorDrag starts dragging the separator under the mouse.
+// It returns false if the event is not a left click on a separator.
+func (s *Screen) startSeparatorDrag(event *gui.QMouseEvent) bool {
+	if event.Button() != core.Qt__LeftButton {
+		return false
+	}
+	font := s.font
+	col := int(float64(event.X()) / font.truewidth)
+	row := int(float64(event.Y()) / float64(font.lineHeight))
+	win, vertical, ok := s.separatorAt(col, row)
+	if !ok {
+		return false
+	}
+
+	s.beginSeparatorDrag(&SeparatorDrag{
+		win:      win,
+		vertical: vertical,
+		press:    s.convertMouse(event),
+		widget:   s.widget,
+		font:     font,
+		origin: [2]float64{
+			float64(win.pos[0]) * font.truewidth,
+			float64(win.pos[1] * font.lineHeight),
+		},
+	})
+
+	// The click on the separator is also the start of a text selection
+	// while the mouse is disabled in neovim
+	if !s.ws.mouseEnabled {
+		s.selectionEvent(event)
+	}
+
+	return true
+}
+
+// connectExternalSeparator lets the right and bottom borders of the external
+// window be dragged to resize it
+func (w *Window) connectExternalSeparator() {
+	extwin := &w.extwin.QWidget
+	extwin.ConnectMousePressEvent(func(event *gui.QMouseEvent) {
+		if event.Button() != core.Qt__LeftButton || !w.isExternal {
+			return
+		}
+		font := w.getFont()
+		right := EXTWINBORDERSIZE + int(float64(w.cols)*font.truewidth)
+		bottom := EXTWINBORDERSIZE + w.rows*font.lineHeight
+		var vertical bool
+		switch {
+		case event.X() >= right:
+			vertical = true
+		case event.Y() >= bottom:
+			vertical = false
+		default:
+			return
+		}
+		w.s.beginSeparatorDrag(&SeparatorDrag{
+			win:      w,
+			vertical: vertical,
+			widget:   extwin,
+			font:     font,
+			origin:   [2]float64{EXTWINBORDERSIZE, EXTWINBORDERSIZE},
+		})
+	})
+	extwin.ConnectMouseMoveEvent(func(event *gui.QMouseEvent) {
+		if w.s.separatorDrag != nil && w.s.separatorDrag.win == w {
+			w.s.dragSeparator(event)
+		}
+	})
+	extwin.ConnectMouseReleaseEvent(func(event *gui.QMouseEvent) {
+		if w.s.separatorDrag != nil && w.s.separatorDrag.win == w {
+			w.s.dragSeparator(event)
+		}
+	})
+}
+
+// beginSeparatorDrag shows the preview of the drag
+func (s *Screen) beginSeparatorDrag(drag *SeparatorDrag) {
+	preview := widgets.NewQWidget(drag.widget, 0)
+	preview.SetAttribute(core.Qt__WA_TransparentForMouseEvents, true)
+	preview.ConnectPaintEvent(func(*gui.QPaintEvent) {
+		p := gui.NewQPainter2(preview)
+		color := hexToRGBA(editor.config.SideBar.AccentColor)
+		pen := gui.NewQPen3(color.QColor())
+		pen.SetWidth(2)
+		p.SetPen(pen)
+		p.DrawRect3(1, 1, preview.Width()-2, preview.Height()-2)
+		p.DestroyQPainter()
+	})
+	drag.preview = preview
+
+	if drag.vertical {
+		drag.size = drag.win.cols
+		drag.widget.SetCursor(gui.NewQCursor2(core.Qt__SplitHCursor))
+	} else {
+		drag.size = drag.win.rows
+		drag.widget.SetCursor(gui.NewQCursor2(core.Qt__SplitVCursor))
+	}
+	s.separatorDrag = drag
+	s.updateSeparatorPreview()
+	preview.Show()
+	preview.Raise()
+}
+
+// dragSeparator updates the size of the window while dragging the separator,
+// and resizes the window in neovim when the mouse is released
+func (s *Screen) dragSeparator(event *gui.QMouseEvent) {
+	drag := s.separatorDrag
+	font := drag.font
+	win := drag.win
+
+	var size int
+	if drag.vertical {
+		size = int((float64(event.X())-drag.origin[0])/font.truewidth + 0.5)
+	} else {
+		size = int((float64(event.Y())-drag.origin[1])/float64(font.lineHeight) + 0.5)
+	}
+	if size < 1 {
+		size = 1
+	}
+	if size != drag.size {
+		drag.size = size
+		s.updateSeparatorPreview()
+	}
+
+	if event.Type() != core.QEvent__MouseButtonRelease {
+		return
+	}
+	s.separatorDrag = nil
+	drag.preview.Hide()
+	drag.preview.DeleteLater()
+	drag.widget.UnsetCursor()
+
+	resized := (drag.vertical && size != win.cols) || (!drag.vertical && size != win.rows)
+	switch {
+	case resized && win.isExternal:
+		cols, rows := win.cols, win.rows
+		if drag.vertical {
+			cols = size
+		} else {
+			rows = size
+		}
+		go s.ws.nvim.TryResizeUIGrid(win.grid, cols, rows)
+	case resized && drag.vertical:
+		go s.ws.nvim.SetWindowWidth(win.id, size)
+	case resized:
+		go s.ws.nvim.SetWindowHeight(win.id, size)
+	case win.isExternal:
+		// The border of the external window is not a part of the grid
+	case s.ws.mouseEnabled:
+		// The separator was clicked without dragging,
+		// so pass the click to neovim, e.g. to focus the window by the status line
+		if drag.press != "" {
+			s.ws.nvim.Input(drag.press)
+		}
+		s.mouseEvent(event)
+	default:
+		s.selectionEvent(event)
+	}
+}
+
+// updateSeparatorPreview draws the outline of the window in the size after
+// the drag
+func (s *Screen) updateSeparatorPreview() {
+	drag := s.separatorDrag
+	font := drag.font
+	win := drag.win
+
+	cols, rows := win.cols, win.rows
+	if drag.vertical {
+		cols = drag.size
+	} else {
+		rows = drag.size
+	}
+	drag.preview.SetGeometry2(
+		int(drag.origin[0]),
+		int(drag.origin[1]),
+		int(float64(cols)*font.truewidth),
+		rows*font.lineHeight,
+	)
+	drag.preview.Update()
+}
@@ -0,0 +1,579 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/akiyosi/goneovim/util"
+	"github.com/neovim/go-client/nvim"
+	"github.com/therecipe/qt/core"
+)
+
+const (
+	sessionManifestVersion = 1
+	sessionManifestName    = "manifest.json"
+	// autosaveLockName is the file in the sessions directory which has the
+	// pid of the goneovim autosaving the sessions
+	autosaveLockName = "autosave.lock"
+
+	connectionEmbedded = "embedded"
+	connectionNvim     = "nvim"
+	connectionServer   = "server"
+	connectionSsh      = "ssh"
+)
+
+// SessionManifest is saved alongside the vim session files and records the
+// state of the GUI which the vim sessions do not have
+type SessionManifest struct {
+	Version    int                `json:"version"`
+	Active     int                `json:"active"`
+	Window     SessionWindow      `json:"window"`
+	Workspaces []SessionWorkspace `json:"workspaces"`
+}
+
+// SessionWindow is the geometry of the application window.
+// X, Y, Width and Height are the geometry of the window when it is neither
+// maximized nor fullscreen.
+type SessionWindow struct {
+	X          int  `json:"x"`
+	Y          int  `json:"y"`
+	Width      int  `json:"width"`
+	Height     int  `json:"height"`
+	Fullscreen bool `json:"fullscreen"`
+	Maximized  bool `json:"maximized"`
+}
+
+// SessionWorkspace is a workspace in the session manifest
+type SessionWorkspace struct {
+	// Session is the file name of the vim session in the sessions directory
+	Session    string              `json:"session,omitempty"`
+	Cwd        string              `json:"cwd,omitempty"`
+	Name       string              `json:"name,omitempty"`
+	Connection WorkspaceConnection `json:"connection"`
+}
+
+// WorkspaceConnection is how the workspace connects to nvim
+type WorkspaceConnection struct {
+	Type string `json:"type"`
+	// Address is the server address, the path to nvim or the ssh host
+	Address string `json:"address,omitempty"`
+}
+
+// isRemote reports whether the connection attaches to nvim which goneovim
+// did not start, whose state must not be changed by the session
+func (c WorkspaceConnection) isRemote() bool {
+	return c.Type == connectionServer || c.Type == connectionSsh
+}
+
+// defaultConnection returns the connection given by the command line options
+func (e *Editor) defaultConnection() WorkspaceConnection {
+	switch {
+	case e.opts.Server != "":
+		return WorkspaceConnection{Type: connectionServer, Address: e.opts.Server}
+	case e.opts.Nvim != "":
+		return WorkspaceConnection{Type: connectionNvim, Address: e.opts.Nvim}
+	case e.opts.Ssh != "":
+		return WorkspaceConnection{Type: connectionSsh, Address: e.opts.Ssh}
+	default:
+		return WorkspaceConnection{Type: connectionEmbedded}
+	}
+}
+
+func sessionManifestPath(dir string) string {
+	return filepath.Join(dir, sessionManifestName)
+}
+
+// loadSessionManifest reads the manifest in the sessions directory.
+// It returns an error if there is no manifest, or it was written by an
+// incompatible version.
+func loadSessionManifest(dir string) (*SessionManifest, error) {
+	data, err := ioutil.ReadFile(sessionManifestPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSessionManifest(data)
+}
+
+func decodeSessionManifest(data []byte) (*SessionManifest, error) {
+	manifest := &SessionManifest{}
+	err := json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version != sessionManifestVersion {
+		return nil, fmt.Errorf("unsupported session manifest version: %d", manifest.Version)
+	}
+	if len(manifest.Workspaces) == 0 {
+		return nil, fmt.Errorf("session manifest has no workspaces")
+	}
+	if manifest.Active < 0 || manifest.Active >= len(manifest.Workspaces) {
+		manifest.Active = 0
+	}
+
+	return manifest, nil
+}
+
+func saveSessionManifest(dir string, manifest *SessionManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(sessionManifestPath(dir), data, 0644)
+}
+
+// sessionWindow returns the geometry of the application window
+func (e *Editor) sessionWindow() SessionWindow {
+	if e.window == nil {
+		return SessionWindow{}
+	}
+	rect := e.window.NormalGeometry()
+
+	return SessionWindow{
+		X:          rect.X(),
+		Y:          rect.Y(),
+		Width:      rect.Width(),
+		Height:     rect.Height(),
+		Fullscreen: e.window.IsFullScreen(),
+		Maximized:  e.window.IsMaximized(),
+	}
+}
+
+// newSessionManifest collects the state of the workspaces.
+// It must be called on the GUI thread, since it reads the fields of the
+// workspaces which the GUI thread updates.
+func newSessionManifest(active int, window SessionWindow, workspaces []*Workspace) *SessionManifest {
+	manifest := &SessionManifest{
+		Version: sessionManifestVersion,
+		Active:  active,
+		Window:  window,
+	}
+	for i, ws := range workspaces {
+		manifest.Workspaces = append(manifest.Workspaces, SessionWorkspace{
+			Session:    strconv.Itoa(i) + ".vim",
+			Cwd:        ws.cwd,
+			Name:       ws.name,
+			Connection: ws.connection,
+		})
+	}
+
+	return manifest
+}
+
+// sessionNvims returns the nvim of the workspaces, to write their sessions
+// outside the GUI thread
+func sessionNvims(workspaces []*Workspace) []*nvim.Nvim {
+	nvims := make([]*nvim.Nvim, len(workspaces))
+	for i, ws := range workspaces {
+		nvims[i] = ws.nvim
+	}
+
+	return nvims
+}
+
+// writeSession writes the vim sessions of the workspaces and the manifest to
+// dir. The remote nvim would write the session on its own host, so only the
+// connection of the remote workspaces is saved.
+func writeSession(dir string, manifest *SessionManifest, nvims []*nvim.Nvim) error {
+	for i, n := range nvims {
+		if manifest.Workspaces[i].Connection.isRemote() || n == nil {
+			manifest.Workspaces[i].Session = ""
+			continue
+		}
+		sessionPath := filepath.Join(dir, manifest.Workspaces[i].Session)
+		err := mksession(n, sessionPath)
+		if err != nil {
+			editor.putLog("failed to save the session:", err)
+			manifest.Workspaces[i].Session = ""
+		}
+	}
+
+	return saveSessionManifest(dir, manifest)
+}
+
+// mksession writes the vim session to path. v:this_session is restored
+// after that, since the session written by goneovim is not the one the user
+// is working on.
+func mksession(n *nvim.Nvim, path string) error {
+	var thisSession string
+	err := n.Eval("v:this_session", &thisSession)
+	if err != nil {
+		return err
+	}
+	err = n.Command("mksession! " + path)
+	if err != nil {
+		return err
+	}
+
+	return n.SetVVar("this_session", thisSession)
+}
+
+// saveSession writes the vim sessions of all workspaces and the manifest to
+// the sessions directory
+func (e *Editor) saveSession(sessions string) {
+	manifest := newSessionManifest(e.active, e.sessionWindow(), e.workspaces)
+	err := writeSession(sessions, manifest, sessionNvims(e.workspaces))
+	if err != nil {
+		e.putLog("failed to save the session manifest:", err)
+	}
+}
+
+// loadSession reads the manifest to be restored on startup.
+// If there is no manifest, the vim session files are restored as before.
+func (e *Editor) loadSession() {
+	if !e.config.Workspace.RestoreSession || e.recording != nil {
+		return
+	}
+	sessions := filepath.Join(e.configDir, "sessions")
+	manifest, err := loadSessionManifest(sessions)
+	if err == nil {
+		e.session = manifest
+		return
+	}
+	if !os.IsNotExist(err) {
+		e.putLog("ignoring the session manifest:", err)
+	}
+
+	manifest = &SessionManifest{
+		Version: sessionManifestVersion,
+	}
+	for i := 0; ; i++ {
+		name := strconv.Itoa(i) + ".vim"
+		if !isFileExist(filepath.Join(sessions, name)) {
+			break
+		}
+		manifest.Workspaces = append(manifest.Workspaces, SessionWorkspace{
+			Session:    name,
+			Connection: e.defaultConnection(),
+		})
+	}
+	if len(manifest.Workspaces) == 0 {
+		return
+	}
+	e.session = manifest
+}
+
+// restoreWindowGeometry applies the window geometry of the session.
+// The command line options take precedence over the session.
+func (e *Editor) restoreWindowGeometry() {
+	if e.session == nil || e.session.Window.Width <= 0 || e.session.Window.Height <= 0 {
+		return
+	}
+	win := e.session.Window
+	if e.opts.Geometry == "" {
+		e.window.Move2(win.X, win.Y)
+		e.window.Resize2(win.Width, win.Height)
+		e.width = win.Width
+		e.height = win.Height
+	}
+	if e.opts.Fullscreen || e.opts.Maximized {
+		return
+	}
+	if e.config.Editor.StartFullscreen || e.config.Editor.StartMaximizedWindow {
+		return
+	}
+	if win.Fullscreen {
+		e.window.ShowFullScreen()
+	} else if win.Maximized {
+		e.window.WindowMaximize()
+	}
+}
+
+// restoreWorkspaces creates the workspaces saved in the session in dir.
+// The workspaces which fail to start are skipped, and the index of the active
+// workspace among the restored ones is returned with them. If the active one
+// is skipped, the restored one before it becomes active.
+func (e *Editor) restoreWorkspaces(dir string, manifest *SessionManifest) ([]*Workspace, int) {
+	workspaces := []*Workspace{}
+	active := 0
+	for i, sw := range manifest.Workspaces {
+		ws, err := e.restoreWorkspace(dir, sw)
+		if err != nil {
+			e.putLog("failed to restore the workspace", i, ":", err)
+			continue
+		}
+		if i <= manifest.Active {
+			active = len(workspaces)
+		}
+		workspaces = append(workspaces, ws)
+	}
+
+	return workspaces, active
+}
+
+// restoreWorkspace creates the workspace saved in the session in dir.
+// The session is not sourced into the remote nvim, which has its own state.
+func (e *Editor) restoreWorkspace(dir string, sw SessionWorkspace) (*Workspace, error) {
+	if sw.Connection.Type == "" {
+		sw.Connection = e.defaultConnection()
+	}
+	path := ""
+	if sw.Session != "" && !sw.Connection.isRemote() {
+		path = filepath.Join(dir, sw.Session)
+		if !isFileExist(path) {
+			path = ""
+		}
+	}
+
+	return newSessionWorkspace(path, sw)
+}
+
+// dial connects to nvim as the connection of the workspace
+func (w *Workspace) dial(childProcessArgs nvim.ChildProcessOption) (*nvim.Nvim, error) {
+	conn := w.connection
+	switch conn.Type {
+	case connectionServer:
+		// Attaching to remote nvim session
+		w.uiRemoteAttached = true
+		return nvim.Dial(conn.Address)
+	case connectionNvim:
+		// Attaching to /path/to/nvim
+		childProcessCmd := nvim.ChildProcessCommand(conn.Address)
+		return nvim.NewChildProcess(childProcessArgs, childProcessCmd)
+	case connectionSsh:
+		// Attaching remote nvim via ssh
+		w.uiRemoteAttached = true
+		return newRemoteChildProcess(conn.Address)
+	default:
+		// Attaching to nvim normally
+		return nvim.NewChildProcess(childProcessArgs)
+	}
+}
+
+// initAutosave offers to restore the autosaved workspaces if the previous
+// goneovim did not quit cleanly, and starts autosaving the sessions.
+// The goneovim autosaving the sessions holds the lock file with its pid, and
+// the clean quit removes it with the sessions directory. The autosave is
+// left by the unclean shutdown only if the owner of the lock is gone, and
+// it is not touched while the owner is running.
+func (e *Editor) initAutosave() {
+	if e.recording != nil {
+		return
+	}
+	sessions := filepath.Join(e.configDir, "sessions")
+	autosave := filepath.Join(sessions, "autosave")
+	pid := readAutosaveLock(sessions)
+	if pid != 0 && pid != os.Getpid() && util.IsProcessRunning(pid) {
+		e.putLog("the sessions are autosaved by another goneovim, pid", pid)
+		return
+	}
+
+	os.RemoveAll(autosave + ".tmp")
+	if !isFileExist(sessionManifestPath(autosave)) {
+		// The previous goneovim stopped while replacing the autosave
+		os.RemoveAll(autosave)
+		os.Rename(autosave+".old", autosave)
+	}
+	os.RemoveAll(autosave + ".old")
+	if pid != 0 && isFileExist(sessionManifestPath(autosave)) {
+		recovery := filepath.Join(sessions, "recovery")
+		os.RemoveAll(recovery)
+		err := os.Rename(autosave, recovery)
+		if err != nil {
+			e.putLog("failed to keep the autosaved session:", err)
+		} else {
+			e.offerRecovery(recovery)
+		}
+	}
+	os.RemoveAll(autosave)
+
+	err := writeAutosaveLock(sessions)
+	if err != nil {
+		e.putLog("failed to lock the autosave:", err)
+		return
+	}
+	e.autosaveOwner = true
+
+	interval := e.config.Workspace.AutoSaveInterval
+	if interval <= 0 {
+		return
+	}
+	e.autosaveTimer = core.NewQTimer(nil)
+	e.autosaveTimer.ConnectTimeout(e.autosaveSession)
+	e.autosaveTimer.Start(interval * 1000)
+}
+
+// readAutosaveLock returns the pid in the autosave lock file, or 0 if there
+// is no lock
+func readAutosaveLock(sessions string) int {
+	data, err := ioutil.ReadFile(filepath.Join(sessions, autosaveLockName))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+
+	return pid
+}
+
+func writeAutosaveLock(sessions string) error {
+	err := os.MkdirAll(sessions, 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		filepath.Join(sessions, autosaveLockName),
+		[]byte(strconv.Itoa(os.Getpid())),
+		0644,
+	)
+}
+
+// clearSessions empties the sessions directory. The autosave and its lock are
+// kept if another goneovim owns them.
+func (e *Editor) clearSessions(sessions string) {
+	if e.autosaveOwner {
+		os.RemoveAll(sessions)
+		os.MkdirAll(sessions, 0755)
+		return
+	}
+	entries, err := ioutil.ReadDir(sessions)
+	if err != nil {
+		os.MkdirAll(sessions, 0755)
+		return
+	}
+	for _, entry := range entries {
+		switch entry.Name() {
+		case "autosave", "autosave.tmp", "autosave.old", autosaveLockName:
+			continue
+		}
+		os.RemoveAll(filepath.Join(sessions, entry.Name()))
+	}
+}
+
+// offerRecovery asks whether to restore the workspaces autosaved in dir
+func (e *Editor) offerRecovery(dir string) {
+	manifest, err := loadSessionManifest(dir)
+	if err != nil {
+		e.putLog("ignoring the autosaved session:", err)
+		return
+	}
+
+	message := "[Goneovim] Goneovim did not quit cleanly. Do you want to restore the autosaved workspaces?"
+	opts := []*NotifyButton{}
+	opt1 := &NotifyButton{
+		action: func() {
+			e.restoreRecovery(dir, manifest)
+		},
+		text: "Restore",
+	}
+	opts = append(opts, opt1)
+
+	opt2 := &NotifyButton{
+		action: func() {
+			os.RemoveAll(dir)
+		},
+		text: "Discard",
+	}
+	opts = append(opts, opt2)
+
+	e.pushNotification(NotifyWarn, 0, message, notifyOptionArg(opts))
+}
+
+// restoreRecovery adds the workspaces autosaved in dir
+func (e *Editor) restoreRecovery(dir string, manifest *SessionManifest) {
+	editor.isSetGuiColor = false
+	workspaces, active := e.restoreWorkspaces(dir, manifest)
+	if len(workspaces) == 0 {
+		return
+	}
+	e.active = len(e.workspaces) + active
+	e.workspaces = append(e.workspaces, workspaces...)
+	e.workspaceUpdate()
+}
+
+// autosaveSession writes the sessions of all workspaces to the autosave
+// directory in the background
+func (e *Editor) autosaveSession() {
+	if e.config.Workspace.AutoSaveInterval <= 0 || e.recording != nil || !e.autosaveOwner {
+		return
+	}
+	for _, ws := range e.workspaces {
+		// uiAttached is set by the goroutine initializing the workspace
+		ws.fontMutex.Lock()
+		uiAttached := ws.uiAttached
+		ws.fontMutex.Unlock()
+		if ws.nvim == nil || !uiAttached {
+			return
+		}
+	}
+
+	e.autosaveMutex.Lock()
+	if e.autosaving || e.autosaveStopped {
+		e.autosaveMutex.Unlock()
+		return
+	}
+	e.autosaving = true
+	e.autosaveWait.Add(1)
+	e.autosaveMutex.Unlock()
+
+	manifest := newSessionManifest(e.active, e.sessionWindow(), e.workspaces)
+	nvims := sessionNvims(e.workspaces)
+	dir := filepath.Join(e.configDir, "sessions", "autosave")
+
+	go func() {
+		defer func() {
+			e.autosaveMutex.Lock()
+			e.autosaving = false
+			e.autosaveMutex.Unlock()
+			e.autosaveWait.Done()
+		}()
+
+		err := replaceSession(dir, manifest, nvims)
+		if err != nil {
+			e.putLog("failed to autosave the session:", err)
+		}
+	}()
+}
+
+// replaceSession writes the sessions into a temporary directory and renames
+// it to dir, so that dir never has a partially written session. The previous
+// session is kept as dir.old until the new one is in place.
+func replaceSession(dir string, manifest *SessionManifest, nvims []*nvim.Nvim) error {
+	tmp := dir + ".tmp"
+	old := dir + ".old"
+	os.RemoveAll(tmp)
+	err := os.MkdirAll(tmp, 0755)
+	if err != nil {
+		return err
+	}
+	err = writeSession(tmp, manifest, nvims)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if isFileExist(dir) {
+		os.RemoveAll(old)
+		err = os.Rename(dir, old)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+	err = os.Rename(tmp, dir)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(old)
+}
+
+// stopAutosave stops the autosave after waiting for the one in progress
+func (e *Editor) stopAutosave() {
+	if e.autosaveTimer != nil {
+		e.autosaveTimer.Stop()
+	}
+	e.autosaveMutex.Lock()
+	e.autosaveStopped = true
+	e.autosaveMutex.Unlock()
+	e.autosaveWait.Wait()
+}
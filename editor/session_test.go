@@ -0,0 +1,124 @@
+package editor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSessionManifest(t *testing.T) {
+	manifest := &SessionManifest{
+		Version: sessionManifestVersion,
+		Active:  1,
+		Window: SessionWindow{
+			X:         10,
+			Y:         20,
+			Width:     800,
+			Height:    600,
+			Maximized: true,
+		},
+		Workspaces: []SessionWorkspace{
+			{
+				Session:    "0.vim",
+				Cwd:        "/tmp",
+				Name:       "tmp",
+				Connection: WorkspaceConnection{Type: connectionEmbedded},
+			},
+			{
+				Session:    "1.vim",
+				Cwd:        "/home",
+				Connection: WorkspaceConnection{Type: connectionServer, Address: "127.0.0.1:6666"},
+			},
+		},
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeSessionManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, manifest) {
+		t.Errorf("decodeSessionManifest() = %v, want %v", got, manifest)
+	}
+}
+
+func TestDecodeSessionManifestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"broken", `{"version":`},
+		{"old version", `{"version":0,"workspaces":[{"session":"0.vim"}]}`},
+		{"new version", `{"version":2,"workspaces":[{"session":"0.vim"}]}`},
+		{"no workspaces", `{"version":1,"workspaces":[]}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeSessionManifest([]byte(tt.data)); err == nil {
+				t.Errorf("decodeSessionManifest(%s) succeeded", tt.data)
+			}
+		})
+	}
+}
+
+func TestDecodeSessionManifestActive(t *testing.T) {
+	data := `{"version":1,"active":3,"workspaces":[{"session":"0.vim"}]}`
+	got, err := decodeSessionManifest([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Active != 0 {
+		t.Errorf("Active = %d, want 0", got.Active)
+	}
+}
+
+func TestReplaceSession(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "autosave")
+	for active := 0; active < 2; active++ {
+		manifest := &SessionManifest{
+			Version: sessionManifestVersion,
+			Active:  active,
+		}
+		if err := replaceSession(dir, manifest, nil); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(sessionManifestPath(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := json.MarshalIndent(manifest, "", "  ")
+		if string(got) != string(want) {
+			t.Errorf("manifest = %s, want %s", got, want)
+		}
+		for _, leftover := range []string{dir + ".tmp", dir + ".old"} {
+			if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+				t.Errorf("%s is left", leftover)
+			}
+		}
+	}
+}
+
+func TestAutosaveLock(t *testing.T) {
+	sessions := filepath.Join(t.TempDir(), "sessions")
+	if pid := readAutosaveLock(sessions); pid != 0 {
+		t.Errorf("readAutosaveLock() without lock = %d, want 0", pid)
+	}
+	if err := writeAutosaveLock(sessions); err != nil {
+		t.Fatal(err)
+	}
+	if pid := readAutosaveLock(sessions); pid != os.Getpid() {
+		t.Errorf("readAutosaveLock() = %d, want %d", pid, os.Getpid())
+	}
+	if err := ioutil.WriteFile(filepath.Join(sessions, autosaveLockName), []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid := readAutosaveLock(sessions); pid != 0 {
+		t.Errorf("readAutosaveLock() of broken lock = %d, want 0", pid)
+	}
+}
@@ -38,6 +38,7 @@ type Statusline struct {
 	encoding   *StatuslineEncoding
 	fileFormat *StatuslineFileFormat
 	lint       *StatuslineLint
+	busy       *StatuslineBusy
 
 	updates chan []interface{}
 }
@@ -139,6 +140,11 @@ type StatuslineFileFormat struct {
 	c          *StatuslineComponent
 }
 
+// StatuslineBusy is the busy indicator in statusline
+type StatuslineBusy struct {
+	c *StatuslineComponent
+}
+
 func initStatusline() *Statusline {
 	widget := widgets.NewQWidget(nil, 0)
 	widget.SetContentsMargins(0, 0, 0, 0)
@@ -285,6 +291,15 @@ func initStatusline() *Statusline {
 	s.filetype = filetype
 	s.filetype.c.hide()
 
+	busyLabel := widgets.NewQLabel(nil, 0)
+	busy := &StatuslineBusy{
+		c: &StatuslineComponent{
+			label: busyLabel,
+		},
+	}
+	s.busy = busy
+	s.busy.c.hide()
+
 	okIcon := svg.NewQSvgWidget(nil)
 	okIcon.SetFixedSize2(editor.iconSize, editor.iconSize)
 	okLabel := widgets.NewQLabel(nil, 0)
@@ -336,6 +351,10 @@ func initStatusline() *Statusline {
 
 		left.setWidget()
 		s.setWidget()
+		if editor.config.Editor.BusyIndicator == "statusline" {
+			leftLayout.AddWidget(busyLabel, 0, 0)
+			s.busy.c.isInclude = true
+		}
 	}()
 
 	return s
@@ -505,6 +524,7 @@ func (s *Statusline) setColor() {
 	s.encoding.c.setColor(fg, bg)
 	s.fileFormat.c.setColor(fg, bg)
 	s.pos.c.setColor(fg, bg)
+	s.busy.c.setColor(fg, bg)
 
 	s.lint.c.fg = fg
 	s.lint.c.bg = bg
@@ -551,6 +571,7 @@ func (s *Statusline) updateFont() {
 	s.git.c.label.SetFont(font)
 	s.encoding.c.label.SetFont(font)
 	s.fileFormat.c.label.SetFont(font)
+	s.busy.c.label.SetFont(font)
 }
 
 func (s *Statusline) subscribe() {
@@ -576,13 +597,22 @@ func (s *Statusline) subscribe() {
 }
 
 func (s *Statusline) handleUpdates(updates []interface{}) {
-	event := updates[0].(string)
+	if len(updates) == 0 {
+		return
+	}
+	event, ok := updates[0].(string)
+	if !ok {
+		return
+	}
 	switch event {
 	case "bufenter":
+		if len(updates) < 5 {
+			return
+		}
 		// file := updates[1].(string)
-		filetype := updates[1].(string)
-		encoding := updates[2].(string)
-		fileFormat := updates[3].(string)
+		filetype, _ := updates[1].(string)
+		encoding, _ := updates[2].(string)
+		fileFormat, _ := updates[3].(string)
 
 		ro := 0
 		switch updates[4].(type) {
@@ -876,6 +906,15 @@ func (s *StatuslinePos) redraw(ln, col int) {
 	}
 }
 
+func (s *StatuslineBusy) redraw(frame string) {
+	s.c.label.SetText(frame)
+	if frame == "" {
+		s.c.hide()
+		return
+	}
+	s.c.show()
+}
+
 func (s *StatuslineEncoding) redraw(encoding string) {
 	if s.encoding == encoding {
 		return
@@ -330,26 +330,21 @@ func (t *Tabline) updateTabs() {
 	}
 }
 
-func (t *Tabline) update(args []interface{}) {
-	arg := args[0].([]interface{})
-	t.CurrentID = int(arg[0].(nvim.Tabpage))
-	tabs := arg[1].([]interface{})
+func (t *Tabline) update(arg tablineUpdate) {
+	t.CurrentID = int(arg.current)
+	tabs := arg.tabs
 	if len(tabs) == 1 {
 		t.Tabs[0].setActive(false)
 		t.Tabs[0].updateStyle()
 	}
-	for i, tabInterface := range tabs {
-		tabMap, ok := tabInterface.(map[string]interface{})
-		if !ok {
-			continue
-		}
+	for i, info := range tabs {
 		if i > len(t.Tabs)-1 {
 			return
 		}
 
 		tab := t.Tabs[i]
-		tab.ID = int(tabMap["tab"].(nvim.Tabpage))
-		text := tabMap["name"].(string)
+		tab.ID = int(info.tab)
+		text := info.name
 		tab.setActive(tab.ID == t.CurrentID)
 
 		fileType := getFileType(text)
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math"
 	"os/exec"
 	"path/filepath"
 	"runtime"
@@ -17,6 +16,7 @@ import (
 
 	"github.com/akiyosi/goneovim/filer"
 	"github.com/akiyosi/goneovim/fuzzy"
+	"github.com/akiyosi/goneovim/grid"
 	"github.com/akiyosi/goneovim/util"
 	shortpath "github.com/akiyosi/short_path"
 	"github.com/neovim/go-client/nvim"
@@ -69,6 +69,7 @@ type Workspace struct {
 	signature *Signature
 	message   *Message
 	minimap   *MiniMap
+	busy      *BusyIndicator
 
 	width  int
 	height int
@@ -87,18 +88,22 @@ type Workspace struct {
 	mode               string
 	modeIdx            int
 	filepath           string
+	title              string
 	cwd                string
 	cwdBase            string
 	cwdlabel           string
+	name               string
+	connection         WorkspaceConnection
 	maxLine            int
-	viewport           [4]int    // topline, botline, curline, curcol
-	oldViewport        [4]int    // topline, botline, curline, curcol
-	scrollViewport     [2][5]int // 1. topline, botline, curline, curcol, grid, 2. oldtopline, oldbotline, oldcurline, oldcurcol, oldgrid
-	viewportQue        chan [5]int
+	viewport           [4]int // topline, botline, curline, curcol
+	oldViewport        [4]int // topline, botline, curline, curcol
 	viewportMutex      sync.RWMutex
 	optionsetMutex     sync.RWMutex
 	cursorStyleEnabled bool
-	modeInfo           []map[string]interface{}
+	mouseEnabled       bool
+	ligatures          bool
+	widthOptions       grid.WidthOptions
+	modeInfo           []modeInfo
 	normalMappings     []*nvim.Mapping
 	insertMappings     []*nvim.Mapping
 	ts                 int
@@ -107,12 +112,15 @@ type Workspace struct {
 	showtabline        int
 	api5               bool
 
+	recordID int
+
 	escKeyInNormal     string
 	escKeyInInsert     string
 	isMappingScrollKey bool
 
 	signal        *workspaceSignal
-	redrawUpdates chan [][]interface{}
+	redrawQueue   chan [][]interface{}
+	redrawUpdates chan []redrawEvent
 	guiUpdates    chan []interface{}
 	stopOnce      sync.Once
 	stop          chan struct{}
@@ -124,16 +132,30 @@ type Workspace struct {
 }
 
 func newWorkspace(path string) (*Workspace, error) {
+	return newSessionWorkspace(path, SessionWorkspace{
+		Connection: editor.defaultConnection(),
+	})
+}
+
+// newSessionWorkspace creates the workspace which connects to nvim as the
+// connection of sw, and sources the vim session of path
+func newSessionWorkspace(path string, sw SessionWorkspace) (*Workspace, error) {
 	editor.putLog("initialize workspace")
 	w := &Workspace{
+		connection:    sw.Connection,
+		cwd:           sw.Cwd,
+		name:          sw.Name,
 		stop:          make(chan struct{}),
 		signal:        NewWorkspaceSignal(nil),
-		redrawUpdates: make(chan [][]interface{}, 1000),
+		redrawQueue:   make(chan [][]interface{}, 1000),
+		redrawUpdates: make(chan []redrawEvent, 1000),
 		guiUpdates:    make(chan []interface{}, 1000),
-		viewportQue:   make(chan [5]int, 99),
 		foreground:    newRGBA(255, 255, 255, 1),
 		background:    newRGBA(0, 0, 0, 1),
 		special:       newRGBA(255, 255, 255, 1),
+		mouseEnabled:  true,
+		ligatures:     !editor.config.Editor.DisableLigatures,
+		widthOptions:  grid.DefaultWidthOptions,
 	}
 	w.registerSignal()
 
@@ -159,6 +181,9 @@ func newWorkspace(path string) (*Workspace, error) {
 	w.cursor = initCursorNew()
 	w.cursor.ws = w
 
+	// busy indicator
+	w.busy = newBusyIndicator(w)
+
 	// If ExtFooBar is true, then we create a UI component
 	// tabline
 	if editor.config.Editor.ExtTabline {
@@ -187,6 +212,7 @@ func newWorkspace(path string) (*Workspace, error) {
 		w.message = initMessage()
 		w.message.ws = w
 		w.message.widget.SetParent(editor.window)
+		w.message.indicator.SetParent(w.screen.widget)
 	}
 
 	// If Statusline.Visible is true, then we create statusline UI component
@@ -391,36 +417,7 @@ func (w *Workspace) registerSignal() {
 		// 		editor.workspaces[editor.active].minimap.exit()
 		// 	}
 		// }
-		workspaces := []*Workspace{}
-		index := 0
-		for i, ws := range editor.workspaces {
-			if ws != w {
-				workspaces = append(workspaces, ws)
-			} else {
-				index = i
-			}
-		}
-
-		if len(workspaces) == 0 {
-			editor.close()
-			return
-		}
-		editor.workspaces = workspaces
-
-		items := []*WorkspaceSideItem{}
-		for i, item := range editor.side.items {
-			if i != index {
-				items = append(items, item)
-			}
-		}
-
-		w.hide()
-		if editor.active == index {
-			if index > 0 {
-				editor.active--
-			}
-			editor.workspaceUpdate()
-		}
+		editor.workspaceRemove(w)
 	})
 }
 
@@ -478,35 +475,43 @@ func (w *Workspace) startNvim(path string) error {
 	childProcessArgs := nvim.ChildProcessArgs(
 		append(option, editor.args...)...,
 	)
-	if editor.opts.Server != "" {
-		// Attaching to remote nvim session
-		neovim, err = nvim.Dial(editor.opts.Server)
+	if editor.recording != nil {
+		// Replaying the recording without nvim
+		neovim, err = newReplayNvim()
 		w.uiRemoteAttached = true
-	} else if editor.opts.Nvim != "" {
-		// Attaching to /path/to/nvim
-		childProcessCmd := nvim.ChildProcessCommand(editor.opts.Nvim)
-		neovim, err = nvim.NewChildProcess(childProcessArgs, childProcessCmd)
-	} else if editor.opts.Ssh != "" {
-		// Attaching remote nvim via ssh
-		w.uiRemoteAttached = true
-		neovim, err = newRemoteChildProcess()
 	} else {
-		// Attaching to nvim normally
-		neovim, err = nvim.NewChildProcess(childProcessArgs)
+		neovim, err = w.dial(childProcessArgs)
+		if err != nil && w.connection != editor.defaultConnection() {
+			// The nvim of the restored session may be gone
+			editor.putLog("failed to restore the connection:", err)
+			w.connection = editor.defaultConnection()
+			w.uiRemoteAttached = false
+			neovim, err = w.dial(childProcessArgs)
+		}
 	}
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
+	recorder := editor.recorder
+	if recorder != nil {
+		w.recordID = recorder.newWorkspaceID()
+	}
 	neovim.RegisterHandler("Gui", func(updates ...interface{}) {
+		if recorder != nil {
+			recorder.gui(w.recordID, updates)
+		}
 		w.guiUpdates <- updates
 		w.signal.GuiSignal()
 	})
 	neovim.RegisterHandler("redraw", func(updates ...[]interface{}) {
-		w.redrawUpdates <- updates
-		w.signal.RedrawSignal()
+		if recorder != nil {
+			recorder.redraw(w.recordID, updates)
+		}
+		w.redrawQueue <- updates
 	})
+	go w.decodeRedraw()
 
 	editor.putLog("done starting nvim")
 
@@ -526,6 +531,12 @@ func (w *Workspace) startNvim(path string) error {
 		w.signal.StopSignal()
 	}()
 
+	if editor.recording != nil {
+		w.applyRecordedSize(editor.recording)
+		go w.replay(editor.recording)
+		return nil
+	}
+
 	go w.init(path)
 
 	return nil
@@ -533,7 +544,7 @@ func (w *Workspace) startNvim(path string) error {
 
 var embedProcAttr *syscall.SysProcAttr
 
-func newRemoteChildProcess() (*nvim.Nvim, error) {
+func newRemoteChildProcess(host string) (*nvim.Nvim, error) {
 	logf := log.Printf
 	command := "ssh"
 	if runtime.GOOS == "windows" {
@@ -543,7 +554,7 @@ func newRemoteChildProcess() (*nvim.Nvim, error) {
 
 	userhost := ""
 	port := "22"
-	parts := strings.Split(editor.opts.Ssh, ":")
+	parts := strings.Split(host, ":")
 	if len(parts) >= 3 {
 		return nil, errors.New("Invalid hostname")
 	}
@@ -633,15 +644,30 @@ func (w *Workspace) attachUI(path string) error {
 	w.uiAttached = true
 
 	editor.putLog("attaching UI")
-	err := w.nvim.AttachUI(w.cols, w.rows, w.attachUIOption())
+	option := w.attachUIOption()
+	if editor.recorder != nil {
+		editor.recorder.attach(w.recordID, w.cols, w.rows, option, w.api5)
+	}
+	err := w.nvim.AttachUI(w.cols, w.rows, option)
 	if err != nil {
 		fmt.Println(err)
 		editor.close()
 		return err
 	}
 
+	// Tell neovim the height and the bounds of the popupmenu of goneovim
+	if w.popup != nil {
+		go w.popup.reportLoop()
+	}
+
+	// The remote nvim keeps its own session and working directory
+	if w.connection.isRemote() {
+		return nil
+	}
 	if path != "" {
 		go w.nvim.Command("so " + path)
+	} else if w.cwd != "" {
+		go w.nvim.SetCurrentDirectory(w.cwd)
 	}
 
 	return nil
@@ -702,6 +728,11 @@ func (w *Workspace) initGonvim() {
 
 	gonvimCommands := fmt.Sprintf(`
 	command! -nargs=1 GonvimResize call rpcnotify(0, "Gui", "gonvim_resize", <args>)
+	command! -nargs=1 GonvimLigatures call rpcnotify(0, "Gui", "gonvim_ligatures", <args>)
+	command! -nargs=* GonvimFontFeatures call rpcnotify(0, "Gui", "gonvim_font_features", <f-args>)
+	command! -nargs=? GonvimFontBold call rpcnotify(0, "Gui", "gonvim_font_style", "bold", <q-args>)
+	command! -nargs=? GonvimFontItalic call rpcnotify(0, "Gui", "gonvim_font_style", "italic", <q-args>)
+	command! -nargs=? GonvimFontBoldItalic call rpcnotify(0, "Gui", "gonvim_font_style", "bolditalic", <q-args>)
 	command! GonvimSidebarShow call rpcnotify(0, "Gui", "side_open")
 	command! GonvimVersion echo "%s"`, editor.version)
 	if !editor.config.Markdown.Disable {
@@ -720,6 +751,9 @@ func (w *Workspace) initGonvim() {
 	command! GonvimWorkspaceNext call rpcnotify(0, "Gui", "gonvim_workspace_next")
 	command! GonvimWorkspacePrevious call rpcnotify(0, "Gui", "gonvim_workspace_previous")
 	command! -nargs=1 GonvimWorkspaceSwitch call rpcnotify(0, "Gui", "gonvim_workspace_switch", <args>)
+	command! -nargs=? GonvimWorkspaceClose call rpcnotify(0, "Gui", "gonvim_workspace_close", <q-args>)
+	command! -nargs=? GonvimWorkspaceRename call rpcnotify(0, "Gui", "gonvim_workspace_rename", <q-args>)
+	command! -nargs=1 GonvimWorkspaceMove call rpcnotify(0, "Gui", "gonvim_workspace_move", <args>)
 	command! -nargs=1 GonvimGridFont call rpcnotify(0, "Gui", "gonvim_grid_font", <args>)
 	`
 	}
@@ -947,17 +981,9 @@ func (w *Workspace) nvimEval(s string) (interface{}, error) {
 	}
 }
 
-func (w *Workspace) handleChangeCwd(cwdinfo map[string]interface{}) {
-	scope, ok := cwdinfo["scope"]
-	if !ok {
-		scope = "global"
-	}
-	cwdITF, ok := cwdinfo["cwd"]
-	if !ok {
-		return
-	}
-	cwd := cwdITF.(string)
-	switch scope {
+func (w *Workspace) handleChangeCwd(cwdinfo workspaceCwd) {
+	cwd := cwdinfo.cwd
+	switch cwdinfo.scope {
 	case "global":
 		w.setCwd(cwd)
 	case "tab":
@@ -998,7 +1024,7 @@ func (w *Workspace) setCwd(cwd string) {
 				continue
 			}
 
-			sideItem.label.SetText(w.cwdlabel)
+			sideItem.setText(w.sideLabel())
 			sideItem.label.SetFont(gui.NewQFont2(editor.extFontFamily, editor.extFontSize-1, 1, false))
 			sideItem.cwdpath = path
 		}
@@ -1174,16 +1200,17 @@ func (e *Editor) updateNotificationPos() {
 	e.notifications = newNotifications
 }
 
-func (w *Workspace) handleRedraw(updates [][]interface{}) {
+func (w *Workspace) handleRedraw(events []redrawEvent) {
 	s := w.screen
-	for _, update := range updates {
-		event := update[0].(string)
-		args := update[1:]
+	for _, e := range events {
+		event := e.name
+		args := e.args
 		editor.putLog("start   ", event)
 		switch event {
 		// Global Events
 		case "set_title":
-			titleStr := (update[1].([]interface{}))[0].(string)
+			titleStr := args.([]string)[0]
+			w.title = titleStr
 			editor.window.SetupTitle(titleStr)
 			if runtime.GOOS == "linux" {
 				editor.window.SetWindowTitle(titleStr)
@@ -1191,66 +1218,70 @@ func (w *Workspace) handleRedraw(updates [][]interface{}) {
 
 		case "set_icon":
 		case "mode_info_set":
-			w.modeInfoSet(args)
+			w.modeInfoSet(args.([]modeInfoSet))
 			w.cursor.modeIdx = 0
 			w.cursor.update()
 		case "option_set":
-			w.setOption(update)
+			w.setOption(args.([]optionSet))
 		case "mode_change":
-			arg := update[len(update)-1].([]interface{})
-			w.mode = arg[0].(string)
-			w.modeIdx = util.ReflectToInt(arg[1])
+			changes := args.([]modeChange)
+			arg := changes[len(changes)-1]
+			w.mode = arg.mode
+			w.modeIdx = arg.idx
 			if w.cursor.modeIdx != w.modeIdx {
 				w.cursor.modeIdx = w.modeIdx
 				w.cursor.update()
 			}
 			w.disableImeInNormal()
 		case "mouse_on":
+			w.setMouse(true)
 		case "mouse_off":
+			w.setMouse(false)
 		case "busy_start":
+			w.cursor.setBusy(true)
+			w.busy.start()
 		case "busy_stop":
+			w.cursor.setBusy(false)
+			w.busy.stop()
 		case "suspend":
 		case "update_menu":
-		case "bell":
-		case "visual_bell":
+		case "bell", "visual_bell":
+			w.bell()
 		case "flush":
+			s.applyDamage(e.damage)
 			w.flush()
 
 		// Grid Events
 		case "grid_resize":
-			s.gridResize(args)
+			s.gridResize(args.([]gridResize))
 		case "default_colors_set":
-			for _, u := range update[1:] {
-				w.setColorsSet(u.([]interface{}))
+			for _, c := range args.([]defaultColorsSet) {
+				w.setColorsSet(c)
 			}
 		case "hl_attr_define":
-			s.setHlAttrDef(args)
+			s.hlAttrDef = e.hlAttrDef
 			// if goneovim own statusline is visible
 			if w.drawStatusline {
 				w.statusline.getColor()
 			}
 		case "hl_group_set":
-			s.setHighlightGroup(args)
-		case "grid_line":
-			s.gridLine(args)
-		case "grid_clear":
-			s.gridClear(args)
+			s.setHighlightGroup(args.([]hlGroupSet))
 		case "grid_destroy":
-			s.gridDestroy(args)
+			s.gridDestroy(args.([]gridId))
 		case "grid_cursor_goto":
-			s.gridCursorGoto(args)
+			s.gridCursorGoto(args.([]gridCursorGoto))
 		case "grid_scroll":
-			s.gridScroll(args)
+			s.gridScroll(args.([]gridScroll))
 
 		// Multigrid Events
 		case "win_pos":
-			s.windowPosition(args)
+			s.windowPosition(args.([]winPos))
 		case "win_float_pos":
-			s.windowFloatPosition(args)
+			s.windowFloatPosition(args.([]winFloatPos))
 		case "win_external_pos":
-			s.windowExternalPosition(args)
+			s.windowExternalPosition(args.([]gridId))
 		case "win_hide":
-			s.windowHide(args)
+			s.windowHide(args.([]gridId))
 		case "win_scroll_over_start":
 			// old impl
 			// s.windowScrollOverStart()
@@ -1260,39 +1291,45 @@ func (w *Workspace) handleRedraw(updates [][]interface{}) {
 		case "win_close":
 			s.windowClose()
 		case "msg_set_pos":
-			s.msgSetPos(args)
+			s.msgSetPos(args.([]msgSetPos))
 		case "win_viewport":
-			w.windowViewport(args[0].([]interface{}))
+			viewports := args.([]winViewport)
+			w.windowViewport(viewports[0])
+			for _, viewport := range viewports {
+				w.windowScroll(viewport)
+			}
 
 		// Popupmenu Events
 		case "popupmenu_show":
+			shows := args.([]popupmenuShow)
 			if w.cmdline != nil {
 				if w.cmdline.shown {
-					w.cmdline.cmdWildmenuShow(args)
+					w.cmdline.cmdWildmenuShow(shows)
 				}
 			}
 			if w.popup != nil {
 				if w.cmdline != nil {
 					if !w.cmdline.shown {
-						w.popup.showItems(args)
+						w.popup.showItems(shows[0])
 					}
 				} else {
-					w.popup.showItems(args)
+					w.popup.showItems(shows[0])
 				}
 			}
 		case "popupmenu_select":
+			selected := args.([]int)[0]
 			if w.cmdline != nil {
 				if w.cmdline.shown {
-					w.cmdline.cmdWildmenuSelect(args)
+					w.cmdline.cmdWildmenuSelect(selected)
 				}
 			}
 			if w.popup != nil {
 				if w.cmdline != nil {
 					if !w.cmdline.shown {
-						w.popup.selectItem(args)
+						w.popup.selectItem(selected)
 					}
 				} else {
-					w.popup.selectItem(args)
+					w.popup.selectItem(selected)
 				}
 			}
 		case "popupmenu_hide":
@@ -1313,29 +1350,32 @@ func (w *Workspace) handleRedraw(updates [][]interface{}) {
 		// Tabline Events
 		case "tabline_update":
 			if w.tabline != nil {
-				w.tabline.update(args)
+				w.tabline.update(args.([]tablineUpdate)[0])
 			}
 
 		// Cmdline Events
 		case "cmdline_show":
 			if w.cmdline != nil {
-				w.cmdline.show(args)
+				w.cmdline.show(args.([]cmdlineShow)[0])
 			}
 
 		case "cmdline_pos":
 			if w.cmdline != nil {
-				w.cmdline.changePos(args)
+				w.cmdline.changePos(args.([]cmdlinePos)[0])
 			}
 
 		case "cmdline_special_char":
+			if w.cmdline != nil {
+				w.cmdline.specialChar(args.([]cmdlineSpecialChar)[0])
+			}
 
 		case "cmdline_char":
 			if w.cmdline != nil {
-				w.cmdline.putChar(args)
+				w.cmdline.putChar(args.([]string)[0])
 			}
 		case "cmdline_hide":
 			if w.cmdline != nil {
-				w.cmdline.hide()
+				w.cmdline.hide(args.([]cmdlineHide))
 			}
 		case "cmdline_function_show":
 			if w.cmdline != nil {
@@ -1346,8 +1386,17 @@ func (w *Workspace) handleRedraw(updates [][]interface{}) {
 				w.cmdline.functionHide()
 			}
 		case "cmdline_block_show":
+			if w.cmdline != nil {
+				w.cmdline.blockShow(args.([][]hlChunk))
+			}
 		case "cmdline_block_append":
+			if w.cmdline != nil {
+				w.cmdline.blockAppend(args.([][]hlChunk))
+			}
 		case "cmdline_block_hide":
+			if w.cmdline != nil {
+				w.cmdline.blockHide()
+			}
 
 		// // -- deprecated events
 		// case "wildmenu_show":
@@ -1359,14 +1408,17 @@ func (w *Workspace) handleRedraw(updates [][]interface{}) {
 
 		// Message/Dialog Events
 		case "msg_show":
-			w.message.msgShow(args)
+			w.message.msgShow(args.([]msgShow))
 		case "msg_clear":
 			w.message.msgClear()
 		case "msg_showmode":
+			w.message.msgShowmode(args.([][]hlChunk))
 		case "msg_showcmd":
+			w.message.msgShowcmd(args.([][]hlChunk))
 		case "msg_ruler":
+			w.message.msgRuler(args.([][]hlChunk))
 		case "msg_history_show":
-			w.message.msgHistoryShow(args)
+			w.message.msgHistoryShow(args.([]msgShow))
 
 		default:
 
@@ -1376,19 +1428,14 @@ func (w *Workspace) handleRedraw(updates [][]interface{}) {
 }
 
 func (w *Workspace) flush() {
-	for {
-		if len(w.viewportQue) == 0 {
-			break
-		}
-		select {
-		case viewport := <-w.viewportQue:
-			win, diff, ok := w.handleViewport(viewport)
-			if ok {
-				w.smoothScroll(win, diff)
-			}
-		default:
+	w.screen.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win != nil {
+			w.handleScroll(win)
 		}
-	}
+
+		return true
+	})
 	w.screen.update()
 	w.cursor.update()
 	w.drawOtherUI()
@@ -1427,6 +1474,31 @@ func (w *Workspace) drawOtherUI() {
 	}
 }
 
+func (w *Workspace) setMouse(enabled bool) {
+	w.mouseEnabled = enabled
+	if enabled {
+		w.screen.clearSelection()
+	}
+}
+
+// setWidthOptions sets the 'ambiwidth' and 'emoji' options which change the
+// width of the characters
+func (w *Workspace) setWidthOptions(opts grid.WidthOptions) {
+	if w.widthOptions == opts {
+		return
+	}
+	w.widthOptions = opts
+	w.screen.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win == nil {
+			return true
+		}
+		win.queueRedrawAll()
+
+		return true
+	})
+}
+
 func (w *Workspace) disableImeInNormal() {
 	if !editor.config.Editor.DisableImeInNormal {
 		return
@@ -1444,10 +1516,10 @@ func (w *Workspace) disableImeInNormal() {
 	}
 }
 
-func (w *Workspace) setColorsSet(args []interface{}) {
-	fg := util.ReflectToInt(args[0])
-	bg := util.ReflectToInt(args[1])
-	sp := util.ReflectToInt(args[2])
+func (w *Workspace) setColorsSet(colors defaultColorsSet) {
+	fg := colors.fg
+	bg := colors.bg
+	sp := colors.sp
 
 	if fg != -1 {
 		w.foreground.R = calcColor(fg).R
@@ -1491,13 +1563,6 @@ func (w *Workspace) setColorsSet(args []interface{}) {
 
 	editor.colors.fg = w.foreground.copy()
 	editor.colors.bg = w.background.copy()
-	// Reset hlAttrDef map 0 index:
-	if w.screen.hlAttrDef != nil {
-		w.screen.hlAttrDef[0] = &Highlight{
-			foreground: editor.colors.fg,
-			background: editor.colors.bg,
-		}
-	}
 
 	editor.colors.update()
 	if !(w.colorscheme == "" && fg == -1 && bg == -1 && w.screenbg == "dark") {
@@ -1551,44 +1616,41 @@ func (w *Workspace) updateWorkspaceColor() {
 	}
 }
 
-func (w *Workspace) modeInfoSet(args []interface{}) {
-	for _, arg := range args {
-		w.cursorStyleEnabled = arg.([]interface{})[0].(bool)
-		modePropList := arg.([]interface{})[1].([]interface{})
-		w.modeInfo = make([]map[string]interface{}, len(modePropList))
+func (w *Workspace) modeInfoSet(sets []modeInfoSet) {
+	for _, set := range sets {
+		w.cursorStyleEnabled = set.enabled
+		// Note: the index of modeInfo is given by the `mode_idx` of the `mode_change` event
+		w.modeInfo = set.modes
 		w.cursor.isNeedUpdateModeInfo = true
-		for i, modeProp := range modePropList {
-			// Note: i is the index which given by the `mode_idx` of the `mode_change` event
-			w.modeInfo[i] = modeProp.(map[string]interface{})
-		}
 	}
 }
 
-func (w *Workspace) setOption(update []interface{}) {
-	for n, option := range update {
-		if n == 0 {
-			continue
-		}
-		key := (option.([]interface{}))[0].(string)
-		val := (option.([]interface{}))[1]
-		switch key {
+func (w *Workspace) setOption(options []optionSet) {
+	for _, option := range options {
+		switch option.name {
 		case "arabicshape":
 		case "ambiwidth":
+			opts := w.widthOptions
+			opts.AmbiwidthDouble = option.str == "double"
+			w.setWidthOptions(opts)
 		case "emoji":
+			opts := w.widthOptions
+			opts.Emoji = option.flag
+			w.setWidthOptions(opts)
 		case "guifont":
-			w.guiFont(val.(string))
+			w.guiFont(option.str)
 		case "guifontset":
 		case "guifontwide":
-			w.guiFontWide(val.(string))
+			w.guiFontWide(option.str)
 		case "linespace":
-			w.guiLinespace(val)
+			w.guiLinespace(option.num)
 		case "pumblend":
-			w.setPumblend(val)
+			w.setPumblend(option.num)
 			if w.popup != nil {
 				w.popup.setPumblend(w.pb)
 			}
 		case "showtabline":
-			w.showtabline = util.ReflectToInt(val)
+			w.showtabline = option.num
 		case "termguicolors":
 		// case "ext_cmdline":
 		// case "ext_hlstate":
@@ -1626,26 +1688,13 @@ func (w *Workspace) getPos() {
 	w.viewportMutex.Unlock()
 }
 
-func (w *Workspace) windowViewport(arg []interface{}) {
+func (w *Workspace) windowViewport(vp winViewport) {
 	viewport := [4]int{
-		util.ReflectToInt(arg[2]) + 1,
-		util.ReflectToInt(arg[3]) + 1,
-		util.ReflectToInt(arg[4]) + 1,
-		util.ReflectToInt(arg[5]) + 1,
-	}
-	if w.viewport[0] == viewport[0] && w.oldViewport[0] != w.viewport[0] {
-		if w.mode != "terminal-input" {
-			scrollvp := [5]int{
-				util.ReflectToInt(arg[2]) + 1,
-				util.ReflectToInt(arg[3]) + 1,
-				util.ReflectToInt(arg[4]) + 1,
-				util.ReflectToInt(arg[5]) + 1,
-				util.ReflectToInt(arg[0]),
-			}
-			w.viewportQue <- scrollvp
-		}
+		vp.topline + 1,
+		vp.botline + 1,
+		vp.curline + 1,
+		vp.curcol + 1,
 	}
-
 	if viewport != w.viewport {
 		w.viewportMutex.Lock()
 		w.oldViewport = w.viewport
@@ -1655,75 +1704,88 @@ func (w *Workspace) windowViewport(arg []interface{}) {
 
 }
 
-func (w *Workspace) handleViewport(vp [5]int) (*Window, int, bool) {
-	win, ok := w.screen.getWindow(vp[4])
+// windowScroll records the scroll of the window reported by win_viewport.
+// scroll_delta is used if neovim sends it, since the difference of topline
+// is not the number of the scrolled rows if there are folds.
+func (w *Workspace) windowScroll(vp winViewport) {
+	win, ok := w.screen.getWindow(vp.grid)
 	if !ok {
-		return nil, 0, false
+		return
 	}
-	if win.isMsgGrid {
-		return nil, 0, false
+	topline := vp.topline + 1
+	delta := 0
+	if win.topline != 0 {
+		delta = topline - win.topline
 	}
-	if vp[4] == 1 { // if global grid
-		return nil, 0, false
+	if vp.hasScrollDelta {
+		delta = vp.scrollDelta
 	}
+	win.topline = topline
+	win.scrollDelta += delta
+}
 
-	w.viewportMutex.Lock()
-	w.scrollViewport[1] = w.scrollViewport[0]
-	w.scrollViewport[0] = vp
-	w.viewportMutex.Unlock()
-	viewport := w.scrollViewport[0]
-	oldViewport := w.scrollViewport[1]
+// handleScroll starts the smooth scroll of the window if it was scrolled
+// since the last flush. The windows are scrolled independently, so that the
+// windows scrolled together such as scrollbind splits slide at the same time.
+func (w *Workspace) handleScroll(win *Window) {
+	delta, rows := win.scrollDelta, win.scrollRows
+	win.scrollDelta, win.scrollRows = 0, 0
 
-	diff := viewport[0] - oldViewport[0]
-	if diff == 0 {
-		diff = viewport[1] - oldViewport[1]
-	}
-	isGridGoto := viewport[4] != oldViewport[4]
-	if int(math.Abs(float64(diff))) >= win.rows/2 {
-		wrappedLines1 := win.rows - (viewport[1] - viewport[0] - 1)
-		wrappedLines2 := win.rows - (oldViewport[1] - oldViewport[0] - 1)
-		if diff < 0 {
-			diff -= wrappedLines1
-		} else if diff > 0 {
-			diff += wrappedLines2
+	if delta == 0 {
+		// The rows were scrolled by the change of the text
+		if rows != 0 && win.scrollAnimation == nil {
+			win.scrollback = nil
 		}
+		return
 	}
 
-	// smooth scroll
-	if !editor.config.Editor.SmoothScroll {
-		return nil, 0, false
+	// If neovim redraws the whole window instead of scrolling the grid,
+	// e.g. for long jumps, there are no contents to slide
+	if rows == 0 || !w.isSmoothScrollable(win) {
+		win.stopSmoothScroll()
+		return
 	}
 
-	if w.maxLine < w.rows {
-		return nil, 0, false
-	}
+	w.smoothScroll(win, rows)
+}
 
-	// suppress to getting snapshot
-	if editor.isKeyAutoRepeating {
-		return nil, 0, false
+func (w *Workspace) isSmoothScrollable(win *Window) bool {
+	if !editor.config.Editor.SmoothScroll {
+		return false
 	}
-
-	// get snapshot
-	if diff != 0 {
-		win.snapshots[1] = win.snapshots[0]
-		win.snapshots[0] = win.Grab(win.Rect())
-		win.scrollCols = int(math.Abs(float64(diff)))
+	if win.grid == 1 || win.isMsgGrid || w.mode == "terminal-input" {
+		return false
 	}
 
 	// Compatibility of smooth scrolling with touchpad and smooth scrolling with scroll commands
 	if win.isWheelScrolling {
-		return nil, 0, false
+		return false
 	}
 
-	if isGridGoto {
-		return win, diff, false
-	}
-
-	return win, diff, true
+	return !editor.isKeyAutoRepeating
 }
 
-func (w *Workspace) smoothScroll(win *Window, diff int) {
-	// process smooth scroll
+// smoothScroll slides the contents of the window by the scrolled rows.
+// The grid already has the contents after the scroll, so they are drawn
+// offset by scrollPixels2 which decreases to 0, and the rows scrolled out of
+// the grid are drawn from the scrollback.
+func (w *Workspace) smoothScroll(win *Window, rows int) {
+	font := win.getFont()
+
+	// Continue from the current offset if the window is still sliding
+	offset := float64(win.scrollPixels2 + rows*font.lineHeight)
+	limit := float64(win.rows * font.lineHeight)
+	if offset > limit {
+		offset = limit
+	} else if offset < -limit {
+		offset = -limit
+	}
+	if win.scrollAnimation != nil {
+		a := win.scrollAnimation
+		win.scrollAnimation = nil
+		a.Stop()
+	}
+
 	a := core.NewQPropertyAnimation2(win, core.NewQByteArray2("scrollDiff", len("scrollDiff")), win)
 	a.ConnectValueChanged(func(value *core.QVariant) {
 		ok := false
@@ -1731,31 +1793,21 @@ func (w *Workspace) smoothScroll(win *Window, diff int) {
 		if !ok {
 			return
 		}
-		font := win.getFont()
-		win.scrollPixels2 = int(float64(diff) * v * float64(font.lineHeight))
-		win.Update2(
-			0,
-			0,
-			int(float64(win.cols)*font.truewidth),
-			win.cols*font.lineHeight,
-		)
-		if win.scrollPixels2 == 0 {
-			win.doErase = true
-			win.Update2(
-				0,
-				0,
-				int(float64(win.cols)*font.truewidth),
-				win.cols*font.lineHeight,
-			)
-			win.doErase = false
-		}
+		win.scrollPixels2 = int(offset * v)
+		win.Update()
+	})
+	a.ConnectFinished(func() {
+		win.scrollAnimation = nil
+		win.scrollPixels2 = 0
+		win.scrollback = nil
+		win.Update()
 	})
 	a.SetDuration(190)
 	a.SetStartValue(core.NewQVariant10(1))
 	a.SetEndValue(core.NewQVariant10(0))
-	// a.SetEasingCurve(core.NewQEasingCurve(core.QEasingCurve__OutQuart))
 	a.SetEasingCurve(core.NewQEasingCurve(core.QEasingCurve__OutExpo))
-	// a.SetEasingCurve(core.NewQEasingCurve(core.QEasingCurve__OutCirc))
+	win.scrollAnimation = a
+	win.scrollPixels2 = int(offset)
 	a.Start(core.QAbstractAnimation__DeletionPolicy(core.QAbstractAnimation__DeleteWhenStopped))
 }
 
@@ -1792,7 +1844,13 @@ func (w *Workspace) updateMinimap() {
 }
 
 func (w *Workspace) handleRPCGui(updates []interface{}) {
-	event := updates[0].(string)
+	e, err := decodeGuiEvent(updates)
+	if err != nil {
+		editor.putLog("skip malformed Gui event:", err)
+		return
+	}
+	event := e.name
+	args := e.args
 	switch event {
 	case "gonvim_enter":
 		editor.putLog("vim enter")
@@ -1800,26 +1858,33 @@ func (w *Workspace) handleRPCGui(updates []interface{}) {
 	case "gonvim_uienter":
 		editor.putLog("ui enter")
 	case "gonvim_resize":
-		width, height := editor.setWindowSize(updates[1].(string))
+		width, height := editor.setWindowSize(args.(string))
 		editor.window.Resize2(width, height)
 	case "gonvim_maximize":
 		// editor.window.WindowMaximize()
 	case "Font":
-		w.guiFont(updates[1].(string))
+		w.guiFont(args.(string))
 	case "Linespace":
-		w.guiLinespace(updates[1])
+		w.guiLinespace(args.(int))
+	case "gonvim_ligatures":
+		w.guiLigatures(args.(bool))
+	case "gonvim_font_features":
+		w.guiFontFeatures(args.([]string))
+	case "gonvim_font_style":
+		style := args.(fontStyleSet)
+		w.guiFontStyle(style.style, style.guifont)
 	case "finder_pattern":
-		w.finder.showPattern(updates[1:])
+		w.finder.showPattern(args.(finderPattern))
 	case "finder_pattern_pos":
-		w.finder.cursorPos(updates[1:])
+		w.finder.cursorPos(args.(int))
 	case "finder_show_result":
-		w.finder.showResult(updates[1:])
+		w.finder.showResult(args.(finderResult))
 	case "finder_show":
 		w.finder.show()
 	case "finder_hide":
 		w.finder.hide()
 	case "finder_select":
-		w.finder.selectResult(updates[1:])
+		w.finder.selectResult(args.(int))
 	// case "signature_show":
 	// 	w.signature.showItem(updates[1:])
 	// case "signature_pos":
@@ -1848,11 +1913,11 @@ func (w *Workspace) handleRPCGui(updates []interface{}) {
 	case "filer_resize":
 		editor.side.items[w.getNum()].resizeContent()
 	case "filer_item_add":
-		editor.side.items[w.getNum()].addItem(updates[1:])
+		editor.side.items[w.getNum()].addItem(args.(filerItem))
 	case "filer_item_select":
-		editor.side.items[w.getNum()].selectItem(updates[1:])
+		editor.side.items[w.getNum()].selectItem(args.(int))
 	case "gonvim_grid_font":
-		w.screen.gridFont(updates[1])
+		w.screen.gridFont(args.(string))
 	case "gonvim_minimap_update":
 		if w.minimap != nil {
 			if w.minimap.visible {
@@ -1873,13 +1938,6 @@ func (w *Workspace) handleRPCGui(updates []interface{}) {
 			w.minimap.setColorscheme()
 		}
 
-		win, ok := w.screen.getWindow(w.cursor.gridid)
-		if !ok {
-			return
-		}
-		win.snapshots[0] = nil
-		win.snapshots[1] = nil
-
 	case "gonvim_copy_clipboard":
 		go editor.copyClipBoard()
 	case "gonvim_workspace_new":
@@ -1889,29 +1947,36 @@ func (w *Workspace) handleRPCGui(updates []interface{}) {
 	case "gonvim_workspace_previous":
 		editor.workspacePrevious()
 	case "gonvim_workspace_switch":
-		editor.workspaceSwitch(util.ReflectToInt(updates[1]))
+		editor.workspaceSwitch(args.(int))
+	case "gonvim_workspace_close":
+		w.guiWorkspaceClose(args.(string))
+	case "gonvim_workspace_rename":
+		editor.workspaceRename(w, args.(string))
+	case "gonvim_workspace_move":
+		editor.workspaceMove(w, args.(int))
 	case "gonvim_workspace_cwd":
-		cwdinfo := updates[1].(map[string]interface{})
-		w.handleChangeCwd(cwdinfo)
+		w.handleChangeCwd(args.(workspaceCwd))
 	case "gonvim_workspace_filepath":
 		if w.minimap != nil {
 			w.minimap.mu.Lock()
-			w.filepath = updates[1].(string)
+			w.filepath = args.(string)
 			w.minimap.mu.Unlock()
 		}
 	case "gonvim_optionset":
-		w.optionSet(updates)
+		w.optionSet(args.(string))
 	case "gonvim_termenter":
 		w.mode = "terminal-input"
 	case "gonvim_termleave":
 		w.mode = "normal"
 	case "gonvim_bufenter":
-		w.maxLine = util.ReflectToInt(updates[1])
-		w.setBuffname(updates[2], updates[3])
+		enter := args.(bufEnter)
+		w.maxLine = enter.maxLine
+		w.setBuffname(enter.win, enter.name)
 		w.setBuffTS()
 	case "gonvim_winenter_filetype":
-		w.setFileType(updates)
-		w.setBuffname(updates[2], updates[3])
+		enter := args.(winEnterFiletype)
+		w.setFileType(enter.filetype, enter.win)
+		w.setBuffname(enter.win, enter.name)
 		w.setBuffTS()
 	case "gonvim_markdown_update":
 		if editor.config.Markdown.Disable {
@@ -1930,16 +1995,7 @@ func (w *Workspace) handleRPCGui(updates []interface{}) {
 		}
 		go w.markdown.newBuffer()
 	case "gonvim_textchanged":
-		if editor.config.Editor.SmoothScroll {
-			ws := editor.workspaces[editor.active]
-			win, ok := ws.screen.getWindow(ws.cursor.gridid)
-			if !ok {
-				return
-			}
-			win.snapshots[1] = win.snapshots[0]
-			win.snapshots[0] = win.Grab(win.Rect())
-		}
-		w.maxLine = util.ReflectToInt(updates[1])
+		w.maxLine = args.(int)
 	case "gonvim_markdown_toggle":
 		if editor.config.Markdown.Disable {
 			return
@@ -1992,12 +2048,21 @@ func (w *Workspace) guiFont(args string) {
 		return
 	}
 
+	// The first valid font is the primary font,
+	// and the following ones are the fallback chain for the missing glyphs
+	var fallbacks []string
+	isFound := false
 	for _, gfn := range strings.Split(args, ",") {
-		fontFamily, fontHeight, fontWeight, fontStretch = getFontFamilyAndHeightAndWeightAndStretch(gfn)
-		ok := checkValidFont(fontFamily)
-		if ok {
-			break
+		family, height, weight, stretch := getFontFamilyAndHeightAndWeightAndStretch(strings.TrimSpace(gfn))
+		ok := checkValidFont(family)
+		if isFound {
+			if ok && family != fontFamily {
+				fallbacks = append(fallbacks, family)
+			}
+			continue
 		}
+		fontFamily, fontHeight, fontWeight, fontStretch = family, height, weight, stretch
+		isFound = ok
 	}
 
 	if fontHeight == 0 {
@@ -2005,6 +2070,7 @@ func (w *Workspace) guiFont(args string) {
 	}
 
 	w.font.change(fontFamily, fontHeight, fontWeight, fontStretch)
+	w.font.setFallbacks(fallbacks)
 	w.screen.font = w.font
 
 	font := w.font
@@ -2043,6 +2109,89 @@ func (w *Workspace) guiFont(args string) {
 	}
 }
 
+// guiLigatures turns the ligatures of the workspace on or off
+func (w *Workspace) guiLigatures(enabled bool) {
+	w.ligatures = enabled
+	w.redrawAllText()
+}
+
+// guiFontFeatures sets the OpenType font features such as "ss01" and "-calt"
+// of the fonts of the workspace, including the fonts of the windows set by
+// GonvimGridFont
+func (w *Workspace) guiFontFeatures(features []string) {
+	w.font.setFeatures(features)
+	if w.fontwide != nil {
+		w.fontwide.setFeatures(features)
+	}
+	w.screen.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win != nil && win.font != nil {
+			win.font.setFeatures(features)
+		}
+
+		return true
+	})
+	w.redrawAllText()
+	w.cursor.update()
+}
+
+// redrawAllText purges the text caches and redraws the shown windows
+func (w *Workspace) redrawAllText() {
+	w.screen.purgeTextCacheForWins()
+	w.screen.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win != nil && win.isShown() {
+			win.queueRedrawAll()
+		}
+
+		return true
+	})
+}
+
+// guiFontStyle sets the family of the bold, italic or bold-italic face.
+// args is in the form of guifont, the first valid family is used and the
+// size follows the primary font. The face is derived from the primary font
+// again if args is empty.
+func (w *Workspace) guiFontStyle(name string, args string) {
+	var style fontStyle
+	switch name {
+	case "bold":
+		style = styleBold
+	case "italic":
+		style = styleItalic
+	case "bolditalic":
+		style = styleBoldItalic
+	default:
+		return
+	}
+
+	family := ""
+	for _, gfn := range strings.Split(args, ",") {
+		if strings.TrimSpace(gfn) == "" {
+			continue
+		}
+		fontFamily, _, _, _ := getFontFamilyAndHeightAndWeightAndStretch(strings.TrimSpace(gfn))
+		if checkValidFont(fontFamily) {
+			family = fontFamily
+			break
+		}
+	}
+	if family == "" && strings.TrimSpace(args) != "" {
+		editor.putLog("no valid font family for the style:", args)
+		return
+	}
+
+	w.font.setStyleFamily(style, family)
+	w.screen.windows.Range(func(_, winITF interface{}) bool {
+		win := winITF.(*Window)
+		if win != nil && win.isShown() {
+			win.queueRedrawAll()
+		}
+
+		return true
+	})
+}
+
 func (w *Workspace) guiFontWide(args string) {
 	if args == "" {
 		return
@@ -2055,6 +2204,7 @@ func (w *Workspace) guiFontWide(args string) {
 			editor.config.Editor.Linespace,
 		)
 		w.fontwide.ws = w
+		w.fontwide.setFeatures(w.font.features)
 		w.cursor.fontwide = w.fontwide
 	}
 
@@ -2156,23 +2306,7 @@ func checkValidFont(family string) bool {
 	return strings.EqualFold(fi.Family(), f.Family())
 }
 
-func (w *Workspace) guiLinespace(args interface{}) {
-	// fontArg := args[0].([]interface{})
-	var lineSpace int
-	var err error
-	switch arg := args.(type) {
-	case string:
-		lineSpace, err = strconv.Atoi(arg)
-		if err != nil {
-			return
-		}
-	case int32: // can't combine these in a type switch without compile error
-		lineSpace = int(arg)
-	case int64:
-		lineSpace = int(arg)
-	default:
-		return
-	}
+func (w *Workspace) guiLinespace(lineSpace int) {
 	if lineSpace < 0 {
 		return
 	}
@@ -2180,29 +2314,11 @@ func (w *Workspace) guiLinespace(args interface{}) {
 	w.updateSize()
 }
 
-func (w *Workspace) setPumblend(arg interface{}) {
-	var pumblend int
-	var err error
-	switch val := arg.(type) {
-	case string:
-		pumblend, err = strconv.Atoi(val)
-		if err != nil {
-			return
-		}
-	case int32: // can't combine these in a type switch without compile error
-		pumblend = int(val)
-	case int64:
-		pumblend = int(val)
-	default:
-		return
-	}
-
+func (w *Workspace) setPumblend(pumblend int) {
 	w.pb = pumblend
 }
 
-func (w *Workspace) setBuffname(idITF, nameITF interface{}) {
-	id := (nvim.Window)(util.ReflectToInt(idITF))
-
+func (w *Workspace) setBuffname(id nvim.Window, name string) {
 	w.screen.windows.Range(func(_, winITF interface{}) bool {
 		win := winITF.(*Window)
 
@@ -2219,14 +2335,11 @@ func (w *Workspace) setBuffname(idITF, nameITF interface{}) {
 			return true
 		}
 
-		name := nameITF.(string)
 		bufChan := make(chan nvim.Buffer, 10)
 		var buf nvim.Buffer
 		strChan := make(chan string, 10)
 
-		win.updateMutex.RLock()
-		id := win.id
-		win.updateMutex.RUnlock()
+		id := win.getID()
 		// set buffer name
 		go func() {
 			resultBuffer, _ := w.nvim.WindowBuffer(id)
@@ -2275,9 +2388,7 @@ func (w *Workspace) setBuffTS() {
 			return true
 		}
 
-		win.updateMutex.RLock()
-		id := win.id
-		win.updateMutex.RUnlock()
+		id := win.getID()
 		// set buffer name
 		go func() {
 			resultBuffer, _ := w.nvim.WindowBuffer(id)
@@ -2296,8 +2407,7 @@ func (w *Workspace) setBuffTS() {
 
 // optionSet is
 // This function gets the value of an option that cannot be caught by the set_option event.
-func (w *Workspace) optionSet(updates []interface{}) {
-	optionName := updates[1]
+func (w *Workspace) optionSet(optionName string) {
 	// new, err := strconv.Atoi(updates[2].(string))
 	// if err != nil {
 	// 	return
@@ -2327,9 +2437,7 @@ func (w *Workspace) getPumHeight() {
 	w.ph = ph
 }
 
-func (w *Workspace) setFileType(args []interface{}) {
-	ft := args[1].(string)
-	wid := util.ReflectToInt(args[2])
+func (w *Workspace) setFileType(ft string, wid nvim.Window) {
 
 	for _, v := range editor.config.Editor.IndentGuideIgnoreFtList {
 		if v == ft {
@@ -2349,7 +2457,7 @@ func (w *Workspace) setFileType(args []interface{}) {
 		if win.isMsgGrid {
 			return true
 		}
-		if int(win.id) != wid {
+		if win.id != wid {
 			return true
 		}
 
@@ -2402,6 +2510,7 @@ func (w *Workspace) InputMethodQuery(query core.Qt__InputMethodQuery) *core.QVar
 			if w.palette.widget.IsVisible() {
 				w.cursor.x = x
 				w.cursor.y = w.palette.patternPadding + w.cursor.shift
+				w.cursor.stopAnimation()
 				w.cursor.widget.Move2(w.cursor.x, w.cursor.y)
 			}
 		}
@@ -2439,6 +2548,7 @@ func (w *Workspace) getPointInWidget(col, row, grid int) (int, int, int, bool) {
 // WorkspaceSide is
 type WorkspaceSide struct {
 	widget     *widgets.QWidget
+	layout     *widgets.QLayout
 	scrollarea *widgets.QScrollArea
 	header     *widgets.QLabel
 	items      []*WorkspaceSideItem
@@ -2468,23 +2578,93 @@ func newWorkspaceSide() *WorkspaceSide {
 
 	side := &WorkspaceSide{
 		widget: widget,
+		layout: layout,
 		header: header,
 	}
 
 	layout.AddWidget(header)
 	side.header.Show()
 
-	items := []*WorkspaceSideItem{}
-	side.items = items
-	for i := 0; i < WORKSPACELEN; i++ {
+	side.items = []*WorkspaceSideItem{}
+	side.ensureItems(len(editor.workspaces))
+
+	return side
+}
+
+// ensureItems adds the items until the sidebar has n items
+func (side *WorkspaceSide) ensureItems(n int) {
+	for len(side.items) < n {
 		item := newWorkspaceSideItem()
+		item.side = side
+		if side.scrollarea != nil {
+			width := side.scrollarea.Width()
+			item.label.SetMaximumWidth(width)
+			item.label.SetMinimumWidth(width)
+			item.content.SetMinimumWidth(width)
+		}
+		side.layout.AddWidget(item.widget)
+		item.hide()
 		side.items = append(side.items, item)
-		side.items[len(side.items)-1].side = side
-		layout.AddWidget(side.items[len(side.items)-1].widget)
-		side.items[len(side.items)-1].hide()
 	}
+}
 
-	return side
+// rebind makes the i-th item take over the state of the order[i]-th item
+// after the workspaces are reordered as order, and redraws the file
+// explorers of the opened items
+func (side *WorkspaceSide) rebind(order []int) {
+	isContentHide := make([]bool, len(side.items))
+	for j, item := range side.items {
+		isContentHide[j] = item.isContentHide
+	}
+	for i, item := range side.items {
+		item.clear()
+		item.cwdpath = ""
+		item.text = ""
+		if i >= len(order) || order[i] >= len(side.items) {
+			item.hide()
+			item.isContentHide = true
+			continue
+		}
+		item.isContentHide = isContentHide[order[i]]
+		if item.hidden {
+			continue
+		}
+		if item.isContentHide {
+			item.closeContent()
+		} else {
+			item.openContent()
+			ws := editor.workspaces[i]
+			go ws.nvim.Call("rpcnotify", nil, 0, "GonvimFiler", "redraw")
+		}
+	}
+}
+
+// indexOf returns the index of the item
+func (side *WorkspaceSide) indexOf(item *WorkspaceSideItem) int {
+	for i, it := range side.items {
+		if it == item {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// indexAt returns the index of the workspace whose item is at y in the
+// sidebar. The last workspace is returned if y is below the items.
+func (side *WorkspaceSide) indexAt(y int) int {
+	n := len(editor.workspaces)
+	if n > len(side.items) {
+		n = len(side.items)
+	}
+	for i := 0; i < n; i++ {
+		rect := side.items[i].widget.Geometry()
+		if y < rect.Y()+rect.Height() {
+			return i
+		}
+	}
+
+	return n - 1
 }
 
 func (side *WorkspaceSide) newScrollArea() {
@@ -2546,7 +2726,7 @@ func (side *WorkspaceSide) show() {
 	side.scrollarea.Show()
 	side.isShown = true
 
-	for i := 0; i < WORKSPACELEN; i++ {
+	for i := 0; i < len(side.items) && i < len(editor.workspaces); i++ {
 		if side.items[i] == nil {
 			continue
 		}
@@ -2583,6 +2763,31 @@ func (w *Workspace) getNum() int {
 	return 0
 }
 
+// sideLabel returns the name of the workspace if it is renamed, otherwise the
+// working directory
+func (w *Workspace) sideLabel() string {
+	if w.name != "" {
+		return w.name
+	}
+
+	return w.cwdlabel
+}
+
+// guiWorkspaceClose closes the workspace of the number in arg, or this
+// workspace if arg is empty
+func (w *Workspace) guiWorkspaceClose(arg string) {
+	if arg == "" {
+		editor.workspaceClose(w.getNum() + 1)
+		return
+	}
+	index, err := strconv.Atoi(arg)
+	if err != nil {
+		editor.putLog("invalid workspace number:", arg)
+		return
+	}
+	editor.workspaceClose(index)
+}
+
 // WorkspaceSideItem is
 type WorkspaceSideItem struct {
 	hidden    bool
@@ -2602,6 +2807,9 @@ type WorkspaceSideItem struct {
 
 	content       *widgets.QListWidget
 	isContentHide bool
+
+	pressPos   *core.QPoint
+	isDragging bool
 }
 
 func newWorkspaceSideItem() *WorkspaceSideItem {
@@ -2672,7 +2880,9 @@ func newWorkspaceSideItem() *WorkspaceSideItem {
 		isContentHide: true,
 	}
 
-	sideitem.widget.ConnectMousePressEvent(sideitem.toggleContent)
+	sideitem.widget.ConnectMousePressEvent(sideitem.mousePress)
+	sideitem.widget.ConnectMouseMoveEvent(sideitem.mouseMove)
+	sideitem.widget.ConnectMouseReleaseEvent(sideitem.mouseRelease)
 	content.ConnectItemDoubleClicked(sideitem.fileDoubleClicked)
 
 	return sideitem
@@ -2711,6 +2921,51 @@ func (i *WorkspaceSideItem) fileDoubleClicked(item *widgets.QListWidgetItem) {
 	}
 }
 
+func (i *WorkspaceSideItem) mousePress(event *gui.QMouseEvent) {
+	if event.Button() != core.Qt__LeftButton {
+		return
+	}
+	i.pressPos = event.GlobalPos()
+	i.isDragging = false
+}
+
+// mouseMove starts dragging the item to reorder the workspaces once the
+// mouse moves farther than the drag distance
+func (i *WorkspaceSideItem) mouseMove(event *gui.QMouseEvent) {
+	if i.pressPos == nil || i.isDragging {
+		return
+	}
+	dy := event.GlobalPos().Y() - i.pressPos.Y()
+	distance := widgets.QApplication_StartDragDistance()
+	if dy*dy < distance*distance {
+		return
+	}
+	i.isDragging = true
+	i.widget.SetCursor(gui.NewQCursor2(core.Qt__ClosedHandCursor))
+}
+
+// mouseRelease moves the workspace to the item under the mouse if the item is
+// dragged, otherwise toggles the file explorer
+func (i *WorkspaceSideItem) mouseRelease(event *gui.QMouseEvent) {
+	if i.pressPos == nil {
+		return
+	}
+	i.pressPos = nil
+	if !i.isDragging {
+		i.toggleContent(event)
+		return
+	}
+	i.isDragging = false
+	i.widget.UnsetCursor()
+
+	from := i.side.indexOf(i)
+	to := i.side.indexAt(i.side.widget.MapFromGlobal(event.GlobalPos()).Y())
+	if from < 0 || to < 0 || from >= len(editor.workspaces) {
+		return
+	}
+	editor.moveWorkspace(from, to)
+}
+
 func (i *WorkspaceSideItem) toggleContent(event *gui.QMouseEvent) {
 	if i.hidden {
 		return
@@ -2784,9 +3039,9 @@ func (i *WorkspaceSideItem) clear() {
 	i.content.Clear()
 }
 
-func (i *WorkspaceSideItem) addItem(args []interface{}) {
-	filename := args[0].(string)
-	filetype := args[1].(string)
+func (i *WorkspaceSideItem) addItem(item filerItem) {
+	filename := item.name
+	filetype := item.filetype
 	l := widgets.NewQListWidgetItem(i.content, 1)
 	var svg string
 	if filetype == `/` {
@@ -2812,8 +3067,8 @@ func (i *WorkspaceSideItem) resizeContent() {
 	i.content.SetFixedHeight(itemHeight * rowNum)
 }
 
-func (i *WorkspaceSideItem) selectItem(args []interface{}) {
-	i.content.SetCurrentRow(util.ReflectToInt(args[0]))
+func (i *WorkspaceSideItem) selectItem(row int) {
+	i.content.SetCurrentRow(row)
 }
 
 func (side *WorkspaceSide) setColor() {
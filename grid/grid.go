@@ -0,0 +1,611 @@
+// Package grid is a Qt independent model of the neovim ui grids.
+// It consumes the grid_resize, grid_line, grid_scroll, grid_clear and
+// hl_attr_define redraw events and holds the resulting cell and
+// highlight state, so that the redraw semantics can be used and tested
+// without a display.
+package grid
+
+import (
+	"sort"
+	"strings"
+)
+
+// Cell is a single cell of a grid
+type Cell struct {
+	Text        string
+	HlID        int
+	NormalWidth bool
+
+	// Width is the number of cells the text is allocated by neovim.
+	// It is 2 if the cell is followed by an empty cell, and 0 for the
+	// empty cell itself.
+	Width int
+}
+
+// Grid is the content of a single ui grid
+type Grid struct {
+	ID    int
+	Cols  int
+	Rows  int
+	Cells [][]*Cell
+
+	// IsNormalWidth reports whether the text of a cell occupies exactly one
+	// cell. It defaults to DefaultIsNormalWidth and can be replaced by the
+	// renderer to take the font metrics into account.
+	IsNormalWidth func(text string) bool
+
+	// damage holds the dirty column span of each row which has been
+	// updated since the last call of TakeDamage
+	damage map[int]Span
+}
+
+// Span is a range of columns in a row, End is exclusive
+type Span struct {
+	Row   int
+	Start int
+	End   int
+}
+
+// Model holds all grids and highlight attributes of a neovim ui.
+// It is not safe for concurrent use.
+type Model struct {
+	grids   map[int]*Grid
+	hlAttrs map[int]*Highlight
+}
+
+// NewModel returns an empty model
+func NewModel() *Model {
+	return &Model{
+		grids:   make(map[int]*Grid),
+		hlAttrs: make(map[int]*Highlight),
+	}
+}
+
+// Grid returns the grid with the given id
+func (m *Model) Grid(id int) (*Grid, bool) {
+	g, ok := m.grids[id]
+	return g, ok
+}
+
+// Grids returns the ids of all known grids
+func (m *Model) Grids() []int {
+	ids := make([]int, 0, len(m.grids))
+	for id := range m.grids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Resize handles grid_resize. If the grid does not exist yet, it is created,
+// otherwise the overlapping part of the old content is kept.
+func (m *Model) Resize(id, cols, rows int) *Grid {
+	if cols < 0 {
+		cols = 0
+	}
+	if rows < 0 {
+		rows = 0
+	}
+
+	g, ok := m.grids[id]
+	if !ok {
+		g = &Grid{
+			ID:            id,
+			IsNormalWidth: DefaultIsNormalWidth,
+		}
+		m.grids[id] = g
+	}
+
+	cells := make([][]*Cell, rows)
+	for i := 0; i < rows; i++ {
+		cells[i] = make([]*Cell, cols)
+		if i >= len(g.Cells) {
+			continue
+		}
+		copy(cells[i], g.Cells[i])
+	}
+
+	g.Cells = cells
+	g.Cols = cols
+	g.Rows = rows
+	g.DamageAll()
+
+	return g
+}
+
+// Clear handles grid_clear
+func (m *Model) Clear(id int) (*Grid, bool) {
+	g, ok := m.grids[id]
+	if !ok {
+		return nil, false
+	}
+	g.Clear()
+
+	return g, true
+}
+
+// Destroy handles grid_destroy
+func (m *Model) Destroy(id int) {
+	delete(m.grids, id)
+}
+
+// Line handles a single grid_line event. It returns the column next to the
+// last updated cell, and false if the grid or the row does not exist.
+func (m *Model) Line(id, row, colStart int, cells []interface{}) (int, bool) {
+	g, ok := m.grids[id]
+	if !ok {
+		return colStart, false
+	}
+
+	return g.Line(row, colStart, cells)
+}
+
+// SetLine handles a single grid_line event decoded by DecodeLine
+func (m *Model) SetLine(id, row, colStart int, cells []LineCell) (int, bool) {
+	g, ok := m.grids[id]
+	if !ok {
+		return colStart, false
+	}
+
+	return g.SetLine(row, colStart, cells)
+}
+
+// Scroll handles grid_scroll. top, bot, left and right are passed as they are
+// sent by neovim, so bot and right are exclusive.
+func (m *Model) Scroll(id, top, bot, left, right, rows int) bool {
+	g, ok := m.grids[id]
+	if !ok {
+		return false
+	}
+	g.Scroll(top, bot, left, right, rows)
+
+	return true
+}
+
+// Apply dispatches a single redraw event batch (the event name followed by
+// its argument tuples) to the model. It returns the ids of the grids that
+// have been changed. Events not related to the model are ignored.
+func (m *Model) Apply(event []interface{}) []int {
+	if len(event) == 0 {
+		return nil
+	}
+	name, ok := event[0].(string)
+	if !ok {
+		return nil
+	}
+
+	var changed []int
+	for _, e := range event[1:] {
+		arg, ok := e.([]interface{})
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "grid_resize":
+			if len(arg) < 3 {
+				continue
+			}
+			g := m.Resize(toInt(arg[0]), toInt(arg[1]), toInt(arg[2]))
+			changed = append(changed, g.ID)
+		case "grid_clear":
+			if len(arg) < 1 {
+				continue
+			}
+			if g, ok := m.Clear(toInt(arg[0])); ok {
+				changed = append(changed, g.ID)
+			}
+		case "grid_destroy":
+			if len(arg) < 1 {
+				continue
+			}
+			m.Destroy(toInt(arg[0]))
+		case "grid_line":
+			if len(arg) < 4 {
+				continue
+			}
+			cells, ok := arg[3].([]interface{})
+			if !ok {
+				continue
+			}
+			id := toInt(arg[0])
+			if _, ok := m.Line(id, toInt(arg[1]), toInt(arg[2]), cells); ok {
+				changed = append(changed, id)
+			}
+		case "grid_scroll":
+			if len(arg) < 6 {
+				continue
+			}
+			id := toInt(arg[0])
+			if m.Scroll(id, toInt(arg[1]), toInt(arg[2]), toInt(arg[3]), toInt(arg[4]), toInt(arg[5])) {
+				changed = append(changed, id)
+			}
+		case "hl_attr_define":
+			m.DefineHighlight(arg)
+		default:
+			return nil
+		}
+	}
+
+	return changed
+}
+
+// Cell returns the cell at the given position, or nil if the cell has not
+// been drawn yet or the position is out of the grid.
+func (g *Grid) Cell(row, col int) *Cell {
+	if row < 0 || row >= len(g.Cells) {
+		return nil
+	}
+	if col < 0 || col >= len(g.Cells[row]) {
+		return nil
+	}
+
+	return g.Cells[row][col]
+}
+
+// Clear removes all cells of the grid
+func (g *Grid) Clear() {
+	g.Cells = make([][]*Cell, g.Rows)
+	for i := 0; i < g.Rows; i++ {
+		g.Cells[i] = make([]*Cell, g.Cols)
+	}
+	g.DamageAll()
+}
+
+// LineCell is a cell of a grid_line event decoded by DecodeLine
+type LineCell struct {
+	Text string
+	// HlID is -1 if the highlight of the previous cell should be used
+	HlID   int
+	Repeat int
+}
+
+// DecodeLine decodes the cells of a grid_line event. It does not depend on
+// the state of the grid, so it can be called on any goroutine.
+func DecodeLine(cells []interface{}) []LineCell {
+	decoded := make([]LineCell, 0, len(cells))
+	hl := -1
+	for _, c := range cells {
+		cell, ok := c.([]interface{})
+		if !ok || len(cell) == 0 {
+			continue
+		}
+		text, _ := cell[0].(string)
+
+		// If `hl_id` is not present the most recently seen `hl_id` in
+		// the same call should be used (it is always sent for the first
+		// cell in the event).
+		if len(cell) >= 2 {
+			hl = toInt(cell[1])
+		}
+
+		// If `repeat` is present, the cell should be
+		// repeated `repeat` times (including the first time), otherwise just
+		// once.
+		repeat := 1
+		if len(cell) >= 3 {
+			repeat = toInt(cell[2])
+			if repeat == 0 {
+				repeat = 1
+			}
+		}
+
+		decoded = append(decoded, LineCell{
+			Text:   text,
+			HlID:   hl,
+			Repeat: repeat,
+		})
+	}
+
+	return decoded
+}
+
+// Line updates a row with the cells of a grid_line event.
+// It returns the column next to the last updated cell.
+func (g *Grid) Line(row, colStart int, cells []interface{}) (int, bool) {
+	return g.SetLine(row, colStart, DecodeLine(cells))
+}
+
+// SetLine updates a row with the cells decoded by DecodeLine.
+// It returns the column next to the last updated cell.
+func (g *Grid) SetLine(row, colStart int, cells []LineCell) (int, bool) {
+	if colStart < 0 || row < 0 || row >= len(g.Cells) {
+		return colStart, false
+	}
+
+	line := g.Cells[row]
+	col := colStart
+	for _, c := range cells {
+		if col >= len(line) {
+			break
+		}
+		hl := c.HlID
+		if hl == -1 {
+			hl = 0
+			if col > 0 && line[col-1] != nil {
+				hl = line[col-1].HlID
+			}
+		}
+
+		normalWidth := g.isNormalWidth(c.Text)
+		for r := 0; r < c.Repeat; r++ {
+			if col >= len(line) {
+				break
+			}
+			if line[col] == nil {
+				line[col] = &Cell{}
+			}
+			line[col].Text = c.Text
+			line[col].HlID = hl
+			line[col].NormalWidth = normalWidth
+			col++
+		}
+	}
+	g.updateWidth(row, colStart-1, col)
+	g.Damage(row, colStart, col)
+
+	return col, true
+}
+
+// updateWidth updates the Width of the cells from start to end (exclusive)
+// in row
+func (g *Grid) updateWidth(row, start, end int) {
+	line := g.Cells[row]
+	if start < 0 {
+		start = 0
+	}
+	for x := start; x < end && x < len(line); x++ {
+		c := line[x]
+		if c == nil {
+			continue
+		}
+		switch {
+		case c.Text == "":
+			c.Width = 0
+		case x+1 < len(line) && line[x+1] != nil && line[x+1].Text == "":
+			c.Width = 2
+		default:
+			c.Width = 1
+		}
+	}
+}
+
+// Scroll moves the region of the grid by rows. top, bot, left and right are
+// passed as they are sent by neovim, so bot and right are exclusive.
+// Cells which are scrolled into the region are cleared.
+func (g *Grid) Scroll(top, bot, left, right, rows int) {
+	// An empty region means the whole grid
+	if top == 0 && bot == 0 && left == 0 && right == 0 {
+		bot = g.Rows
+		right = g.Cols
+	}
+	if top < 0 {
+		top = 0
+	}
+	if left < 0 {
+		left = 0
+	}
+	if bot > len(g.Cells) {
+		bot = len(g.Cells)
+	}
+	if right > g.Cols {
+		right = g.Cols
+	}
+	if top >= bot || left >= right || rows == 0 {
+		return
+	}
+
+	cells := g.Cells
+	if rows > 0 {
+		for row := top; row < bot; row++ {
+			src := row + rows
+			for col := left; col < right; col++ {
+				if src < bot {
+					cells[row][col] = cells[src][col]
+				} else {
+					cells[row][col] = nil
+				}
+			}
+		}
+	} else {
+		for row := bot - 1; row >= top; row-- {
+			src := row + rows
+			for col := left; col < right; col++ {
+				if src >= top {
+					cells[row][col] = cells[src][col]
+				} else {
+					cells[row][col] = nil
+				}
+			}
+		}
+	}
+	for row := top; row < bot; row++ {
+		g.Damage(row, left, right)
+	}
+}
+
+// CopySpans copies the cells in the spans of src to g by value, so that src
+// can be updated while g is read. The cell before each span is also copied,
+// since its width depends on the cell following it.
+func (g *Grid) CopySpans(src *Grid, spans []Span) {
+	for _, span := range spans {
+		if span.Row < 0 || span.Row >= len(g.Cells) || span.Row >= len(src.Cells) {
+			continue
+		}
+		dst, line := g.Cells[span.Row], src.Cells[span.Row]
+		start := span.Start - 1
+		if start < 0 {
+			start = 0
+		}
+		for x := start; x < span.End && x < len(dst) && x < len(line); x++ {
+			c := line[x]
+			if c == nil {
+				dst[x] = nil
+				continue
+			}
+			if dst[x] == nil {
+				dst[x] = &Cell{}
+			}
+			*dst[x] = *c
+		}
+		g.Damage(span.Row, start, span.End)
+	}
+}
+
+// Damage marks the columns from start to end (exclusive) of row as dirty.
+// The span is merged with the existing dirty span of the row.
+func (g *Grid) Damage(row, start, end int) {
+	if row < 0 || row >= g.Rows {
+		return
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > g.Cols {
+		end = g.Cols
+	}
+	if start >= end {
+		return
+	}
+	if g.damage == nil {
+		g.damage = make(map[int]Span)
+	}
+
+	span, ok := g.damage[row]
+	if !ok {
+		g.damage[row] = Span{Row: row, Start: start, End: end}
+		return
+	}
+	if start < span.Start {
+		span.Start = start
+	}
+	if end > span.End {
+		span.End = end
+	}
+	g.damage[row] = span
+}
+
+// DamageAll marks the whole grid as dirty
+func (g *Grid) DamageAll() {
+	for row := 0; row < g.Rows; row++ {
+		g.Damage(row, 0, g.Cols)
+	}
+}
+
+// TakeDamage returns the dirty spans ordered by row and resets them
+func (g *Grid) TakeDamage() []Span {
+	if len(g.damage) == 0 {
+		return nil
+	}
+	spans := make([]Span, 0, len(g.damage))
+	for _, span := range g.damage {
+		spans = append(spans, span)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Row < spans[j].Row
+	})
+	g.damage = nil
+
+	return spans
+}
+
+// LenLine returns the number of columns up to the last non blank cell in row
+func (g *Grid) LenLine(row int) int {
+	if row < 0 || row >= len(g.Cells) {
+		return 0
+	}
+	line := g.Cells[row]
+	n := len(line)
+	for ; n > 0; n-- {
+		c := line[n-1]
+		if c != nil && c.Text != " " {
+			break
+		}
+	}
+
+	return n
+}
+
+// Text returns the text of row, the cells which have not been drawn yet are
+// treated as spaces.
+func (g *Grid) Text(row int) string {
+	if row < 0 || row >= len(g.Cells) {
+		return ""
+	}
+	text := ""
+	for _, c := range g.Cells[row] {
+		if c == nil {
+			text += " "
+			continue
+		}
+		text += c.Text
+	}
+
+	return text
+}
+
+// TextRange returns the text from (startRow, startCol) to (endRow, endCol)
+// inclusive, in the order of the grid regardless of the order of the
+// arguments. Trailing spaces of each row are removed and rows are joined
+// with a newline.
+func (g *Grid) TextRange(startRow, startCol, endRow, endCol int) string {
+	if startRow > endRow || (startRow == endRow && startCol > endCol) {
+		startRow, startCol, endRow, endCol = endRow, endCol, startRow, startCol
+	}
+	if startRow < 0 {
+		startRow, startCol = 0, 0
+	}
+	if endRow >= len(g.Cells) {
+		endRow, endCol = len(g.Cells)-1, g.Cols-1
+	}
+
+	lines := []string{}
+	for row := startRow; row <= endRow; row++ {
+		first := 0
+		if row == startRow {
+			first = startCol
+		}
+		last := g.LenLine(row) - 1
+		if row == endRow && endCol < last {
+			last = endCol
+		}
+		line := ""
+		for col := first; col <= last; col++ {
+			c := g.Cell(row, col)
+			if c == nil {
+				line += " "
+				continue
+			}
+			line += c.Text
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (g *Grid) isNormalWidth(text string) bool {
+	if g.IsNormalWidth == nil {
+		return DefaultIsNormalWidth(text)
+	}
+	return g.IsNormalWidth(text)
+}
+
+func toInt(i interface{}) int {
+	switch v := i.(type) {
+	case int64:
+		return int(v)
+	case uint64:
+		return int(v)
+	case int:
+		return v
+	case uint:
+		return int(v)
+	case int32:
+		return int(v)
+	case uint32:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,420 @@
+package grid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func gridText(g *Grid) []string {
+	lines := make([]string, g.Rows)
+	for i := 0; i < g.Rows; i++ {
+		lines[i] = g.Text(i)
+	}
+	return lines
+}
+
+func TestGrid_Line(t *testing.T) {
+	type args struct {
+		col   int
+		row   int
+		cells []interface{}
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantText string
+		wantHl   []int
+		wantEnd  int
+	}{
+		{
+			"repeat",
+			args{
+				col: 0,
+				row: 1,
+				cells: []interface{}{
+					[]interface{}{"~", 7},
+					[]interface{}{" ", 7, 4},
+				},
+			},
+			"~    ",
+			[]int{7, 7, 7, 7, 7},
+			5,
+		},
+		{
+			"start from middle",
+			args{
+				col: 3,
+				row: 1,
+				cells: []interface{}{
+					[]interface{}{"*", 6, 2},
+				},
+			},
+			"~  **",
+			[]int{7, 7, 7, 6, 6},
+			5,
+		},
+		{
+			"most recently seen hl_id",
+			args{
+				col: 1,
+				row: 1,
+				cells: []interface{}{
+					[]interface{}{"@", 6},
+					[]interface{}{"v"},
+					[]interface{}{"i"},
+					[]interface{}{"m"},
+				},
+			},
+			"~@vim",
+			[]int{7, 6, 6, 6, 6},
+			5,
+		},
+		{
+			"repeat and most recently seen hl_id",
+			args{
+				col: 0,
+				row: 1,
+				cells: []interface{}{
+					[]interface{}{" ", 7, 2},
+					[]interface{}{"J"},
+				},
+			},
+			"  Jim",
+			[]int{7, 7, 7, 6, 6},
+			3,
+		},
+		{
+			"overflow",
+			args{
+				col: 3,
+				row: 1,
+				cells: []interface{}{
+					[]interface{}{"x", 1, 10},
+				},
+			},
+			"  Jxx",
+			[]int{7, 7, 7, 1, 1},
+			5,
+		},
+	}
+
+	m := NewModel()
+	g := m.Resize(6, 5, 2)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			end, ok := m.Line(6, tt.args.row, tt.args.col, tt.args.cells)
+			if !ok {
+				t.Fatalf("Line() returned false")
+			}
+			if end != tt.wantEnd {
+				t.Errorf("Line() = %v, want %v", end, tt.wantEnd)
+			}
+			if got := g.Text(tt.args.row); got != tt.wantText {
+				t.Errorf("text = %q, want %q", got, tt.wantText)
+			}
+			var hls []int
+			for _, c := range g.Cells[tt.args.row] {
+				hls = append(hls, c.HlID)
+			}
+			if !reflect.DeepEqual(hls, tt.wantHl) {
+				t.Errorf("hl = %v, want %v", hls, tt.wantHl)
+			}
+		})
+	}
+
+	if _, ok := m.Line(6, 2, 0, []interface{}{[]interface{}{"a", 1}}); ok {
+		t.Errorf("Line() out of rows should return false")
+	}
+	if _, ok := m.Line(7, 0, 0, []interface{}{[]interface{}{"a", 1}}); ok {
+		t.Errorf("Line() of unknown grid should return false")
+	}
+}
+
+func TestGrid_NormalWidth(t *testing.T) {
+	m := NewModel()
+	g := m.Resize(2, 4, 1)
+	m.Line(2, 0, 0, []interface{}{
+		[]interface{}{"a", 1},
+		[]interface{}{"漢"},
+		[]interface{}{""},
+		[]interface{}{"é"},
+	})
+	want := []bool{true, false, true, true}
+	for i, c := range g.Cells[0] {
+		if c.NormalWidth != want[i] {
+			t.Errorf("col %v: NormalWidth = %v, want %v", i, c.NormalWidth, want[i])
+		}
+	}
+
+	g.IsNormalWidth = func(text string) bool { return text == "a" }
+	m.Line(2, 0, 3, []interface{}{[]interface{}{"é", 1}})
+	if g.Cells[0][3].NormalWidth {
+		t.Errorf("IsNormalWidth of the grid is not used")
+	}
+}
+
+func TestGrid_Scroll(t *testing.T) {
+	lines := []string{"aaaa", "bbbb", "cccc", "dddd"}
+	newGrid := func() (*Model, *Grid) {
+		m := NewModel()
+		g := m.Resize(2, 4, 4)
+		for i, l := range lines {
+			m.Line(2, i, 0, []interface{}{[]interface{}{l[:1], 1, 4}})
+		}
+		return m, g
+	}
+
+	tests := []struct {
+		name                        string
+		top, bot, left, right, rows int
+		want                        []string
+	}{
+		{"up", 0, 4, 0, 4, 1, []string{"bbbb", "cccc", "dddd", "    "}},
+		{"down", 0, 4, 0, 4, -2, []string{"    ", "    ", "aaaa", "bbbb"}},
+		{"region up", 1, 3, 1, 3, 1, []string{"aaaa", "bccb", "c  c", "dddd"}},
+		{"region down", 1, 4, 0, 2, -1, []string{"aaaa", "  bb", "bbcc", "ccdd"}},
+		{"whole grid", 0, 0, 0, 0, 3, []string{"dddd", "    ", "    ", "    "}},
+		{"out of region", 0, 4, 0, 4, 5, []string{"    ", "    ", "    ", "    "}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m, g := newGrid()
+			if !m.Scroll(2, tt.top, tt.bot, tt.left, tt.right, tt.rows) {
+				t.Fatalf("Scroll() returned false")
+			}
+			if got := gridText(g); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scroll() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrid_ResizeAndClear(t *testing.T) {
+	m := NewModel()
+	g := m.Resize(3, 3, 2)
+	m.Line(3, 0, 0, []interface{}{[]interface{}{"a", 1, 3}})
+	m.Line(3, 1, 0, []interface{}{[]interface{}{"b", 1, 3}})
+
+	if m.Resize(3, 2, 3) != g {
+		t.Fatalf("Resize() should keep the grid")
+	}
+	if got, want := gridText(g), []string{"aa", "bb", "  "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Resize() = %q, want %q", got, want)
+	}
+	if got := g.LenLine(0); got != 2 {
+		t.Errorf("LenLine() = %v, want 2", got)
+	}
+	if got := g.LenLine(2); got != 0 {
+		t.Errorf("LenLine() = %v, want 0", got)
+	}
+
+	m.Clear(3)
+	if got, want := gridText(g), []string{"  ", "  ", "  "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Clear() = %q, want %q", got, want)
+	}
+	if g.Cell(0, 0) != nil {
+		t.Errorf("Cell() after Clear() should be nil")
+	}
+
+	m.Destroy(3)
+	if _, ok := m.Grid(3); ok {
+		t.Errorf("Grid() after Destroy() should not exist")
+	}
+}
+
+func TestModel_DefineHighlight(t *testing.T) {
+	m := NewModel()
+	hl := m.DefineHighlight([]interface{}{
+		int64(5),
+		map[string]interface{}{
+			"foreground":  int64(0x112233),
+			"bold":        true,
+			"underline":   true,
+			"underdashed": true,
+			"nocombine":   true,
+			"blend":       int64(20),
+		},
+		map[string]interface{}{},
+		[]interface{}{
+			map[string]interface{}{
+				"kind":    "ui",
+				"ui_name": "Pmenu",
+				"hi_name": "Pmenu",
+				"id":      int64(42),
+			},
+		},
+	})
+
+	want := &Highlight{
+		ID:          42,
+		Kind:        "ui",
+		UIName:      "Pmenu",
+		HiName:      "Pmenu",
+		Foreground:  0x112233,
+		Background:  -1,
+		Special:     -1,
+		Bold:        true,
+		Underline:   true,
+		Underdashed: true,
+		Nocombine:   true,
+		Blend:       20,
+	}
+	if !reflect.DeepEqual(hl, want) {
+		t.Errorf("DefineHighlight() = %+v, want %+v", hl, want)
+	}
+	if got, ok := m.Highlight(5); !ok || got != hl {
+		t.Errorf("Highlight() = %+v, want %+v", got, hl)
+	}
+	if got, ok := m.Highlight(0); !ok || got.Foreground != -1 {
+		t.Errorf("Highlight(0) should be the default highlight")
+	}
+}
+
+func TestModel_Apply(t *testing.T) {
+	m := NewModel()
+	events := [][]interface{}{
+		{"grid_resize", []interface{}{int64(2), int64(3), int64(2)}},
+		{"hl_attr_define", []interface{}{int64(1), map[string]interface{}{"italic": true}, map[string]interface{}{}, []interface{}{}}},
+		{"grid_line",
+			[]interface{}{int64(2), int64(0), int64(0), []interface{}{[]interface{}{"a", int64(1), int64(3)}}},
+			[]interface{}{int64(2), int64(1), int64(0), []interface{}{[]interface{}{"b", int64(1), int64(3)}}},
+		},
+		{"grid_scroll", []interface{}{int64(2), int64(0), int64(2), int64(0), int64(3), int64(1), int64(0)}},
+		{"flush"},
+	}
+	for _, e := range events {
+		m.Apply(e)
+	}
+
+	g, ok := m.Grid(2)
+	if !ok {
+		t.Fatalf("grid_resize did not create the grid")
+	}
+	if got, want := gridText(g), []string{"bbb", "   "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %q, want %q", got, want)
+	}
+	if hl, ok := m.Highlight(1); !ok || !hl.Italic {
+		t.Errorf("hl_attr_define was not applied")
+	}
+	if changed := m.Apply([]interface{}{"grid_clear", []interface{}{int64(2)}}); !reflect.DeepEqual(changed, []int{2}) {
+		t.Errorf("Apply() = %v, want [2]", changed)
+	}
+}
+
+func TestGrid_TextRange(t *testing.T) {
+	m := NewModel()
+	g := m.Resize(2, 6, 3)
+	m.Line(2, 0, 0, []interface{}{[]interface{}{"f", 1}, []interface{}{"o", 1, 2}, []interface{}{" ", 1, 3}})
+	m.Line(2, 1, 0, []interface{}{[]interface{}{"漢", 1}, []interface{}{""}, []interface{}{"b"}, []interface{}{"a"}, []interface{}{"r"}})
+	m.Line(2, 2, 0, []interface{}{[]interface{}{"b", 1}, []interface{}{"a"}, []interface{}{"z"}})
+
+	tests := []struct {
+		name                               string
+		startRow, startCol, endRow, endCol int
+		want                               string
+	}{
+		{"single row", 0, 1, 0, 2, "oo"},
+		{"trailing spaces", 0, 0, 0, 5, "foo"},
+		{"wide char", 1, 0, 1, 3, "漢ba"},
+		{"multi rows", 0, 2, 2, 1, "o\n漢bar\nba"},
+		{"reversed", 2, 1, 0, 2, "o\n漢bar\nba"},
+		{"out of grid", -1, 3, 5, 0, "foo\n漢bar\nbaz"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.TextRange(tt.startRow, tt.startCol, tt.endRow, tt.endCol); got != tt.want {
+				t.Errorf("TextRange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrid_Damage(t *testing.T) {
+	m := NewModel()
+	g := m.Resize(2, 8, 4)
+	if got := len(g.TakeDamage()); got != 4 {
+		t.Errorf("TakeDamage() after Resize() = %v spans, want 4", got)
+	}
+	if got := g.TakeDamage(); got != nil {
+		t.Errorf("TakeDamage() should reset the damage, got %v", got)
+	}
+
+	m.Line(2, 1, 2, []interface{}{[]interface{}{"a", 1, 2}})
+	m.Line(2, 1, 5, []interface{}{[]interface{}{"b", 1}})
+	m.Line(2, 3, 6, []interface{}{[]interface{}{"c", 1, 5}})
+	want := []Span{{Row: 1, Start: 2, End: 6}, {Row: 3, Start: 6, End: 8}}
+	if got := g.TakeDamage(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TakeDamage() after Line() = %v, want %v", got, want)
+	}
+
+	m.Scroll(2, 1, 3, 2, 6, 1)
+	want = []Span{{Row: 1, Start: 2, End: 6}, {Row: 2, Start: 2, End: 6}}
+	if got := g.TakeDamage(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TakeDamage() after Scroll() = %v, want %v", got, want)
+	}
+
+	m.Clear(2)
+	want = []Span{{0, 0, 8}, {1, 0, 8}, {2, 0, 8}, {3, 0, 8}}
+	if got := g.TakeDamage(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TakeDamage() after Clear() = %v, want %v", got, want)
+	}
+}
+
+func TestGrid_CopySpans(t *testing.T) {
+	src := NewModel().Resize(2, 4, 2)
+	src.Line(0, 0, []interface{}{[]interface{}{"a", 1, 4}})
+	src.Line(1, 0, []interface{}{[]interface{}{"b", 1, 4}})
+	dst := NewModel().Resize(2, 4, 2)
+
+	dst.CopySpans(src, []Span{{Row: 0, Start: 2, End: 4}, {Row: 1, Start: 0, End: 4}})
+	if got, want := gridText(dst), []string{" aaa", "bbbb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CopySpans() = %q, want %q", got, want)
+	}
+
+	// The cells are copied by value
+	src.Line(1, 0, []interface{}{[]interface{}{"c", 1}})
+	if got := dst.Cell(1, 0).Text; got != "b" {
+		t.Errorf("the copied cell follows the source: %q", got)
+	}
+
+	src.Clear()
+	dst.CopySpans(src, []Span{{Row: 1, Start: 0, End: 4}, {Row: 5, Start: 0, End: 4}})
+	if dst.Cell(1, 0) != nil {
+		t.Errorf("the cleared cell is not copied")
+	}
+}
+
+func TestDecodeLine(t *testing.T) {
+	cells := []interface{}{
+		[]interface{}{"a"},
+		[]interface{}{"b", int64(3), int64(2)},
+		[]interface{}{"c"},
+		"invalid",
+		[]interface{}{"d", uint64(4), int64(0)},
+	}
+	want := []LineCell{
+		{Text: "a", HlID: -1, Repeat: 1},
+		{Text: "b", HlID: 3, Repeat: 2},
+		{Text: "c", HlID: 3, Repeat: 1},
+		{Text: "d", HlID: 4, Repeat: 1},
+	}
+	if got := DecodeLine(cells); !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeLine() = %v, want %v", got, want)
+	}
+
+	m := NewModel()
+	g := m.Resize(2, 6, 1)
+	m.Line(2, 0, 0, []interface{}{[]interface{}{"x", int64(7), int64(6)}})
+	if _, ok := m.SetLine(2, 0, 1, DecodeLine(cells)); !ok {
+		t.Fatalf("SetLine() returned false")
+	}
+	if got, want := gridText(g), []string{"xabbcd"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SetLine() = %q, want %q", got, want)
+	}
+	if got := g.Cells[0][1].HlID; got != 7 {
+		t.Errorf("HlID of the cell without hl_id = %v, want 7", got)
+	}
+}
@@ -0,0 +1,162 @@
+package grid
+
+import (
+	"unicode"
+)
+
+// Highlight is a highlight attribute defined by hl_attr_define.
+// Colors are 24-bit RGB values, -1 means the color is not set and the
+// default color should be used.
+type Highlight struct {
+	ID            int
+	Kind          string
+	UIName        string
+	HiName        string
+	Foreground    int
+	Background    int
+	Special       int
+	Reverse       bool
+	Italic        bool
+	Bold          bool
+	Underline     bool
+	Undercurl     bool
+	Underdouble   bool
+	Underdotted   bool
+	Underdashed   bool
+	Strikethrough bool
+	Altfont       bool
+	Nocombine     bool
+	Blend         int
+}
+
+// Highlight returns the highlight attribute with the given id.
+// Attribute 0 is always defined and uses the default colors.
+func (m *Model) Highlight(id int) (*Highlight, bool) {
+	if id == 0 {
+		if _, ok := m.hlAttrs[0]; !ok {
+			return NewHighlight(), true
+		}
+	}
+	hl, ok := m.hlAttrs[id]
+	return hl, ok
+}
+
+// NewHighlight returns a highlight attribute which uses the default colors
+func NewHighlight() *Highlight {
+	return &Highlight{
+		Foreground: -1,
+		Background: -1,
+		Special:    -1,
+	}
+}
+
+// DefineHighlight handles a single hl_attr_define tuple
+// [id, rgb_attr, cterm_attr, info] and returns the defined attribute.
+func (m *Model) DefineHighlight(arg []interface{}) *Highlight {
+	if len(arg) == 0 {
+		return nil
+	}
+	hl := ParseHighlight(arg)
+	m.SetHighlight(toInt(arg[0]), hl)
+
+	return hl
+}
+
+// SetHighlight defines the highlight attribute parsed by ParseHighlight
+func (m *Model) SetHighlight(id int, hl *Highlight) {
+	m.hlAttrs[id] = hl
+}
+
+// ParseHighlight parses a hl_attr_define tuple [id, rgb_attr, cterm_attr, info]
+func ParseHighlight(arg []interface{}) *Highlight {
+	highlight := NewHighlight()
+
+	hl := map[string]interface{}{}
+	if len(arg) > 1 {
+		if h, ok := arg[1].(map[string]interface{}); ok {
+			hl = h
+		}
+	}
+	info := map[string]interface{}{}
+	if len(arg) > 3 {
+		if infos, ok := arg[3].([]interface{}); ok && len(infos) > 0 {
+			if i, ok := infos[0].(map[string]interface{}); ok {
+				info = i
+			}
+		}
+	}
+
+	if kind, ok := info["kind"].(string); ok {
+		highlight.Kind = kind
+	}
+	if id, ok := info["id"]; ok {
+		highlight.ID = toInt(id)
+	}
+	if uiName, ok := info["ui_name"].(string); ok {
+		highlight.UIName = uiName
+	}
+	if hiName, ok := info["hi_name"].(string); ok {
+		highlight.HiName = hiName
+	}
+
+	highlight.Italic = hl["italic"] != nil
+	highlight.Bold = hl["bold"] != nil
+	highlight.Underline = hl["underline"] != nil
+	highlight.Undercurl = hl["undercurl"] != nil
+	highlight.Underdouble = hl["underdouble"] != nil
+	highlight.Underdotted = hl["underdotted"] != nil
+	highlight.Underdashed = hl["underdashed"] != nil
+	highlight.Strikethrough = hl["strikethrough"] != nil
+	highlight.Reverse = hl["reverse"] != nil
+	highlight.Altfont = hl["altfont"] != nil
+	highlight.Nocombine = hl["nocombine"] != nil
+
+	if fg, ok := hl["foreground"]; ok {
+		highlight.Foreground = toInt(fg)
+	}
+	if bg, ok := hl["background"]; ok {
+		highlight.Background = toInt(bg)
+	}
+	if sp, ok := hl["special"]; ok {
+		highlight.Special = toInt(sp)
+	}
+	if bl, ok := hl["blend"]; ok {
+		highlight.Blend = toInt(bl)
+	}
+
+	return highlight
+}
+
+// DefaultIsNormalWidth is the default width detection of the cell text.
+// ASCII is single width, and wide characters such as CJK characters and
+// emoji are double width.
+func DefaultIsNormalWidth(text string) bool {
+	if len(text) == 0 {
+		return true
+	}
+
+	// if ASCII
+	if text[0] <= 127 {
+		return true
+	}
+
+	return ClusterWidth(text, DefaultWidthOptions) == 1
+}
+
+// IsCJK reports whether char is a CJK character
+func IsCJK(char rune) bool {
+	if unicode.Is(unicode.Han, char) {
+		return true
+	}
+	if unicode.Is(unicode.Hiragana, char) {
+		return true
+	}
+	if unicode.Is(unicode.Katakana, char) {
+		return true
+	}
+	if unicode.Is(unicode.Hangul, char) {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,275 @@
+package grid
+
+import (
+	"sort"
+	"unicode"
+)
+
+// runeRange is an inclusive range of code points
+type runeRange struct {
+	lo rune
+	hi rune
+}
+
+// wideRanges is the East Asian Wide and Fullwidth characters
+var wideRanges = []runeRange{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A}, {0x23E9, 0x23EC},
+	{0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE},
+	{0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+	{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x303E},
+	{0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF}, {0xA000, 0xA4CF},
+	{0xA960, 0xA97F}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE10, 0xFE19},
+	{0xFE30, 0xFE6F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x16FE0, 0x16FE4},
+	{0x17000, 0x18CFF}, {0x1B000, 0x1B2FF}, {0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF},
+	{0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F202}, {0x1F210, 0x1F23B},
+	{0x1F240, 0x1F248}, {0x1F250, 0x1F251}, {0x1F260, 0x1F265}, {0x1F300, 0x1F320},
+	{0x1F32D, 0x1F335}, {0x1F337, 0x1F37C}, {0x1F37E, 0x1F393}, {0x1F3A0, 0x1F3CA},
+	{0x1F3CF, 0x1F3D3}, {0x1F3E0, 0x1F3F0}, {0x1F3F4, 0x1F3F4}, {0x1F3F8, 0x1F43E},
+	{0x1F440, 0x1F440}, {0x1F442, 0x1F4FC}, {0x1F4FF, 0x1F53D}, {0x1F54B, 0x1F54E},
+	{0x1F550, 0x1F567}, {0x1F57A, 0x1F57A}, {0x1F595, 0x1F596}, {0x1F5A4, 0x1F5A4},
+	{0x1F5FB, 0x1F64F}, {0x1F680, 0x1F6C5}, {0x1F6CC, 0x1F6CC}, {0x1F6D0, 0x1F6D2},
+	{0x1F6D5, 0x1F6D7}, {0x1F6EB, 0x1F6EC}, {0x1F6F4, 0x1F6FC}, {0x1F7E0, 0x1F7EB},
+	{0x1F90C, 0x1F93A}, {0x1F93C, 0x1F945}, {0x1F947, 0x1F9FF}, {0x1FA70, 0x1FAFF},
+	{0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+// emojiRanges is the emoji which are not East Asian Wide.
+// They are double width when the 'emoji' option is set.
+var emojiRanges = []runeRange{
+	{0x203C, 0x203C}, {0x2049, 0x2049}, {0x2122, 0x2122}, {0x2139, 0x2139},
+	{0x2194, 0x2199}, {0x21A9, 0x21AA}, {0x2328, 0x2328}, {0x23CF, 0x23CF},
+	{0x23ED, 0x23EF}, {0x23F1, 0x23F2}, {0x23F8, 0x23FA}, {0x24C2, 0x24C2},
+	{0x25AA, 0x25AB}, {0x25B6, 0x25B6}, {0x25C0, 0x25C0}, {0x25FB, 0x25FC},
+	{0x2600, 0x2604}, {0x260E, 0x260E}, {0x2611, 0x2611}, {0x2618, 0x2618},
+	{0x261D, 0x261D}, {0x2620, 0x2620}, {0x2622, 0x2623}, {0x2626, 0x2626},
+	{0x262A, 0x262A}, {0x262E, 0x262F}, {0x2638, 0x263A}, {0x2640, 0x2640},
+	{0x2642, 0x2642}, {0x265F, 0x2660}, {0x2663, 0x2663}, {0x2665, 0x2666},
+	{0x2668, 0x2668}, {0x267B, 0x267B}, {0x267E, 0x267E}, {0x2692, 0x2692},
+	{0x2694, 0x2697}, {0x2699, 0x2699}, {0x269B, 0x269C}, {0x26A0, 0x26A0},
+	{0x26A7, 0x26A7}, {0x26B0, 0x26B1}, {0x26C8, 0x26C8}, {0x26CF, 0x26CF},
+	{0x26D1, 0x26D1}, {0x26D3, 0x26D3}, {0x26E9, 0x26E9}, {0x26F0, 0x26F1},
+	{0x26F4, 0x26F4}, {0x26F7, 0x26F9}, {0x2702, 0x2702}, {0x2708, 0x2709},
+	{0x270C, 0x270D}, {0x270F, 0x270F}, {0x2712, 0x2712}, {0x2714, 0x2714},
+	{0x2716, 0x2716}, {0x271D, 0x271D}, {0x2721, 0x2721}, {0x2733, 0x2734},
+	{0x2744, 0x2744}, {0x2747, 0x2747}, {0x2763, 0x2764}, {0x27A1, 0x27A1},
+	{0x2934, 0x2935}, {0x2B05, 0x2B07}, {0x1F170, 0x1F171}, {0x1F17E, 0x1F17F},
+	{0x1F1E6, 0x1F1FF}, {0x1F321, 0x1F321}, {0x1F324, 0x1F32C}, {0x1F336, 0x1F336},
+	{0x1F37D, 0x1F37D}, {0x1F396, 0x1F397}, {0x1F399, 0x1F39B}, {0x1F39E, 0x1F39F},
+	{0x1F3CB, 0x1F3CE}, {0x1F3D4, 0x1F3DF}, {0x1F3F3, 0x1F3F5}, {0x1F3F7, 0x1F3F7},
+	{0x1F43F, 0x1F43F}, {0x1F441, 0x1F441}, {0x1F4FD, 0x1F4FD}, {0x1F549, 0x1F54A},
+	{0x1F56F, 0x1F570}, {0x1F573, 0x1F579}, {0x1F587, 0x1F587}, {0x1F58A, 0x1F58D},
+	{0x1F590, 0x1F590}, {0x1F5A5, 0x1F5A5}, {0x1F5A8, 0x1F5A8}, {0x1F5B1, 0x1F5B2},
+	{0x1F5BC, 0x1F5BC}, {0x1F5C2, 0x1F5C4}, {0x1F5D1, 0x1F5D3}, {0x1F5DC, 0x1F5DE},
+	{0x1F5E1, 0x1F5E1}, {0x1F5E3, 0x1F5E3}, {0x1F5E8, 0x1F5E8}, {0x1F5EF, 0x1F5EF},
+	{0x1F5F3, 0x1F5F3}, {0x1F5FA, 0x1F5FA}, {0x1F6CB, 0x1F6CB}, {0x1F6CD, 0x1F6CF},
+	{0x1F6E0, 0x1F6E5}, {0x1F6E9, 0x1F6E9}, {0x1F6F0, 0x1F6F0}, {0x1F6F3, 0x1F6F3},
+}
+
+// ambiguousRanges is the East Asian Ambiguous characters.
+// They are double width when the 'ambiwidth' option is "double".
+var ambiguousRanges = []runeRange{
+	{0x00A1, 0x00A1}, {0x00A4, 0x00A4}, {0x00A7, 0x00A8}, {0x00AA, 0x00AA},
+	{0x00AD, 0x00AE}, {0x00B0, 0x00B4}, {0x00B6, 0x00BA}, {0x00BC, 0x00BF},
+	{0x00C6, 0x00C6}, {0x00D0, 0x00D0}, {0x00D7, 0x00D8}, {0x00DE, 0x00E1},
+	{0x00E6, 0x00E6}, {0x00E8, 0x00EA}, {0x00EC, 0x00ED}, {0x00F0, 0x00F0},
+	{0x00F2, 0x00F3}, {0x00F7, 0x00FA}, {0x00FC, 0x00FC}, {0x00FE, 0x00FE},
+	{0x0391, 0x03A9}, {0x03B1, 0x03C9}, {0x0401, 0x0401}, {0x0410, 0x044F},
+	{0x0451, 0x0451}, {0x2010, 0x2010}, {0x2013, 0x2016}, {0x2018, 0x2019},
+	{0x201C, 0x201D}, {0x2020, 0x2022}, {0x2024, 0x2027}, {0x2030, 0x2030},
+	{0x2032, 0x2033}, {0x2035, 0x2035}, {0x203B, 0x203B}, {0x203E, 0x203E},
+	{0x2074, 0x2074}, {0x207F, 0x207F}, {0x2081, 0x2084}, {0x20AC, 0x20AC},
+	{0x2103, 0x2103}, {0x2105, 0x2105}, {0x2109, 0x2109}, {0x2113, 0x2113},
+	{0x2116, 0x2116}, {0x2121, 0x2122}, {0x2126, 0x2126}, {0x212B, 0x212B},
+	{0x2153, 0x2154}, {0x215B, 0x215E}, {0x2160, 0x216B}, {0x2170, 0x2179},
+	{0x2189, 0x2189}, {0x2190, 0x2199}, {0x21B8, 0x21B9}, {0x21D2, 0x21D2},
+	{0x21D4, 0x21D4}, {0x21E7, 0x21E7}, {0x2200, 0x2200}, {0x2202, 0x2203},
+	{0x2207, 0x2208}, {0x220B, 0x220B}, {0x220F, 0x220F}, {0x2211, 0x2211},
+	{0x2215, 0x2215}, {0x221A, 0x221A}, {0x221D, 0x2220}, {0x2223, 0x2223},
+	{0x2225, 0x2225}, {0x2227, 0x222C}, {0x222E, 0x222E}, {0x2234, 0x2237},
+	{0x223C, 0x223D}, {0x2248, 0x2248}, {0x224C, 0x224C}, {0x2252, 0x2252},
+	{0x2260, 0x2261}, {0x2264, 0x2267}, {0x226A, 0x226B}, {0x226E, 0x226F},
+	{0x2282, 0x2283}, {0x2286, 0x2287}, {0x2295, 0x2295}, {0x2299, 0x2299},
+	{0x22A5, 0x22A5}, {0x22BF, 0x22BF}, {0x2312, 0x2312}, {0x2460, 0x24E9},
+	{0x24EB, 0x254B}, {0x2550, 0x2573}, {0x2580, 0x258F}, {0x2592, 0x2595},
+	{0x25A0, 0x25A1}, {0x25A3, 0x25A9}, {0x25B2, 0x25B3}, {0x25B6, 0x25B7},
+	{0x25BC, 0x25BD}, {0x25C0, 0x25C1}, {0x25C6, 0x25C8}, {0x25CB, 0x25CB},
+	{0x25CE, 0x25D1}, {0x25E2, 0x25E5}, {0x25EF, 0x25EF}, {0x2605, 0x2606},
+	{0x2609, 0x2609}, {0x260E, 0x260F}, {0x261C, 0x261C}, {0x261E, 0x261E},
+	{0x2640, 0x2640}, {0x2642, 0x2642}, {0x2660, 0x2661}, {0x2663, 0x2665},
+	{0x2667, 0x266A}, {0x266C, 0x266D}, {0x266F, 0x266F}, {0x269E, 0x269F},
+	{0x26BF, 0x26BF}, {0x26C6, 0x26CD}, {0x26CF, 0x26D3}, {0x26D5, 0x26E1},
+	{0x26E3, 0x26E3}, {0x26E8, 0x26E9}, {0x26EB, 0x26F1}, {0x26F4, 0x26F4},
+	{0x26F6, 0x26F9}, {0x26FB, 0x26FC}, {0x26FE, 0x26FF}, {0x273D, 0x273D},
+	{0x2776, 0x277F}, {0x2B56, 0x2B59}, {0x3248, 0x324F}, {0xE000, 0xF8FF},
+	{0xFFFD, 0xFFFD}, {0x1F100, 0x1F10A}, {0x1F110, 0x1F12D}, {0x1F130, 0x1F169},
+	{0x1F170, 0x1F18D}, {0x1F18F, 0x1F190}, {0x1F19B, 0x1F1AC},
+}
+
+const (
+	zeroWidthJoiner     = 0x200D
+	textPresentation    = 0xFE0E
+	emojiPresentation   = 0xFE0F
+	regionalIndicatorLo = 0x1F1E6
+	regionalIndicatorHi = 0x1F1FF
+)
+
+// WidthOptions is the options of neovim which change the width of characters
+type WidthOptions struct {
+	// AmbiwidthDouble is true if 'ambiwidth' is "double"
+	AmbiwidthDouble bool
+	// Emoji is the 'emoji' option
+	Emoji bool
+}
+
+// DefaultWidthOptions is the default value of the options in neovim
+var DefaultWidthOptions = WidthOptions{
+	AmbiwidthDouble: false,
+	Emoji:           true,
+}
+
+func inRanges(r rune, ranges []runeRange) bool {
+	i := sort.Search(len(ranges), func(i int) bool {
+		return ranges[i].hi >= r
+	})
+
+	return i < len(ranges) && ranges[i].lo <= r
+}
+
+// isExtend reports whether r extends the preceding grapheme cluster
+func isExtend(r rune) bool {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) {
+		return true
+	}
+	// variation selectors
+	if (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF) {
+		return true
+	}
+	// emoji skin tone modifiers
+	if r >= 0x1F3FB && r <= 0x1F3FF {
+		return true
+	}
+	// tags for emoji sub-region flags
+	if r >= 0xE0020 && r <= 0xE007F {
+		return true
+	}
+
+	return r == zeroWidthJoiner
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalIndicatorLo && r <= regionalIndicatorHi
+}
+
+// IsEmoji reports whether r is an emoji which may be drawn as a colour glyph
+func IsEmoji(r rune) bool {
+	if r >= 0x1F000 && r <= 0x1FAFF {
+		return true
+	}
+
+	return inRanges(r, emojiRanges)
+}
+
+// Graphemes splits text into the grapheme clusters. It handles the combining
+// marks, variation selectors, ZWJ sequences, skin tone modifiers and flags,
+// which is enough to segment the text of neovim cells.
+func Graphemes(text string) []string {
+	var clusters []string
+	start := 0
+	var prev rune = -1
+	riCount := 0
+	for i, r := range text {
+		join := false
+		switch {
+		case prev < 0:
+		case isExtend(r):
+			join = true
+		case prev == zeroWidthJoiner:
+			join = true
+		case isRegionalIndicator(r) && isRegionalIndicator(prev) && riCount%2 == 1:
+			join = true
+		}
+		if !join && prev >= 0 {
+			clusters = append(clusters, text[start:i])
+			start = i
+		}
+		if isRegionalIndicator(r) {
+			riCount++
+		} else if !isExtend(r) {
+			riCount = 0
+		}
+		prev = r
+	}
+	if start < len(text) {
+		clusters = append(clusters, text[start:])
+	}
+
+	return clusters
+}
+
+// RuneWidth returns the number of cells r occupies
+func RuneWidth(r rune, opts WidthOptions) int {
+	if r == 0 {
+		return 0
+	}
+	if r < 0x7F {
+		return 1
+	}
+	if isExtend(r) || unicode.Is(unicode.Cf, r) {
+		return 0
+	}
+	if inRanges(r, wideRanges) {
+		return 2
+	}
+	if opts.Emoji && inRanges(r, emojiRanges) && !isRegionalIndicator(r) {
+		return 2
+	}
+	if opts.AmbiwidthDouble && inRanges(r, ambiguousRanges) {
+		return 2
+	}
+
+	return 1
+}
+
+// ClusterWidth returns the number of cells a grapheme cluster occupies
+func ClusterWidth(cluster string, opts WidthOptions) int {
+	width := 0
+	first := true
+	var base rune
+	for _, r := range cluster {
+		if first {
+			base = r
+			width = RuneWidth(r, opts)
+			first = false
+			continue
+		}
+		switch {
+		case r == emojiPresentation && opts.Emoji && IsEmoji(base):
+			width = 2
+		case r == textPresentation && !inRanges(base, wideRanges):
+			width = 1
+		case isRegionalIndicator(r) && isRegionalIndicator(base):
+			width = 2
+		}
+	}
+	if width == 0 && !first {
+		// a lone combining character is drawn on a cell
+		width = 1
+	}
+
+	return width
+}
+
+// StringWidth returns the number of cells text occupies
+func StringWidth(text string, opts WidthOptions) int {
+	width := 0
+	for _, cluster := range Graphemes(text) {
+		width += ClusterWidth(cluster, opts)
+	}
+
+	return width
+}
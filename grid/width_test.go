@@ -0,0 +1,115 @@
+package grid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRanges_Sorted(t *testing.T) {
+	for name, ranges := range map[string][]runeRange{
+		"wide":      wideRanges,
+		"emoji":     emojiRanges,
+		"ambiguous": ambiguousRanges,
+	} {
+		for i, r := range ranges {
+			if r.lo > r.hi {
+				t.Errorf("%s: range %d is reversed", name, i)
+			}
+			if i > 0 && ranges[i-1].hi >= r.lo {
+				t.Errorf("%s: range %d is not sorted", name, i)
+			}
+		}
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"ascii", "abc", []string{"a", "b", "c"}},
+		{"combining", "éx", []string{"é", "x"}},
+		{"zwj sequence", "👨‍👩‍👧a", []string{"👨‍👩‍👧", "a"}},
+		{"skin tone", "👍🏽👍", []string{"👍🏽", "👍"}},
+		{"variation selector", "☀️☀", []string{"☀️", "☀"}},
+		{"flags", "🇯🇵🇫🇷🇩", []string{"🇯🇵", "🇫🇷", "🇩"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Graphemes(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Graphemes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterWidth(t *testing.T) {
+	single := WidthOptions{AmbiwidthDouble: false, Emoji: true}
+	double := WidthOptions{AmbiwidthDouble: true, Emoji: true}
+	noEmoji := WidthOptions{AmbiwidthDouble: false, Emoji: false}
+
+	tests := []struct {
+		name    string
+		cluster string
+		opts    WidthOptions
+		want    int
+	}{
+		{"ascii", "a", single, 1},
+		{"cjk", "漢", single, 2},
+		{"hangul", "한", single, 2},
+		{"fullwidth", "Ａ", single, 2},
+		{"combining", "é", single, 1},
+		{"lone combining", "́", single, 1},
+		{"wide emoji", "😀", single, 2},
+		{"wide emoji without emoji option", "😀", noEmoji, 2},
+		{"zwj sequence", "👨‍👩‍👧", single, 2},
+		{"text emoji", "☀", single, 2},
+		{"text emoji without emoji option", "☀", noEmoji, 1},
+		{"emoji presentation", "☀️", single, 2},
+		{"text presentation", "☀︎", single, 1},
+		{"flag", "🇯🇵", single, 2},
+		{"ambiguous single", "…", single, 1},
+		{"ambiguous double", "…", double, 2},
+		{"greek double", "α", double, 2},
+		{"private use double", "", double, 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClusterWidth(tt.cluster, tt.opts); got != tt.want {
+				t.Errorf("ClusterWidth(%q) = %v, want %v", tt.cluster, got, tt.want)
+			}
+		})
+	}
+
+	if got := StringWidth("a漢😀é", single); got != 6 {
+		t.Errorf("StringWidth() = %v, want 6", got)
+	}
+}
+
+func TestGrid_CellWidth(t *testing.T) {
+	m := NewModel()
+	g := m.Resize(2, 5, 1)
+	m.Line(2, 0, 0, []interface{}{
+		[]interface{}{"a", 1},
+		[]interface{}{"😀"},
+		[]interface{}{""},
+		[]interface{}{"…"},
+		[]interface{}{""},
+	})
+	want := []int{1, 2, 0, 2, 0}
+	for i, c := range g.Cells[0] {
+		if c.Width != want[i] {
+			t.Errorf("col %v: Width = %v, want %v", i, c.Width, want[i])
+		}
+	}
+
+	// Overwriting the empty cell makes the previous cell single width
+	m.Line(2, 0, 4, []interface{}{[]interface{}{"b", 1}})
+	if got := g.Cells[0][3].Width; got != 1 {
+		t.Errorf("Width after overwrite = %v, want 1", got)
+	}
+}
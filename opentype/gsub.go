@@ -0,0 +1,314 @@
+// Package opentype reads the OpenType features of a font which can be applied
+// on top of the text shaping of Qt 5, which has no API to set them.
+package opentype
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ligatureFeatures is the features which form ligatures. They are applied by
+// the text shaping, and can only be turned off by not drawing the adjacent
+// characters together.
+var ligatureFeatures = map[string]bool{
+	"liga": true,
+	"calt": true,
+	"clig": true,
+	"dlig": true,
+	"rlig": true,
+}
+
+// IsLigatureFeature reports whether the feature tag forms ligatures
+func IsLigatureFeature(tag string) bool {
+	return ligatureFeatures[tag]
+}
+
+// ParseFeature parses a feature in the form of "ss01", "+ss01" or "-calt".
+// It returns false if the tag is not a valid OpenType feature tag.
+func ParseFeature(feature string) (string, bool, bool) {
+	enabled := true
+	switch {
+	case strings.HasPrefix(feature, "-"):
+		enabled = false
+		feature = feature[1:]
+	case strings.HasPrefix(feature, "+"):
+		feature = feature[1:]
+	}
+	if len(feature) != 4 {
+		return "", false, false
+	}
+	for _, c := range feature {
+		if c < 0x20 || c > 0x7e {
+			return "", false, false
+		}
+	}
+
+	return feature, enabled, true
+}
+
+// Lookup types of GSUB
+const (
+	lookupSingle    = 1
+	lookupAlternate = 3
+	lookupExtension = 7
+)
+
+// Substitution is the glyph substitutions of the features found in a GSUB
+// table. Only the single and alternate substitutions are supported, which
+// are what stylistic sets, character variants and "zero" mostly consist of.
+// The first alternate is used for the alternate substitutions.
+type Substitution struct {
+	// lookups is the substitutions of the lookups in the order of the
+	// lookup list, which is the order they are applied in
+	lookups []map[uint16]uint16
+
+	// Found is the tags of the features the table has
+	Found []string
+	// Unsupported is the tags of the features which have lookups of
+	// types other than the single and alternate substitutions.
+	// They are applied only partially.
+	Unsupported []string
+}
+
+// Glyph returns the glyph which g is substituted with
+func (s *Substitution) Glyph(g uint16) uint16 {
+	for _, lookup := range s.lookups {
+		if sub, ok := lookup[g]; ok {
+			g = sub
+		}
+	}
+
+	return g
+}
+
+// Empty reports whether s substitutes no glyph
+func (s *Substitution) Empty() bool {
+	return len(s.lookups) == 0
+}
+
+// reader reads the big-endian values of a table with bounds checking
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) u16(offset int) uint16 {
+	if r.err != nil {
+		return 0
+	}
+	if offset < 0 || offset+2 > len(r.data) {
+		r.err = fmt.Errorf("offset %d is out of the table of %d bytes", offset, len(r.data))
+		return 0
+	}
+
+	return binary.BigEndian.Uint16(r.data[offset:])
+}
+
+func (r *reader) u32(offset int) uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if offset < 0 || offset+4 > len(r.data) {
+		r.err = fmt.Errorf("offset %d is out of the table of %d bytes", offset, len(r.data))
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(r.data[offset:])
+}
+
+func (r *reader) tag(offset int) string {
+	if r.err != nil {
+		return ""
+	}
+	if offset < 0 || offset+4 > len(r.data) {
+		r.err = fmt.Errorf("offset %d is out of the table of %d bytes", offset, len(r.data))
+		return ""
+	}
+
+	return string(r.data[offset : offset+4])
+}
+
+// ParseGSUB reads the substitutions of the features with tags from the GSUB
+// table. The lookups of the feature records of all the scripts and languages
+// are used, since the text in the grid has no language.
+func ParseGSUB(data []byte, tags []string) (*Substitution, error) {
+	s := &Substitution{}
+	if len(tags) == 0 {
+		return s, nil
+	}
+	wanted := map[string]bool{}
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+
+	r := &reader{data: data}
+	if major := r.u16(0); r.err == nil && major != 1 {
+		return nil, fmt.Errorf("unsupported GSUB version %d", major)
+	}
+	featureList := int(r.u16(6))
+	lookupList := int(r.u16(8))
+
+	// The lookup indices of the features, and the features using them
+	lookupFeatures := map[int][]string{}
+	found := map[string]bool{}
+	featureCount := int(r.u16(featureList))
+	for i := 0; i < featureCount && r.err == nil; i++ {
+		record := featureList + 2 + i*6
+		tag := r.tag(record)
+		if !wanted[tag] {
+			continue
+		}
+		found[tag] = true
+		feature := featureList + int(r.u16(record+4))
+		lookupCount := int(r.u16(feature + 2))
+		for j := 0; j < lookupCount; j++ {
+			index := int(r.u16(feature + 4 + j*2))
+			lookupFeatures[index] = append(lookupFeatures[index], tag)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	indices := make([]int, 0, len(lookupFeatures))
+	for index := range lookupFeatures {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	unsupported := map[string]bool{}
+	lookupCount := int(r.u16(lookupList))
+	for _, index := range indices {
+		if index >= lookupCount {
+			continue
+		}
+		lookup := lookupList + int(r.u16(lookupList+2+index*2))
+		subs, ok := r.lookup(lookup)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if !ok {
+			for _, tag := range lookupFeatures[index] {
+				unsupported[tag] = true
+			}
+			continue
+		}
+		if len(subs) > 0 {
+			s.lookups = append(s.lookups, subs)
+		}
+	}
+
+	s.Found = sortedTags(found)
+	s.Unsupported = sortedTags(unsupported)
+
+	return s, nil
+}
+
+// lookup reads the substitutions of the lookup table at offset. It returns
+// false if the lookup has a type other than the single and alternate
+// substitutions.
+func (r *reader) lookup(offset int) (map[uint16]uint16, bool) {
+	lookupType := int(r.u16(offset))
+	subTableCount := int(r.u16(offset + 4))
+	subs := map[uint16]uint16{}
+	for i := 0; i < subTableCount && r.err == nil; i++ {
+		subTable := offset + int(r.u16(offset+6+i*2))
+		subTableType := lookupType
+		if lookupType == lookupExtension {
+			subTableType = int(r.u16(subTable + 2))
+			subTable += int(r.u32(subTable + 4))
+		}
+
+		switch subTableType {
+		case lookupSingle:
+			r.singleSubst(subTable, subs)
+		case lookupAlternate:
+			r.alternateSubst(subTable, subs)
+		default:
+			return nil, false
+		}
+	}
+
+	return subs, true
+}
+
+func (r *reader) singleSubst(offset int, subs map[uint16]uint16) {
+	format := r.u16(offset)
+	coverage := r.coverage(offset + int(r.u16(offset+2)))
+	switch format {
+	case 1:
+		delta := r.u16(offset + 4)
+		for _, g := range coverage {
+			if _, ok := subs[g]; !ok {
+				subs[g] = g + delta
+			}
+		}
+	case 2:
+		count := int(r.u16(offset + 4))
+		for i, g := range coverage {
+			if i >= count {
+				break
+			}
+			if _, ok := subs[g]; !ok {
+				subs[g] = r.u16(offset + 6 + i*2)
+			}
+		}
+	}
+}
+
+func (r *reader) alternateSubst(offset int, subs map[uint16]uint16) {
+	coverage := r.coverage(offset + int(r.u16(offset+2)))
+	count := int(r.u16(offset + 4))
+	for i, g := range coverage {
+		if i >= count {
+			break
+		}
+		set := offset + int(r.u16(offset+6+i*2))
+		if r.u16(set) == 0 {
+			continue
+		}
+		if _, ok := subs[g]; !ok {
+			subs[g] = r.u16(set + 2)
+		}
+	}
+}
+
+// coverage returns the glyphs of the coverage table at offset in the order
+// of the coverage index
+func (r *reader) coverage(offset int) []uint16 {
+	var glyphs []uint16
+	switch r.u16(offset) {
+	case 1:
+		count := int(r.u16(offset + 2))
+		for i := 0; i < count && r.err == nil; i++ {
+			glyphs = append(glyphs, r.u16(offset+4+i*2))
+		}
+	case 2:
+		count := int(r.u16(offset + 2))
+		for i := 0; i < count && r.err == nil; i++ {
+			record := offset + 4 + i*6
+			start := int(r.u16(record))
+			end := int(r.u16(record + 2))
+			for g := start; g <= end; g++ {
+				glyphs = append(glyphs, uint16(g))
+			}
+		}
+	}
+
+	return glyphs
+}
+
+func sortedTags(tags map[string]bool) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	sorted := make([]string, 0, len(tags))
+	for tag := range tags {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
@@ -0,0 +1,201 @@
+package opentype
+
+import (
+	"reflect"
+	"testing"
+)
+
+func u16s(values ...int) []byte {
+	b := make([]byte, 0, len(values)*2)
+	for _, v := range values {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func coverage1(glyphs ...int) []byte {
+	return concat(u16s(1, len(glyphs)), u16s(glyphs...))
+}
+
+func coverage2(start, end int) []byte {
+	return u16s(2, 1, start, end, 0)
+}
+
+func single1(delta int, coverage []byte) []byte {
+	return concat(u16s(1, 6, delta), coverage)
+}
+
+func single2(coverage []byte, subs ...int) []byte {
+	return concat(u16s(2, 6+2*len(subs), len(subs)), u16s(subs...), coverage)
+}
+
+func alternate(coverage []byte, alts ...int) []byte {
+	return concat(u16s(1, 10+2*len(alts), 1, 8), u16s(len(alts)), u16s(alts...), coverage)
+}
+
+func extension(lookupType int, subTable []byte) []byte {
+	return concat(u16s(1, lookupType, 0, 8), subTable)
+}
+
+func lookup(lookupType int, subTable []byte) []byte {
+	return concat(u16s(lookupType, 0, 1, 8), subTable)
+}
+
+func lookupList(lookups ...[]byte) []byte {
+	header := u16s(len(lookups))
+	var body []byte
+	for _, l := range lookups {
+		header = append(header, u16s(2+2*len(lookups)+len(body))...)
+		body = append(body, l...)
+	}
+	return concat(header, body)
+}
+
+type featureRecord struct {
+	tag     string
+	lookups []int
+}
+
+func featureList(records ...featureRecord) []byte {
+	header := u16s(len(records))
+	var body []byte
+	for _, r := range records {
+		header = append(header, r.tag...)
+		header = append(header, u16s(2+6*len(records)+len(body))...)
+		body = append(body, concat(u16s(0, len(r.lookups)), u16s(r.lookups...))...)
+	}
+	return concat(header, body)
+}
+
+func gsub(features, lookups []byte) []byte {
+	return concat(u16s(1, 0, 0, 10, 10+len(features)), features, lookups)
+}
+
+func testGSUB() []byte {
+	return gsub(
+		featureList(
+			featureRecord{"ss01", []int{0}},
+			featureRecord{"zero", []int{1}},
+			featureRecord{"calt", []int{2}},
+			featureRecord{"cv01", []int{3}},
+			featureRecord{"ss02", []int{4, 0}},
+		),
+		lookupList(
+			lookup(lookupSingle, single1(10, coverage1(5, 6))),
+			lookup(lookupExtension, extension(lookupSingle, single2(coverage2(20, 21), 30, 31))),
+			lookup(6, u16s(1)),
+			lookup(lookupAlternate, alternate(coverage1(7), 40, 41)),
+			lookup(lookupSingle, single1(1, coverage1(15))),
+		),
+	)
+}
+
+func TestParseGSUB(t *testing.T) {
+	tests := []struct {
+		name            string
+		tags            []string
+		want            map[uint16]uint16
+		wantFound       []string
+		wantUnsupported []string
+	}{
+		{
+			"single substitution by delta",
+			[]string{"ss01"},
+			map[uint16]uint16{5: 15, 6: 16, 7: 7},
+			[]string{"ss01"},
+			nil,
+		},
+		{
+			"extension and glyph list",
+			[]string{"zero"},
+			map[uint16]uint16{20: 30, 21: 31, 22: 22},
+			[]string{"zero"},
+			nil,
+		},
+		{
+			"first alternate",
+			[]string{"cv01"},
+			map[uint16]uint16{7: 40},
+			[]string{"cv01"},
+			nil,
+		},
+		{
+			"lookups are applied in the order of the lookup list",
+			[]string{"ss02"},
+			map[uint16]uint16{5: 16, 6: 16},
+			[]string{"ss02"},
+			nil,
+		},
+		{
+			"unsupported lookup type",
+			[]string{"calt", "ss01"},
+			map[uint16]uint16{5: 15},
+			[]string{"calt", "ss01"},
+			[]string{"calt"},
+		},
+		{
+			"missing feature",
+			[]string{"ss20"},
+			map[uint16]uint16{5: 5},
+			nil,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseGSUB(testGSUB(), tt.tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for g, want := range tt.want {
+				if got := s.Glyph(g); got != want {
+					t.Errorf("Glyph(%d) = %d, want %d", g, got, want)
+				}
+			}
+			if !reflect.DeepEqual(s.Found, tt.wantFound) {
+				t.Errorf("Found = %v, want %v", s.Found, tt.wantFound)
+			}
+			if !reflect.DeepEqual(s.Unsupported, tt.wantUnsupported) {
+				t.Errorf("Unsupported = %v, want %v", s.Unsupported, tt.wantUnsupported)
+			}
+		})
+	}
+}
+
+func TestParseGSUB_Truncated(t *testing.T) {
+	data := testGSUB()
+	for i := 0; i < len(data); i++ {
+		// Must not panic
+		ParseGSUB(data[:i], []string{"ss01", "zero", "calt", "cv01", "ss02"})
+	}
+}
+
+func TestParseFeature(t *testing.T) {
+	tests := []struct {
+		feature     string
+		wantTag     string
+		wantEnabled bool
+		wantOk      bool
+	}{
+		{"ss01", "ss01", true, true},
+		{"+zero", "zero", true, true},
+		{"-calt", "calt", false, true},
+		{"calt1", "", false, false},
+		{"-", "", false, false},
+	}
+	for _, tt := range tests {
+		tag, enabled, ok := ParseFeature(tt.feature)
+		if tag != tt.wantTag || enabled != tt.wantEnabled || ok != tt.wantOk {
+			t.Errorf("ParseFeature(%q) = %q, %v, %v", tt.feature, tag, enabled, ok)
+		}
+	}
+}
@@ -3,8 +3,20 @@
 package util
 
 import (
+	"os"
 	"os/exec"
+	"syscall"
 )
 
 func PrepareRunProc(cmd *exec.Cmd) {
 }
+
+// IsProcessRunning reports whether the process of pid is running
+func IsProcessRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -3,6 +3,7 @@
 package util
 
 import (
+	"os"
 	"os/exec"
 	"syscall"
 )
@@ -10,3 +11,15 @@ import (
 func PrepareRunProc(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
 }
+
+// IsProcessRunning reports whether the process of pid is running.
+// The process can be opened only while it exists on Windows.
+func IsProcessRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+
+	return true
+}
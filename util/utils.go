@@ -114,11 +114,20 @@ func NewHFlowLayout(spacing int, padding int, paddingTop int, rightIdex int, wid
 	layout := widgets.NewQLayout2()
 	items := []*widgets.QLayoutItem{}
 	rect := core.NewQRect()
+	// the items are stacked, so the height is the sum of them
+	totalHeight := func() int {
+		height := 0
+		for _, item := range items {
+			height += item.SizeHint().Height()
+		}
+		return height
+	}
 	layout.ConnectSizeHint(func() *core.QSize {
 		size := core.NewQSize()
 		for _, item := range items {
 			size = size.ExpandedTo(item.MinimumSize())
 		}
+		size.SetHeight(totalHeight())
 		return size
 	})
 	if width > 0 {
@@ -127,6 +136,7 @@ func NewHFlowLayout(spacing int, padding int, paddingTop int, rightIdex int, wid
 			for _, item := range items {
 				size = size.ExpandedTo(item.MinimumSize())
 			}
+			size.SetHeight(totalHeight())
 			if size.Width() > width {
 				size.SetWidth(width)
 			}